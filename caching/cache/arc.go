@@ -0,0 +1,143 @@
+package cache
+
+import "container/list"
+
+// arcPolicy implements Adaptive Replacement Cache. Resident entries live in a
+// recency list (t1) or a frequency list (t2); the keys of recently evicted
+// entries are remembered in ghost lists (b1, b2) and used to shift the target
+// size of t1 towards whichever side would have produced the hit.
+type arcPolicy struct {
+	capacity int
+	target   int // Target size of t1
+	t1, t2   *list.List
+	b1, b2   *list.List
+	resident map[*Node]arcRef
+	ghosts   map[string]arcRef
+	// ghostHitB2 remembers whether the last insert was a hit in b2, which
+	// biases the next replacement towards t1.
+	ghostHitB2 bool
+}
+
+// arcRef locates an entry in either the first or the second list of a pair.
+type arcRef struct {
+	elem   *list.Element
+	second bool // Entry lives in t2 or b2
+}
+
+func newARCPolicy(capacity int) *arcPolicy {
+	p := &arcPolicy{capacity: capacity}
+	p.Reset()
+	return p
+}
+
+func (p *arcPolicy) Name() string { return PolicyARC }
+
+// limit returns the size the ghost lists are bounded by. An unbounded cache
+// uses its current resident size instead.
+func (p *arcPolicy) limit() int {
+	if p.capacity > 0 {
+		return p.capacity
+	}
+	return max(p.t1.Len()+p.t2.Len(), 1)
+}
+
+func (p *arcPolicy) Add(node *Node) {
+	p.ghostHitB2 = false
+	if ref, ok := p.ghosts[node.Key]; ok {
+		b1Size, b2Size := p.b1.Len(), p.b2.Len()
+		if !ref.second {
+			p.target = min(p.limit(), p.target+max(b2Size/max(b1Size, 1), 1))
+			p.b1.Remove(ref.elem)
+		} else {
+			p.target = max(0, p.target-max(b1Size/max(b2Size, 1), 1))
+			p.b2.Remove(ref.elem)
+			p.ghostHitB2 = true
+		}
+		delete(p.ghosts, node.Key)
+		p.resident[node] = arcRef{elem: p.t2.PushFront(node), second: true}
+		return
+	}
+
+	p.resident[node] = arcRef{elem: p.t1.PushFront(node)}
+	p.trimGhosts()
+}
+
+func (p *arcPolicy) Access(node *Node) {
+	ref, ok := p.resident[node]
+	if !ok {
+		return
+	}
+	if !ref.second {
+		p.t1.Remove(ref.elem)
+		p.resident[node] = arcRef{elem: p.t2.PushFront(node), second: true}
+		return
+	}
+	p.t2.MoveToFront(ref.elem)
+}
+
+func (p *arcPolicy) Remove(node *Node) {
+	ref, ok := p.resident[node]
+	if !ok {
+		return
+	}
+	if ref.second {
+		p.t2.Remove(ref.elem)
+	} else {
+		p.t1.Remove(ref.elem)
+	}
+	delete(p.resident, node)
+}
+
+func (p *arcPolicy) Victim() *Node {
+	var from, ghost *list.List
+	t1Size := p.t1.Len()
+	if t1Size > 0 && (t1Size > p.target || (p.ghostHitB2 && t1Size == p.target) || p.t2.Len() == 0) {
+		from, ghost = p.t1, p.b1
+	} else if p.t2.Len() > 0 {
+		from, ghost = p.t2, p.b2
+	} else {
+		return nil
+	}
+
+	node := from.Remove(from.Back()).(*Node)
+	delete(p.resident, node)
+	p.ghosts[node.Key] = arcRef{elem: ghost.PushFront(node.Key), second: ghost == p.b2}
+	p.trimGhosts()
+	return node
+}
+
+// trimGhosts keeps t1+b1 and the whole directory within the ARC bounds.
+func (p *arcPolicy) trimGhosts() {
+	limit := p.limit()
+	for p.b1.Len() > 0 && p.t1.Len()+p.b1.Len() > limit {
+		p.dropGhost(p.b1)
+	}
+	for p.b2.Len() > 0 && p.t1.Len()+p.t2.Len()+p.b1.Len()+p.b2.Len() > 2*limit {
+		p.dropGhost(p.b2)
+	}
+}
+
+func (p *arcPolicy) dropGhost(ghost *list.List) {
+	key := ghost.Remove(ghost.Back()).(string)
+	delete(p.ghosts, key)
+}
+
+func (p *arcPolicy) Keys() []string {
+	keys := make([]string, 0, p.t1.Len()+p.t2.Len())
+	for e := p.t2.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(*Node).Key)
+	}
+	for e := p.t1.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(*Node).Key)
+	}
+	return keys
+}
+
+func (p *arcPolicy) Reset() {
+	p.target = 0
+	p.t1, p.t2 = list.New(), list.New()
+	p.b1, p.b2 = list.New(), list.New()
+	p.resident = make(map[*Node]arcRef)
+	p.ghosts = make(map[string]arcRef)
+	p.ghostHitB2 = false
+}
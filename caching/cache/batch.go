@@ -0,0 +1,48 @@
+package cache
+
+import "time"
+
+// MGet returns the strings stored under keys, read together so they are
+// consistent with each other. Keys that are missing or hold another type are
+// left out of the result.
+func (c *Cache) MGet(keys ...string) map[string][]byte {
+	unlock := c.lockKeys(keys...)
+	defer unlock()
+
+	values := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		if value, err := c.shardFor(key).get(key); err == nil {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// MSet stores every value under its key, like Set with the same duration for
+// all of them. The keys are written atomically and recorded as a single AOF
+// record, which the slaves apply as a single update. It returns the errors of
+// the keys that could not be stored, and an empty map when all were.
+func (c *Cache) MSet(values map[string][]byte, duration time.Duration) map[string]error {
+	failed := make(map[string]error)
+	c.atomically(func() {
+		for key, value := range values {
+			if _, err := c.shardFor(key).set(key, value, duration, nil, nil); err != nil {
+				failed[key] = err
+			}
+		}
+	})
+	return failed
+}
+
+// MDel deletes keys atomically, recorded as a single AOF record, and reports
+// for each key whether it existed.
+func (c *Cache) MDel(keys ...string) map[string]bool {
+	deleted := make(map[string]bool, len(keys))
+	c.atomically(func() {
+		for _, key := range keys {
+			err := c.shardFor(key).remove(key, EventDel, string(CMDDel), string(CMDDel), key)
+			deleted[key] = err == nil
+		}
+	})
+	return deleted
+}
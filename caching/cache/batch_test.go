@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBatchOperations(t *testing.T) {
+	c := NewCacheWithOptions(Options{Shards: 4})
+	defer c.Close()
+
+	values := make(map[string][]byte)
+	for i := 0; i < 20; i++ {
+		values["key:"+strconv.Itoa(i)] = []byte(strconv.Itoa(i))
+	}
+	if failed := c.MSet(values, 0); len(failed) != 0 {
+		t.Fatalf("MSet failed for %v", failed)
+	}
+	if _, err := c.SAdd("set", "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	found := c.MGet("key:0", "key:19", "missing", "set")
+	if len(found) != 2 || string(found["key:0"]) != "0" || string(found["key:19"]) != "19" {
+		t.Fatalf("MGet = %q, want key:0 and key:19 only", found)
+	}
+
+	deleted := c.MDel("key:0", "key:1", "missing")
+	if !deleted["key:0"] || !deleted["key:1"] || deleted["missing"] || len(deleted) != 3 {
+		t.Fatalf("MDel = %v, want key:0 and key:1 deleted", deleted)
+	}
+	if size := c.Stats().Size; size != 19 {
+		t.Fatalf("size = %d, want 19", size)
+	}
+}
+
+func TestMSetIsOneRecord(t *testing.T) {
+	master := NewCacheWithOptions(Options{Shards: 4})
+	defer master.Close()
+	records := recordWrites(master)
+
+	master.MSet(map[string][]byte{"a": []byte("1"), "b": []byte("2"), "c": []byte("3")}, 0)
+	master.MDel("a", "b")
+	written := records()
+	if len(written) != 2 || !strings.HasPrefix(written[0], string(CMDExec)+" 3 ") || !strings.HasPrefix(written[1], string(CMDExec)+" 2 ") {
+		t.Fatalf("records = %q, want one EXEC record for each batch", written)
+	}
+
+	slave := NewCache()
+	defer slave.Close()
+	for _, record := range written {
+		if err := slave.ApplyRecord(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if keys := sortedKeys(slave); len(keys) != 1 || keys[0] != "c" {
+		t.Fatalf("slave keys = %q, want c", keys)
+	}
+}
+
+func TestMSetReportsFailedKeys(t *testing.T) {
+	c := NewCacheWithOptions(Options{Shards: 1, MaxMemory: 1})
+	defer c.Close()
+
+	failed := c.MSet(map[string][]byte{"a": []byte("1"), "b": []byte("2")}, 0)
+	if len(failed) != 2 || !errors.Is(failed["a"], ErrOutOfMemory) || !errors.Is(failed["b"], ErrOutOfMemory) {
+		t.Fatalf("MSet under noeviction = %v, want both keys out of memory", failed)
+	}
+}
@@ -1,24 +1,65 @@
 package cache
 
 import (
-	"errors"
 	"fmt"
-	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Cache struct {
-	CacheMap     map[string]*Node
-	Queue        *Queue
-	mutex        sync.Mutex
-	aofFile      *os.File
-	aofMutex     sync.Mutex
-	replayingAOF bool
-	Size         int // Size of the cache
-	Evictions    int // Number of cache evictions
-	Hits         int // Number of cache hits
-	Misses       int // Number of cache misses
+	shards     []*shard
+	options    Options
+	namespace  string          // Namespace the records of the cache are tagged with
+	aof        *aofLog         // AOF and replication hook, shared by the namespaces of a node
+	version    atomic.Uint64   // Last version handed out to a node
+	lockTokens atomic.Uint64   // Last fencing token handed out with a lock
+	memory     memoryCounter   // Memory used by the cache
+	nodeMemory *memoryCounter  // Memory used by every namespace of the node
+	events     eventHub        // Keyspace event subscriptions
+	loads      loadGroup       // Loads in flight and negative results of GetOrLoad
+	refresh    refreshPolicies // Stale-while-revalidate and refresh-ahead policies
+	// Records of the running transaction, only set while every shard is locked
+	transaction *[]string
+	stopExpiry  chan struct{}
+	closeOnce   sync.Once
+}
+
+// Options holds the tunables used when creating a Cache.
+type Options struct {
+	MaxEntries     int    // Maximum number of entries, 0 means unbounded
+	MaxBytes       int64  // Maximum total size of stored values in bytes, 0 means unbounded
+	EvictionPolicy string // Name of the eviction policy, LRU when empty
+	Shards         int    // Number of independently locked shards, DefaultShards when 0
+
+	MaxMemory       int64  // Maximum memory including keys and overhead in bytes, 0 means unbounded
+	MaxMemoryPolicy string // What to do at MaxMemory, one of MaxMemoryPolicies, noeviction when empty
+
+	CompressionThreshold int64 // Size in bytes from which strings are stored compressed, 0 never compresses
+
+	Encryption          *Keyring // Keys the AOF is sealed with, nil writes it in plaintext
+	EncryptPlaintextAOF bool     // Replays an AOF holding only plaintext records despite Encryption, and rewrites it sealed
+
+	MaxNamespaces int // Maximum number of namespaces including the default one, 0 means unbounded
+
+	MaxSketchBytes int64 // Largest memory of a single sketch in bytes, DefaultMaxSketchBytes when 0, unbounded when negative
+}
+
+// Stats is a point-in-time snapshot of the cache statistics, summed over all shards.
+type Stats struct {
+	Size        int64 `json:"size"`        // Number of entries
+	UsedBytes   int64 `json:"used_bytes"`  // Total size of stored values in bytes
+	Hits        int64 `json:"hits"`        // Number of cache hits
+	Misses      int64 `json:"misses"`      // Number of cache misses
+	Evictions   int64 `json:"evictions"`   // Number of entries evicted to respect the limits
+	Expirations int64 `json:"expirations"` // Number of keys removed because their TTL passed
+	UsedMemory  int64 `json:"used_memory"` // Memory of keys, values and overhead in bytes
+	PeakMemory  int64 `json:"peak_memory"` // Highest UsedMemory so far
+
+	CompressedKeys    int64   `json:"compressed_keys"`    // Number of strings stored compressed
+	CompressedBytes   int64   `json:"compressed_bytes"`   // Stored size of the compressed strings
+	UncompressedBytes int64   `json:"uncompressed_bytes"` // Size of the compressed strings once decompressed
+	CompressionRatio  float64 `json:"compression_ratio"`  // UncompressedBytes over CompressedBytes, 1 when nothing is compressed
 }
 
 type Queue struct {
@@ -27,17 +68,67 @@ type Queue struct {
 }
 
 type Node struct {
-	Data interface{}
-	prev *Node
-	Next *Node
+	Key         string
+	Data        interface{}
+	prev        *Node
+	Next        *Node
+	size        int64     // Accounted size of Data in bytes
+	expiresAt   time.Time // Absolute deadline, zero when the key never expires
+	expiryIndex int       // Position in the expiry heap, -1 when not scheduled
+	version     uint64    // CAS token, replaced by every write to the key
+	memory      int64     // Accounted memory of the key, value and overhead in bytes
+	accessedAt  int64     // Unix nanoseconds of the last access, for the maxmemory LRU policies
+	updatedAt   int64     // Unix nanoseconds of the last change of Data, for the refresh policies
+	codec       codec     // Encoding of a string's Data
+	rawSize     int64     // Size of a compressed string once decompressed
+	tags        []string  // Tags the string was set with, never modified in place
 }
 
-// NewCache creates a new Cache with an empty map and Queue.
+// NewCache creates a new unbounded LRU Cache.
 func NewCache() *Cache {
-	return &Cache{
-		CacheMap: make(map[string]*Node),
-		Queue:    NewQueue(),
-		mutex:    sync.Mutex{},
+	return NewCacheWithOptions(Options{})
+}
+
+// NewCacheWithOptions creates a new Cache bounded by the given options. The
+// limits are split evenly across the shards. An unknown eviction policy falls
+// back to LRU.
+func NewCacheWithOptions(opts Options) *Cache {
+	return newCache(opts, DefaultNamespace, &aofLog{keys: opts.Encryption, migrate: opts.EncryptPlaintextAOF}, &memoryCounter{})
+}
+
+// newCache creates the cache of a namespace, writing its records to aof and
+// accounting its memory to nodeMemory as well.
+func newCache(opts Options, namespace string, aof *aofLog, nodeMemory *memoryCounter) *Cache {
+	if opts.Shards <= 0 {
+		opts.Shards = DefaultShards
+	}
+	// Scan cursors leave room for this many shard indexes
+	opts.Shards = min(opts.Shards, maxShards)
+
+	c := &Cache{
+		options:    opts,
+		namespace:  namespace,
+		aof:        aof,
+		nodeMemory: nodeMemory,
+		stopExpiry: make(chan struct{}),
+	}
+	c.shards = make([]*shard, opts.Shards)
+	for i := range c.shards {
+		c.shards[i] = newShard(c, opts, opts.Shards)
+	}
+	go c.runActiveExpiry()
+
+	return c
+}
+
+// newNode creates a node that is not yet tracked by the policy or the expiry heap.
+func newNode(key string, data interface{}) *Node {
+	return &Node{
+		Key:         key,
+		Data:        data,
+		size:        valueSize(data),
+		expiryIndex: -1,
+		updatedAt:   time.Now().UnixNano(),
 	}
 }
 
@@ -47,44 +138,49 @@ func NewQueue() *Queue {
 }
 
 func (c *Cache) PrintCache() {
+	c.lockAll()
+	defer c.unlockAll()
+
 	fmt.Println()
 	fmt.Println("╔═════════════════════════════╗")
 	fmt.Println("║        Cache Contents       ║")
 	fmt.Println("╚═════════════════════════════╝")
 
-	// Print hash map entries
-	for key, node := range c.CacheMap {
-		fmt.Printf("  %s │ Value: %s │ Queue Position: ", key, node.Data)
-
-		// Find the position of the node in the queue
-		position := 1
-		currentNode := c.Queue.Head
-		for currentNode != nil {
-			if currentNode == node {
-				break
-			}
-			currentNode = currentNode.Next
-			position++
+	for i, s := range c.shards {
+		// Position of every key in the shard's eviction order, kept longest first
+		order := s.policy.Keys()
+		positions := make(map[string]int, len(order))
+		for i, key := range order {
+			positions[key] = i + 1
 		}
 
-		fmt.Println(position)
+		// Print hash map entries
+		for key, node := range s.items {
+			fmt.Printf("  %s │ Value: %s │ Shard: %d │ Queue Position: %d\n", key, node.displayValue(), i, positions[key])
+		}
 	}
 
 	fmt.Println("╔═════════════════════════════╗")
 	fmt.Println("║        Queue Order          ║")
 	fmt.Println("╚═════════════════════════════╝")
 
-	// Print linked list (queue) entries
-	currentNode := c.Queue.Head
-	for currentNode != nil {
-		fmt.Printf("  %s -> ", currentNode.Data)
-		currentNode = currentNode.Next
+	// Print entries of every shard in eviction order
+	for i, s := range c.shards {
+		if len(s.items) == 0 {
+			continue
+		}
+		fmt.Printf("  [%d] ", i)
+		for _, key := range s.policy.Keys() {
+			fmt.Printf("%s -> ", s.items[key].displayValue())
+		}
+		fmt.Println("nil")
 	}
-	fmt.Println("nil\n╚═════════════════════════════╝")
+	fmt.Println("╚═════════════════════════════╝")
 }
 
 // AddToFront adds a new node to the front of the Queue.
 func (q *Queue) AddToFront(node *Node) {
+	node.prev = nil
 	node.Next = q.Head
 	if q.Head != nil {
 		q.Head.prev = node
@@ -148,137 +244,308 @@ func (q *Queue) RemoveFromEnd() *Node {
 
 func (c *Cache) Get(key string) ([]byte, error) {
 	println(GreenColor+"Getting Cache for Key: ", key, ResetColor)
-	node, exists := c.CacheMap[key]
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.get(key)
+}
+
+// get returns the string stored under key. The caller must hold s.mutex.
+func (s *shard) get(key string) ([]byte, error) {
+	value, _, err := s.getWithVersion(key)
+	return value, err
+}
+
+// getWithVersion returns the string stored under key together with its
+// version, recording the read like get. The caller must hold s.mutex.
+func (s *shard) getWithVersion(key string) ([]byte, uint64, error) {
+	node, exists := s.lookup(key)
 	if !exists {
 		fmt.Println(RedColor+"Key: ", key, " not found."+ResetColor)
-		c.Misses++ // Increment misses count
-		return nil, errors.New("key not found")
+		s.stats.misses.Add(1) // Increment misses count
+		return nil, 0, ErrNotFound
+	}
+	value, err := node.stringValue()
+	if err != nil {
+		return nil, 0, err
 	}
-	c.Hits++ // Increment hits count
+	s.stats.hits.Add(1) // Increment hits count
+
+	// Let the eviction policy record the access
+	s.touch(node)
 
-	// Move the accessed node to the front of the Queue
-	c.Queue.MoveToFront(node)
+	// Revalidate the value in the background once it is stale or about to be
+	s.cache.refreshIfStale(node)
 
-	return node.Data.([]byte), nil
+	return value, node.version, nil
 }
 
+// Set stores a value under key. A positive duration makes the key expire after
+// that long; zero or negative durations keep it until deleted or evicted.
+// Overwriting a key replaces its previous expiry.
 func (c *Cache) Set(key string, value []byte, duration time.Duration) error {
+	_, err := c.set(key, value, duration, nil, nil)
+	return err
+}
+
+// set stores a value under key with the given tags and returns its new
+// version. When expectedVersion is not nil, the key must still be at that version.
+func (c *Cache) set(key string, value []byte, duration time.Duration, expectedVersion *uint64, tags []string) (uint64, error) {
 	println(GreenColor+"Setting cache> Key: ", key, " Value: ", string(value), ResetColor)
-	node, exists := c.CacheMap[key]
-	c.mutex.Lock()
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.set(key, value, duration, expectedVersion, tags)
+}
+
+// set stores a value under key like Cache.set, compressed when it is large
+// enough. Keys under a refresh policy expire at its hard TTL whatever the
+// duration. The caller must hold s.mutex.
+func (s *shard) set(key string, value []byte, duration time.Duration, expectedVersion *uint64, tags []string) (uint64, error) {
+	duration = s.cache.refresh.ttlFor(key, duration)
+	return s.setUntil(key, value, deadlineAfter(duration), expectedVersion, tags)
+}
+
+// setUntil stores a value under key like set, expiring at deadline unless it
+// is zero. The caller must hold s.mutex.
+func (s *shard) setUntil(key string, value []byte, deadline time.Time, expectedVersion *uint64, tags []string) (uint64, error) {
+	enc, data := s.cache.compress(value)
+	return s.store(key, enc, data, int64(len(value)), deadline, expectedVersion, tags)
+}
+
+// deadlineAfter returns the deadline of a TTL starting now, or the zero time
+// for durations that are not positive.
+func deadlineAfter(duration time.Duration) time.Time {
+	if duration <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(duration)
+}
+
+// store stores data encoded with enc under key, rawSize being the size of the
+// value it holds, replacing the tags of the key. The capacity limits apply to
+// the stored size. A deadline that has already passed, as in a record
+// replayed late, leaves the key expired. The caller must hold s.mutex.
+func (s *shard) store(key string, enc codec, data []byte, rawSize int64, deadline time.Time, expectedVersion *uint64, tags []string) (uint64, error) {
+	if s.maxBytes > 0 && int64(len(data)) > s.maxBytes {
+		return 0, fmt.Errorf("%w: value of %d bytes exceeds shard capacity of %d bytes", ErrFull, len(data), s.maxBytes)
+	}
+
+	node, exists := s.lookup(key)
+	if expectedVersion != nil {
+		var actual uint64
+		if exists {
+			actual = node.version
+		}
+		if actual != *expectedVersion {
+			return 0, &ConflictError{Key: key, Expected: *expectedVersion, Actual: actual}
+		}
+	}
+	if !deadline.IsZero() && !deadline.After(time.Now()) {
+		if exists {
+			s.expireNode(node)
+		}
+		return 0, nil
+	}
+
+	var current int64
+	if exists {
+		current = node.memory
+	}
+	if err := s.reserveMemory(entryMemory(key, int64(len(data)), 0) - current); err != nil {
+		return 0, err
+	}
+	// Making room may have evicted the key itself
+	node, exists = s.items[key]
+
 	if exists {
-		// Update existing node
-		node.Data = value
-		c.Queue.MoveToFront(node)
+		// Update existing node, replacing whatever type it held
+		s.replaceData(node, data)
+		s.touch(node)
 	} else {
 		// Add new node
-		newNode := &Node{
-			Data: value,
-			Next: c.Queue.Head,
-			prev: nil,
-		}
-		c.CacheMap[key] = newNode
-		c.Queue.AddToFront(newNode)
-		if !c.replayingAOF {
-			c.writeToAOF("SET", key, value, duration)
-		}
-		// Increment cache size
-		c.Size++
+		node = newNode(key, data)
+		s.insert(node)
 	}
-	c.mutex.Unlock()
+	s.setCodec(node, enc, rawSize)
+	s.setTags(node, tags)
 
-	go func() {
-		<-time.After(duration)
-		err := c.Delete(key)
-		if err != nil {
-			println("\n"+RedColor+"Error evicting cache with key: ", key, ResetColor)
-			return
-		}
-	}()
+	s.scheduleExpiry(node, deadline)
+	s.cache.writeNodeRecord(node, storedRecord(key, enc, data, deadline, node.tags)...)
+	version := node.version
 
-	return nil
+	s.evictOverflow()
+
+	return version, nil
 }
 
 func (c *Cache) Has(key string) bool {
-	_, exists := c.CacheMap[key]
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, exists := s.lookup(key)
 	return exists
 }
 
 func (c *Cache) Delete(key string) error {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-
-	node, exists := c.CacheMap[key]
-	if !exists {
-		return errors.New("key not found")
-	}
+	return c.remove(key, EventDel, string(CMDDel), string(CMDDel), key)
+}
 
-	c.Queue.RemoveNode(node)
-	delete(c.CacheMap, key)
+// remove deletes a key, writes the given record and notifies the subscribers
+// with op and reason.
+func (c *Cache) remove(key string, op string, reason string, record ...string) error {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	c.writeToAOF("DELETE", key, nil, 0)
+	return s.remove(key, op, reason, record...)
+}
 
-	// Decrement cache size
-	c.Size--
+// remove deletes a key like Cache.remove. The caller must hold s.mutex.
+func (s *shard) remove(key string, op string, reason string, record ...string) error {
+	node, exists := s.lookup(key)
+	if !exists {
+		return ErrNotFound
+	}
 
-	// Increment evictions count
-	c.Evictions++
+	s.removeNode(node)
+	switch op {
+	case EventEvicted:
+		s.stats.evictions.Add(1)
+	case EventExpired:
+		s.stats.expirations.Add(1)
+	}
+	s.cache.writeToAOF(record...)
+	s.cache.notify(op, reason, key)
 
 	return nil
 }
 
-// ResetCache resets the cache by clearing the map and Queue.
+// ResetCache resets the cache by clearing every shard and the statistics.
 func (c *Cache) ResetCache() error {
-	c.CacheMap = make(map[string]*Node)
-	c.Queue = NewQueue()
+	c.lockAll()
+	defer c.unlockAll()
 
-	c.writeToAOF("FLUSHALL", "", nil, 0)
+	c.flush()
+	return nil
+}
 
-	// Reset cache statistics
-	c.Size = 0
-	c.Evictions = 0
-	c.Hits = 0
-	c.Misses = 0
+// flush clears every shard and the statistics. The caller must hold every
+// shard lock.
+func (c *Cache) flush() {
+	for _, s := range c.shards {
+		s.reset()
+
+		// Reset cache statistics
+		s.stats.hits.Store(0)
+		s.stats.misses.Store(0)
+		s.stats.evictions.Store(0)
+		s.stats.expirations.Store(0)
+	}
 
-	return nil
+	c.writeToAOF(string(CMDFlushAll))
+	c.notify(EventFlush, string(CMDFlushAll), "")
 }
 
+// IsFull reports whether any shard has reached its entry or byte limit, so
+// that the next write to it would evict.
 func (c *Cache) IsFull() bool {
-	// TODO: Implement logic to check if the cache is full
+	for _, s := range c.shards {
+		if s.atLimits() {
+			return true
+		}
+	}
 	return false
 }
 
 func (c *Cache) IsEmpty() bool {
-	return len(c.CacheMap) == 0
+	return c.Stats().Size == 0
+}
+
+// Stats returns a snapshot of the cache statistics without taking any lock.
+func (c *Cache) Stats() Stats {
+	var stats Stats
+	for _, s := range c.shards {
+		stats.Size += s.stats.size.Load()
+		stats.UsedBytes += s.stats.usedBytes.Load()
+		stats.Hits += s.stats.hits.Load()
+		stats.Misses += s.stats.misses.Load()
+		stats.Evictions += s.stats.evictions.Load()
+		stats.Expirations += s.stats.expirations.Load()
+		stats.CompressedKeys += s.stats.compressedKeys.Load()
+		stats.CompressedBytes += s.stats.compressedBytes.Load()
+		stats.UncompressedBytes += s.stats.uncompressedBytes.Load()
+	}
+	stats.UsedMemory = c.memory.used.Load()
+	stats.PeakMemory = c.memory.peak.Load()
+	stats.CompressionRatio = 1
+	if stats.CompressedBytes > 0 {
+		stats.CompressionRatio = float64(stats.UncompressedBytes) / float64(stats.CompressedBytes)
+	}
+	return stats
 }
 
-// GetCacheData returns the current cache data as a map.
+// Options returns the options the cache was created with.
+func (c *Cache) Options() Options {
+	return c.options
+}
+
+// GetCacheData returns the current string entries of the cache as a map, decompressed.
 func (c *Cache) GetCacheData() map[string][]byte {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	c.lockAll()
+	defer c.unlockAll()
 
 	cacheData := make(map[string][]byte)
-	for key, node := range c.CacheMap {
-		cacheData[key] = node.Data.([]byte)
+	for _, s := range c.shards {
+		for key, node := range s.items {
+			if value, err := node.stringValue(); err == nil {
+				cacheData[key] = value
+			}
+		}
 	}
 	return cacheData
 }
 
 // SetCacheData sets the cache data using the provided map.
 func (c *Cache) SetCacheData(cacheData map[string][]byte) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-
-	c.CacheMap = make(map[string]*Node)
-	c.Queue = NewQueue()
+	c.lockAll()
+	defer c.unlockAll()
 
+	for _, s := range c.shards {
+		s.reset()
+	}
 	for key, value := range cacheData {
-		newNode := &Node{
-			Data: value,
-			Next: c.Queue.Head,
-			prev: nil,
-		}
-		c.CacheMap[key] = newNode
-		c.Queue.AddToFront(newNode)
+		s := c.shardFor(key)
+		enc, data := c.compress(value)
+		node := newNode(key, data)
+		node.version = c.nextVersion()
+		s.insert(node)
+		s.setCodec(node, enc, int64(len(value)))
+		s.evictOverflow()
+	}
+}
+
+// EvictionPolicy returns the name of the cache's eviction policy.
+func (c *Cache) EvictionPolicy() string {
+	return c.shards[0].policy.Name()
+}
+
+// MaxMemoryPolicy returns the name of the policy applied at the maxmemory limit.
+func (c *Cache) MaxMemoryPolicy() string {
+	return c.shards[0].maxMemoryPolicy
+}
+
+// EvictionOrder returns the cached keys shard by shard, each shard's keys in
+// eviction order with the ones kept longest first.
+func (c *Cache) EvictionOrder() []string {
+	var keys []string
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		keys = append(keys, s.policy.Keys()...)
+		s.mutex.Unlock()
 	}
+	return keys
 }
@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordWrites collects the records a cache writes, as a slave receives them.
+func recordWrites(c *Cache) func() []string {
+	var mutex sync.Mutex
+	var records []string
+	c.SetReplicationHook(func(record string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		records = append(records, record)
+	})
+	return func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), records...)
+	}
+}
+
+func sortedKeys(c *Cache) []string {
+	keys := make([]string, 0)
+	for key := range c.GetCacheData() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestLRUEviction(t *testing.T) {
+	c := NewCacheWithOptions(Options{MaxEntries: 3, Shards: 1})
+	defer c.Close()
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := c.Set(key, []byte(key), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("d", []byte("d"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Get("b"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of the least recently used key = %v, want ErrNotFound", err)
+	}
+	if keys := sortedKeys(c); !reflect.DeepEqual(keys, []string{"a", "c", "d"}) {
+		t.Fatalf("keys = %q, want a, c and d", keys)
+	}
+	if stats := c.Stats(); stats.Size != 3 || stats.Evictions != 1 {
+		t.Fatalf("size %d and evictions %d, want 3 and 1", stats.Size, stats.Evictions)
+	}
+	if !c.IsFull() {
+		t.Fatal("IsFull = false at max_entries")
+	}
+}
+
+func TestMaxBytesEviction(t *testing.T) {
+	c := NewCacheWithOptions(Options{MaxBytes: 10, Shards: 1})
+	defer c.Close()
+
+	if err := c.Set("a", []byte("123456"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("b", []byte("123456"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if keys := sortedKeys(c); !reflect.DeepEqual(keys, []string{"b"}) {
+		t.Fatalf("keys = %q, want only b", keys)
+	}
+	if err := c.Set("c", []byte("12345678901"), 0); !errors.Is(err, ErrFull) {
+		t.Fatalf("Set of a value larger than the cache = %v, want ErrFull", err)
+	}
+}
+
+func TestSlaveAppliesMasterEvictions(t *testing.T) {
+	master := NewCacheWithOptions(Options{MaxEntries: 2, Shards: 1})
+	defer master.Close()
+	records := recordWrites(master)
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := master.Set(key, []byte(key), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// An unbounded slave ends up with the keys the master kept
+	slave := NewCache()
+	defer slave.Close()
+	for _, record := range records() {
+		if err := slave.ApplyRecord(record); err != nil {
+			t.Fatalf("ApplyRecord(%q) = %v", record, err)
+		}
+	}
+	if keys, want := sortedKeys(slave), sortedKeys(master); !reflect.DeepEqual(keys, want) {
+		t.Fatalf("slave keys = %q, want the master's %q", keys, want)
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	c := NewCacheWithOptions(Options{MaxEntries: 100, Shards: 8})
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 16; worker++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			random := rand.New(rand.NewSource(seed))
+			for i := 0; i < 2000; i++ {
+				key := "key:" + strconv.Itoa(random.Intn(300))
+				var err error
+				switch random.Intn(5) {
+				case 0, 1:
+					err = c.Set(key, []byte(strconv.Itoa(i)), 0)
+				case 2:
+					err = c.Set(key, []byte(strconv.Itoa(i)), time.Duration(1+random.Intn(5))*time.Millisecond)
+				case 3:
+					_, err = c.Get(key)
+				case 4:
+					err = c.Delete(key)
+				}
+				if err != nil && !errors.Is(err, ErrNotFound) {
+					t.Error(err)
+					return
+				}
+			}
+		}(int64(worker))
+	}
+	wg.Wait()
+
+	waitFor(t, "the keys with a TTL to expire", func() bool {
+		for key := range c.GetCacheData() {
+			if ttl, err := c.TTL(key); err == nil && ttl != NoExpiry {
+				return false
+			}
+		}
+		return true
+	})
+
+	// Each of the 8 shards keeps at most its share of 100 entries, rounded up
+	stats := c.Stats()
+	if stats.Size > 8*13 {
+		t.Fatalf("size %d over the limits of the shards", stats.Size)
+	}
+	if stats.Evictions == 0 {
+		t.Fatal("no eviction with 300 keys for 100 entries")
+	}
+	if keys := len(c.EvictionOrder()); int64(keys) != stats.Size {
+		t.Fatalf("%d keys tracked by the eviction policies, want the size %d", keys, stats.Size)
+	}
+}
@@ -1,13 +1,212 @@
 package cache
 
-import "time"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
+// The errors of the cache are reported as, or wrap, a few sentinels callers
+// can test with errors.Is whatever the details of the error: ErrNotFound,
+// ErrWrongType, ErrFull and ErrConflict. RemoteCache turns the statuses of the
+// HTTP API back into the same sentinels.
+
+var (
+	// ErrNotFound is returned for keys that do not exist.
+	ErrNotFound = errors.New("key not found")
+
+	// ErrFull is matched by the errors of writes refused because the cache
+	// has no room left, such as ErrOutOfMemory.
+	ErrFull = errors.New("cache is full")
+
+	// ErrConflict is matched by the *ConflictError of writes whose expected
+	// version no longer matches the key.
+	ErrConflict = errors.New("version conflict")
+)
+
+// fullError is an error of a write refused for lack of room, matching ErrFull.
+type fullError string
+
+func (e fullError) Error() string {
+	return string(e)
+}
+
+func (e fullError) Is(target error) bool {
+	return target == ErrFull
+}
+
+// Cacher is the interface of caches without contexts. New code should use
+// CacherV2; WithoutContext adapts a CacherV2 to it.
 type Cacher interface {
 	Get(string) ([]byte, error)
 	Set(string, []byte, time.Duration) error
+	CompareAndSwap(string, uint64, []byte, time.Duration) (uint64, error)
 	Has(string) bool
 	Delete(string) error
 	ResetCache() error
 	IsFull() bool
 	IsEmpty() bool
 }
+
+// CacherV2 is the interface of caches taking a context on every method, which
+// bounds the calls that go over the network. Unlike Cacher, Has, IsFull and
+// IsEmpty report the errors that kept them from answering. RemoteCache
+// implements it, and WithContext adapts a Cacher such as Cache to it.
+type CacherV2 interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, duration time.Duration) error
+	CompareAndSwap(ctx context.Context, key string, expectedVersion uint64, value []byte, duration time.Duration) (uint64, error)
+	Has(ctx context.Context, key string) (bool, error)
+	Delete(ctx context.Context, key string) error
+	ResetCache(ctx context.Context) error
+	IsFull(ctx context.Context) (bool, error)
+	IsEmpty(ctx context.Context) (bool, error)
+}
+
+// WithContext adapts a Cacher to CacherV2. The calls of the Cacher cannot be
+// interrupted, so the context is only checked before each of them.
+func WithContext(c Cacher) CacherV2 {
+	if legacy, ok := c.(withoutContext); ok {
+		return legacy.v2
+	}
+	return withContext{c}
+}
+
+type withContext struct {
+	v1 Cacher
+}
+
+func (w withContext) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return w.v1.Get(key)
+}
+
+func (w withContext) Set(ctx context.Context, key string, value []byte, duration time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return w.v1.Set(key, value, duration)
+}
+
+func (w withContext) CompareAndSwap(ctx context.Context, key string, expectedVersion uint64, value []byte, duration time.Duration) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.v1.CompareAndSwap(key, expectedVersion, value, duration)
+}
+
+func (w withContext) Has(ctx context.Context, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return w.v1.Has(key), nil
+}
+
+func (w withContext) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return w.v1.Delete(key)
+}
+
+func (w withContext) ResetCache(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return w.v1.ResetCache()
+}
+
+func (w withContext) IsFull(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return w.v1.IsFull(), nil
+}
+
+func (w withContext) IsEmpty(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return w.v1.IsEmpty(), nil
+}
+
+// WithoutContext adapts a CacherV2 to Cacher, so code written against Cacher,
+// such as Typed, keeps working. Calls run with context.Background(), and Has,
+// IsFull and IsEmpty report false when they fail. The batch operations of
+// RemoteCache are kept.
+func WithoutContext(c CacherV2) Cacher {
+	if adapted, ok := c.(withContext); ok {
+		return adapted.v1
+	}
+	return withoutContext{c}
+}
+
+type withoutContext struct {
+	v2 CacherV2
+}
+
+func (w withoutContext) Get(key string) ([]byte, error) {
+	return w.v2.Get(context.Background(), key)
+}
+
+func (w withoutContext) Set(key string, value []byte, duration time.Duration) error {
+	return w.v2.Set(context.Background(), key, value, duration)
+}
+
+func (w withoutContext) CompareAndSwap(key string, expectedVersion uint64, value []byte, duration time.Duration) (uint64, error) {
+	return w.v2.CompareAndSwap(context.Background(), key, expectedVersion, value, duration)
+}
+
+func (w withoutContext) Has(key string) bool {
+	exists, err := w.v2.Has(context.Background(), key)
+	return err == nil && exists
+}
+
+func (w withoutContext) Delete(key string) error {
+	return w.v2.Delete(context.Background(), key)
+}
+
+func (w withoutContext) ResetCache() error {
+	return w.v2.ResetCache(context.Background())
+}
+
+func (w withoutContext) IsFull() bool {
+	full, err := w.v2.IsFull(context.Background())
+	return err == nil && full
+}
+
+func (w withoutContext) IsEmpty() bool {
+	empty, err := w.v2.IsEmpty(context.Background())
+	return err == nil && empty
+}
+
+// contextBatcher is implemented by the CacherV2 backends that read and write
+// many keys in a single operation.
+type contextBatcher interface {
+	getMany(ctx context.Context, keys []string) (map[string][]byte, error)
+	setMany(ctx context.Context, values map[string][]byte, duration time.Duration) (map[string]error, error)
+	deleteMany(ctx context.Context, keys []string) (map[string]bool, error)
+}
+
+func (w withoutContext) getMany(keys []string) (map[string][]byte, error) {
+	if batch, ok := w.v2.(contextBatcher); ok {
+		return batch.getMany(context.Background(), keys)
+	}
+	return keyByKey{w}.getMany(keys)
+}
+
+func (w withoutContext) setMany(values map[string][]byte, duration time.Duration) (map[string]error, error) {
+	if batch, ok := w.v2.(contextBatcher); ok {
+		return batch.setMany(context.Background(), values, duration)
+	}
+	return keyByKey{w}.setMany(values, duration)
+}
+
+func (w withoutContext) deleteMany(keys []string) (map[string]bool, error) {
+	if batch, ok := w.v2.(contextBatcher); ok {
+		return batch.deleteMany(context.Background(), keys)
+	}
+	return keyByKey{w}.deleteMany(keys)
+}
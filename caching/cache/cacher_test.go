@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCacherAdapters(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	v2 := WithContext(c)
+	if err := v2.Set(context.Background(), "key", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := v2.Has(context.Background(), "key"); err != nil || !exists {
+		t.Fatalf("Has = %v, %v, want true", exists, err)
+	}
+	if _, err := v2.Get(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a missing key = %v, want ErrNotFound", err)
+	}
+
+	// Calls are not made once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := v2.Delete(ctx, "key"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Delete with a canceled context = %v, want context.Canceled", err)
+	}
+	if !c.Has("key") {
+		t.Fatal("Delete ran with a canceled context")
+	}
+
+	// Adapting back returns the original cache
+	if back := WithoutContext(v2); back != Cacher(c) {
+		t.Fatalf("WithoutContext(WithContext(c)) = %T, want c itself", back)
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	c := NewCacheWithOptions(Options{Shards: 1, MaxMemory: 1})
+	defer c.Close()
+
+	if _, err := c.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get = %v, want ErrNotFound", err)
+	}
+	if err := c.Set("key", []byte("v"), 0); !errors.Is(err, ErrFull) {
+		t.Fatalf("Set on a full cache = %v, want ErrFull", err)
+	}
+	if _, err := c.CompareAndSwap("key", 7, []byte("v"), 0); !errors.Is(err, ErrConflict) {
+		t.Fatalf("CompareAndSwap of a missing key = %v, want ErrConflict", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -28,8 +29,73 @@ const (
 	CMDDel      Command = "DEL"
 	CMDFlushAll Command = "FLUSHALL"
 	CMDShowAll  Command = "SHOWALL"
+	CMDScan     Command = "SCAN"
+	CMDMGet     Command = "MGET"
+	CMDMSet     Command = "MSET"
+	CMDMDel     Command = "MDEL"
 	CMDExit     Command = "EXIT"
 	CMDHelp     Command = "HELP"
+
+	CMDIncr        Command = "INCR"
+	CMDDecr        Command = "DECR"
+	CMDIncrBy      Command = "INCRBY"
+	CMDIncrByFloat Command = "INCRBYFLOAT"
+
+	CMDTTL       Command = "TTL"
+	CMDPTTL      Command = "PTTL"
+	CMDExpire    Command = "EXPIRE"
+	CMDExpireAt  Command = "EXPIREAT"
+	CMDPExpireAt Command = "PEXPIREAT" // Written to the AOF by EXPIRE and EXPIREAT
+	CMDPersist   Command = "PERSIST"
+
+	CMDMulti   Command = "MULTI"
+	CMDExec    Command = "EXEC" // Also the AOF record holding the writes of a transaction
+	CMDDiscard Command = "DISCARD"
+	CMDWatch   Command = "WATCH"
+
+	CMDPublish    Command = "PUBLISH" // Replicated to the slaves but never written to the AOF
+	CMDSubscribe  Command = "SUBSCRIBE"
+	CMDPSubscribe Command = "PSUBSCRIBE"
+
+	CMDInvalidateTag Command = "INVALIDATETAG" // Also the AOF record deleting the keys of a tag
+
+	CMDType          Command = "TYPE"
+	CMDHSet          Command = "HSET"
+	CMDHGet          Command = "HGET"
+	CMDHGetAll       Command = "HGETALL"
+	CMDLPush         Command = "LPUSH"
+	CMDRPop          Command = "RPOP"
+	CMDLRange        Command = "LRANGE"
+	CMDSAdd          Command = "SADD"
+	CMDSIsMember     Command = "SISMEMBER"
+	CMDSInter        Command = "SINTER"
+	CMDZAdd          Command = "ZADD"
+	CMDZRangeByScore Command = "ZRANGEBYSCORE"
+
+	CMDXAdd       Command = "XADD"
+	CMDXLen       Command = "XLEN"
+	CMDXRange     Command = "XRANGE"
+	CMDXRead      Command = "XREAD"
+	CMDXTrim      Command = "XTRIM"
+	CMDXGroup     Command = "XGROUP"
+	CMDXReadGroup Command = "XREADGROUP"
+	CMDXAck       Command = "XACK"
+	CMDXPending   Command = "XPENDING"
+
+	CMDBFReserve     Command = "BF.RESERVE"
+	CMDBFAdd         Command = "BF.ADD"
+	CMDBFExists      Command = "BF.EXISTS"
+	CMDPFAdd         Command = "PFADD"
+	CMDPFCount       Command = "PFCOUNT"
+	CMDPFMerge       Command = "PFMERGE"
+	CMDCMSInitByDim  Command = "CMS.INITBYDIM"
+	CMDCMSInitByProb Command = "CMS.INITBYPROB"
+	CMDCMSIncrBy     Command = "CMS.INCRBY"
+	CMDCMSQuery      Command = "CMS.QUERY"
+
+	CMDLock      Command = "LOCK" // Also the AOF record of an acquired or renewed lock
+	CMDRenewLock Command = "RENEWLOCK"
+	CMDUnlock    Command = "UNLOCK" // Also the AOF record of a released lock
 )
 
 // MessageSet represents a SET command message
@@ -60,6 +126,10 @@ func HandleCli() {
 			continue
 		}
 
+		if queueTransactionCommand(parts) {
+			continue
+		}
+
 		switch strings.ToUpper(parts[0]) {
 		case string(CMDSet):
 			handleSetCommand(parts[1:])
@@ -67,15 +137,47 @@ func HandleCli() {
 		case string(CMDGet):
 			handleGetCommand(parts[1:])
 
+		case string(CMDIncr), string(CMDDecr), string(CMDIncrBy), string(CMDIncrByFloat):
+			handleCounterCommand(Command(strings.ToUpper(parts[0])), parts[1:])
+
+		case string(CMDTTL), string(CMDPTTL), string(CMDExpire), string(CMDExpireAt), string(CMDPersist):
+			handleExpiryCommand(Command(strings.ToUpper(parts[0])), parts[1:])
+
+		case string(CMDMulti), string(CMDExec), string(CMDDiscard), string(CMDWatch):
+			handleTransactionCommand(Command(strings.ToUpper(parts[0])), parts[1:])
+
+		case string(CMDPublish), string(CMDSubscribe), string(CMDPSubscribe):
+			handlePubSubCommand(Command(strings.ToUpper(parts[0])), parts[1:])
+
 		case string(CMDDel):
 			handleDeleteCommand(parts[1:])
 
+		case string(CMDMGet), string(CMDMSet), string(CMDMDel):
+			handleBatchCommand(Command(strings.ToUpper(parts[0])), parts[1:])
+
+		case string(CMDInvalidateTag):
+			handleInvalidateTagCommand(parts[1:])
+
+		case string(CMDXAdd), string(CMDXLen), string(CMDXRange), string(CMDXRead), string(CMDXTrim),
+			string(CMDXGroup), string(CMDXReadGroup), string(CMDXAck), string(CMDXPending):
+			handleStreamCommand(Command(strings.ToUpper(parts[0])), parts[1:])
+
+		case string(CMDBFReserve), string(CMDBFAdd), string(CMDBFExists), string(CMDPFAdd), string(CMDPFCount), string(CMDPFMerge),
+			string(CMDCMSInitByDim), string(CMDCMSInitByProb), string(CMDCMSIncrBy), string(CMDCMSQuery):
+			handleSketchCommand(Command(strings.ToUpper(parts[0])), parts[1:])
+
+		case string(CMDLock), string(CMDRenewLock), string(CMDUnlock):
+			handleLockCommand(Command(strings.ToUpper(parts[0])), parts[1:])
+
 		case string(CMDFlushAll):
 			handleFlushAllCommand()
 
 		case string(CMDShowAll):
 			handleShowAllCommand()
 
+		case string(CMDScan):
+			handleScanCommand(parts[1:])
+
 		case string(CMDExit):
 			fmt.Println("Exiting the application.")
 			os.Exit(0)
@@ -84,7 +186,9 @@ func HandleCli() {
 			displayCommandGuide()
 
 		default:
-			fmt.Println(RedColor + "Error: Invalid command. Type 'help' for command guide." + ResetColor)
+			if !handleTypeCommand(strings.ToUpper(parts[0]), parts[1:]) {
+				fmt.Println(RedColor + "Error: Invalid command. Type 'help' for command guide." + ResetColor)
+			}
 		}
 	}
 }
@@ -169,6 +273,136 @@ func handleGetCommand(args []string) {
 	}
 }
 
+// handleCounterCommand sends INCR, DECR, INCRBY and INCRBYFLOAT to the master.
+func handleCounterCommand(command Command, args []string) {
+	switch command {
+	case CMDIncr, CMDDecr:
+		if !checkArgs(args, len(args) == 1, string(command)+" <key>") {
+			return
+		}
+		path := "/cache/incr"
+		if command == CMDDecr {
+			path = "/cache/decr"
+		}
+		printResponse(sendJSONRequest(path, map[string]interface{}{"key": args[0]}))
+
+	case CMDIncrBy:
+		if !checkArgs(args, len(args) == 2, "INCRBY <key> <increment>") {
+			return
+		}
+		by, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			fmt.Println(RedColor + "Error: Increment must be an integer." + ResetColor)
+			return
+		}
+		printResponse(sendJSONRequest("/cache/incr", map[string]interface{}{"key": args[0], "by": by}))
+
+	case CMDIncrByFloat:
+		if !checkArgs(args, len(args) == 2, "INCRBYFLOAT <key> <increment>") {
+			return
+		}
+		by, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			fmt.Println(RedColor + "Error: Increment must be a number." + ResetColor)
+			return
+		}
+		printResponse(sendJSONRequest("/cache/incrbyfloat", map[string]interface{}{"key": args[0], "by": by}))
+	}
+}
+
+// handleExpiryCommand reads the TTL of a key from a slave, or changes its expiry on the master.
+func handleExpiryCommand(command Command, args []string) {
+	switch command {
+	case CMDTTL, CMDPTTL:
+		if checkArgs(args, len(args) == 1, string(command)+" <key>") {
+			path := "/cache/ttl"
+			if command == CMDPTTL {
+				path = "/cache/pttl"
+			}
+			printResponse(sendQueryRequest(path, url.Values{"key": {args[0]}}))
+		}
+
+	case CMDExpire:
+		if checkArgs(args, len(args) == 2, "EXPIRE <key> <seconds>") {
+			seconds, err := strconv.Atoi(args[1])
+			if err != nil {
+				fmt.Println(RedColor + "Error: Seconds must be an integer." + ResetColor)
+				return
+			}
+			ttl := (time.Duration(seconds) * time.Second).String()
+			printResponse(sendJSONRequest("/cache/expire", map[string]interface{}{"key": args[0], "ttl": ttl}))
+		}
+
+	case CMDExpireAt:
+		if checkArgs(args, len(args) == 2, "EXPIREAT <key> <unix-seconds>") {
+			timestamp, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				fmt.Println(RedColor + "Error: Timestamp must be an integer." + ResetColor)
+				return
+			}
+			printResponse(sendJSONRequest("/cache/expireat", map[string]interface{}{"key": args[0], "timestamp": timestamp}))
+		}
+
+	case CMDPersist:
+		if checkArgs(args, len(args) == 1, "PERSIST <key>") {
+			printResponse(sendJSONRequest("/cache/persist", map[string]interface{}{"key": args[0]}))
+		}
+	}
+}
+
+// handleBatchCommand reads keys from a slave, or stores or deletes them on the
+// master, in a single request.
+func handleBatchCommand(command Command, args []string) {
+	switch command {
+	case CMDMGet:
+		if checkArgs(args, len(args) >= 1, "MGET <key> [<key> ...]") {
+			printResponse(sendQueryRequest("/cache/mget", url.Values{"key": args}))
+		}
+
+	case CMDMSet:
+		if checkArgs(args, len(args) >= 2 && len(args)%2 == 0, "MSET <key> <value> [<key> <value> ...]") {
+			values := make(map[string]string, len(args)/2)
+			for i := 0; i < len(args); i += 2 {
+				values[args[i]] = args[i+1]
+			}
+			printResponse(sendJSONRequest("/cache/mset", map[string]interface{}{"values": values}))
+		}
+
+	case CMDMDel:
+		if checkArgs(args, len(args) >= 1, "MDEL <key> [<key> ...]") {
+			printResponse(sendJSONRequest("/cache/mdel", map[string]interface{}{"keys": args}))
+		}
+	}
+}
+
+// handleInvalidateTagCommand deletes every key set with a tag on the master.
+func handleInvalidateTagCommand(args []string) {
+	if checkArgs(args, len(args) == 1, "INVALIDATETAG <tag>") {
+		printResponse(sendJSONRequest("/cache/invalidatetag", map[string]interface{}{"tag": args[0]}))
+	}
+}
+
+// handleLockCommand acquires, renews and releases locks. Leases are given in seconds.
+func handleLockCommand(command Command, args []string) {
+	switch command {
+	case CMDLock:
+		if checkArgs(args, len(args) == 2, "LOCK <name> <seconds>") {
+			printResponse(sendJSONRequest("/cache/lock", map[string]interface{}{"name": args[0], "lease": args[1] + "s"}))
+		}
+
+	case CMDRenewLock:
+		if checkArgs(args, len(args) == 3, "RENEWLOCK <name> <owner> <seconds>") {
+			request := map[string]interface{}{"name": args[0], "owner": args[1], "lease": args[2] + "s"}
+			printResponse(sendJSONRequest("/cache/renewlock", request))
+		}
+
+	case CMDUnlock:
+		if checkArgs(args, len(args) == 2, "UNLOCK <name> <owner>") {
+			printResponse(sendJSONRequest("/cache/unlock", map[string]interface{}{"name": args[0], "owner": args[1]}))
+		}
+	}
+}
+
 func handleDeleteCommand(args []string) {
 	if len(args) != 1 {
 		fmt.Println(RedColor + "Error: Invalid DEL command. Usage: DEL <key>" + ResetColor)
@@ -228,6 +462,25 @@ func handleShowAllCommand() {
 	}
 }
 
+// handleScanCommand fetches one page of a key scan: SCAN <cursor> [MATCH <pattern>] [COUNT <count>] [TYPE <type>].
+func handleScanCommand(args []string) {
+	usage := "SCAN <cursor> [MATCH <pattern>] [COUNT <count>] [TYPE <type>]"
+	if !checkArgs(args, len(args)%2 == 1, usage) {
+		return
+	}
+
+	params := url.Values{"cursor": {args[0]}}
+	for i := 1; i < len(args); i += 2 {
+		option := strings.ToLower(args[i])
+		if option != "match" && option != "count" && option != "type" {
+			checkArgs(args, false, usage)
+			return
+		}
+		params.Set(option, args[i+1])
+	}
+	printResponse(sendQueryRequest("/cache/scan", params))
+}
+
 func parseTTL(ttl string) time.Duration {
 	duration, err := strconv.Atoi(ttl)
 	if err != nil {
@@ -313,9 +566,57 @@ func displayCommandGuide() {
 	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "SET <key> <value> <TTL>")
 	fmt.Printf(" %-14s | %s\n", GreenColor+"GET"+ResetColor, "Get the value of a cache entry")
 	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "GET <key>")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"TTL"+ResetColor, "Get the remaining time to live in seconds")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "TTL <key>")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"PTTL"+ResetColor, "Get the remaining time to live in milliseconds")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "PTTL <key>")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"EXPIRE"+ResetColor, "Set the time to live of a cache entry")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "EXPIRE <key> <seconds>")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"EXPIREAT"+ResetColor, "Set the expiry time of a cache entry")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "EXPIREAT <key> <unix-seconds>")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"PERSIST"+ResetColor, "Remove the expiry of a cache entry")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "PERSIST <key>")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"INCR"+ResetColor, "Increment an integer counter by one")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "INCR <key>")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"DECR"+ResetColor, "Decrement an integer counter by one")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "DECR <key>")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"INCRBY"+ResetColor, "Add to an integer counter")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "INCRBY <key> <increment>")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"INCRBYFLOAT"+ResetColor, "Add to a floating point counter")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "INCRBYFLOAT <key> <increment>")
 	fmt.Printf(" %-14s | %s\n", GreenColor+"DEL"+ResetColor, "Delete a cache entry")
 	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "DEL <key>")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"MGET"+ResetColor, "Get the values of several cache entries")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "MGET <key> [<key> ...]")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"MSET"+ResetColor, "Set several cache entries atomically")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "MSET <key> <value> [<key> <value> ...]")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"MDEL"+ResetColor, "Delete several cache entries atomically")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "MDEL <key> [<key> ...]")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"INVALIDATETAG"+ResetColor, "Delete every cache entry set with a tag")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "INVALIDATETAG <tag>")
 	fmt.Printf(" %-14s | %s\n", GreenColor+"FLUSHALL"+ResetColor, "Flush all cache entries")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"SCAN"+ResetColor, "Iterate over the keys page by page, starting at cursor 0")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "SCAN <cursor> [MATCH <pattern>] [COUNT <count>] [TYPE <type>]")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"WATCH"+ResetColor, "Make the next EXEC abort if any of the keys changes")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "WATCH <key> [<key> ...]")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"MULTI"+ResetColor, "Queue the following commands in a transaction")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"EXEC"+ResetColor, "Run the queued commands atomically")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"DISCARD"+ResetColor, "Drop the queued commands")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"PUBLISH"+ResetColor, "Publish a message on a channel")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "PUBLISH <channel> <message>")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"SUBSCRIBE"+ResetColor, "Print the messages of channels until interrupted")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "SUBSCRIBE <channel> [<channel> ...]")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"PSUBSCRIBE"+ResetColor, "Print the messages of channels matching patterns until interrupted")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "PSUBSCRIBE <pattern> [<pattern> ...]")
+	displayTypeCommandGuide()
+	displayStreamCommandGuide()
+	displaySketchCommandGuide()
+	fmt.Printf(" %-14s | %s\n", GreenColor+"LOCK"+ResetColor, "Acquire a lock for a lease, printing its owner and fencing tokens")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "LOCK <name> <seconds>")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"RENEWLOCK"+ResetColor, "Extend the lease of a lock held by the owner")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "RENEWLOCK <name> <owner> <seconds>")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"UNLOCK"+ResetColor, "Release a lock held by the owner")
+	fmt.Printf(" %-14s | %s\n", GreenColor+"   Usage:"+ResetColor, "UNLOCK <name> <owner>")
 	fmt.Printf(" %-14s | %s\n", GreenColor+"EXIT"+ResetColor, "Exit the application")
 	fmt.Printf(" %-14s | %s\n", GreenColor+"HELP"+ResetColor, "Display this command guide")
 	fmt.Println("----------------------------------")
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// handlePubSubCommand runs PUBLISH, SUBSCRIBE and PSUBSCRIBE. Subscriptions
+// print messages until the connection closes or the CLI is interrupted.
+func handlePubSubCommand(command Command, args []string) {
+	switch command {
+	case CMDPublish:
+		if checkArgs(args, len(args) >= 2, "PUBLISH <channel> <message>") {
+			message := strings.Join(args[1:], " ")
+			printResponse(sendJSONRequest("/pubsub/publish", map[string]string{"channel": args[0], "message": message}))
+		}
+
+	case CMDSubscribe:
+		if checkArgs(args, len(args) >= 1, "SUBSCRIBE <channel> [<channel> ...]") {
+			streamMessages(url.Values{"channel": args})
+		}
+
+	case CMDPSubscribe:
+		if checkArgs(args, len(args) >= 1, "PSUBSCRIBE <pattern> [<pattern> ...]") {
+			streamMessages(url.Values{"pattern": args})
+		}
+	}
+}
+
+// streamMessages subscribes through the load balancer and prints every message received.
+func streamMessages(params url.Values) {
+	resp, err := sendQueryRequest("/pubsub/subscribe", params)
+	if err != nil {
+		fmt.Println(RedColor+"Error sending request:", err, ResetColor)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		printResponse(resp, nil)
+		return
+	}
+
+	fmt.Println(GreenColor + "Subscribed, press Ctrl-C to stop." + ResetColor)
+	event := ""
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+
+		case strings.HasPrefix(line, "data: ") && event == "message":
+			var message Message
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &message); err != nil {
+				continue
+			}
+			if message.Pattern != "" {
+				fmt.Printf("%s (%s): %s\n", message.Channel, message.Pattern, message.Payload)
+			} else {
+				fmt.Printf("%s: %s\n", message.Channel, message.Payload)
+			}
+
+		case strings.HasPrefix(line, "data: ") && event == "dropped":
+			fmt.Println(RedColor + "Subscription dropped, messages arrived faster than they were read." + ResetColor)
+		}
+	}
+}
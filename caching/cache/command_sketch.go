@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// handleSketchCommand runs the commands of Bloom filters, HyperLogLogs and
+// Count-Min sketches.
+func handleSketchCommand(command Command, args []string) {
+	switch command {
+	case CMDBFReserve:
+		if checkArgs(args, len(args) == 3, "BF.RESERVE <key> <error_rate> <capacity>") {
+			errorRate, err := strconv.ParseFloat(args[1], 64)
+			if err != nil {
+				fmt.Println(RedColor + "Error: error_rate must be a number." + ResetColor)
+				return
+			}
+			capacity, err := strconv.Atoi(args[2])
+			if err != nil {
+				fmt.Println(RedColor + "Error: capacity must be an integer." + ResetColor)
+				return
+			}
+			request := map[string]interface{}{"key": args[0], "error_rate": errorRate, "capacity": capacity}
+			printResponse(sendJSONRequest("/cache/bfreserve", request))
+		}
+
+	case CMDBFAdd:
+		if checkArgs(args, len(args) >= 2, "BF.ADD <key> <item> [<item> ...]") {
+			printResponse(sendJSONRequest("/cache/bfadd", map[string]interface{}{"key": args[0], "items": args[1:]}))
+		}
+
+	case CMDBFExists:
+		if checkArgs(args, len(args) >= 2, "BF.EXISTS <key> <item> [<item> ...]") {
+			printResponse(sendQueryRequest("/cache/bfexists", url.Values{"key": {args[0]}, "item": args[1:]}))
+		}
+
+	case CMDPFAdd:
+		if checkArgs(args, len(args) >= 1, "PFADD <key> [<element> ...]") {
+			printResponse(sendJSONRequest("/cache/pfadd", map[string]interface{}{"key": args[0], "elements": args[1:]}))
+		}
+
+	case CMDPFCount:
+		if checkArgs(args, len(args) >= 1, "PFCOUNT <key> [<key> ...]") {
+			printResponse(sendQueryRequest("/cache/pfcount", url.Values{"key": args}))
+		}
+
+	case CMDPFMerge:
+		if checkArgs(args, len(args) >= 2, "PFMERGE <destkey> <sourcekey> [<sourcekey> ...]") {
+			printResponse(sendJSONRequest("/cache/pfmerge", map[string]interface{}{"dest": args[0], "sources": args[1:]}))
+		}
+
+	case CMDCMSInitByDim:
+		if checkArgs(args, len(args) == 3, "CMS.INITBYDIM <key> <width> <depth>") {
+			width, errWidth := strconv.Atoi(args[1])
+			depth, errDepth := strconv.Atoi(args[2])
+			if errWidth != nil || errDepth != nil {
+				fmt.Println(RedColor + "Error: width and depth must be integers." + ResetColor)
+				return
+			}
+			printResponse(sendJSONRequest("/cache/cmsinit", map[string]interface{}{"key": args[0], "width": width, "depth": depth}))
+		}
+
+	case CMDCMSInitByProb:
+		if checkArgs(args, len(args) == 3, "CMS.INITBYPROB <key> <error> <probability>") {
+			errorRate, errRate := strconv.ParseFloat(args[1], 64)
+			probability, errProbability := strconv.ParseFloat(args[2], 64)
+			if errRate != nil || errProbability != nil {
+				fmt.Println(RedColor + "Error: error and probability must be numbers." + ResetColor)
+				return
+			}
+			request := map[string]interface{}{"key": args[0], "error_rate": errorRate, "probability": probability}
+			printResponse(sendJSONRequest("/cache/cmsinit", request))
+		}
+
+	case CMDCMSIncrBy:
+		if checkArgs(args, len(args) >= 3 && len(args)%2 == 1, "CMS.INCRBY <key> <item> <increment> [<item> <increment> ...]") {
+			increments := make(map[string]int64)
+			for i := 1; i < len(args); i += 2 {
+				increment, err := strconv.ParseInt(args[i+1], 10, 64)
+				if err != nil {
+					fmt.Println(RedColor + "Error: increments must be integers." + ResetColor)
+					return
+				}
+				increments[args[i]] += increment
+			}
+			printResponse(sendJSONRequest("/cache/cmsincrby", map[string]interface{}{"key": args[0], "increments": increments}))
+		}
+
+	case CMDCMSQuery:
+		if checkArgs(args, len(args) >= 2, "CMS.QUERY <key> <item> [<item> ...]") {
+			printResponse(sendQueryRequest("/cache/cmsquery", url.Values{"key": {args[0]}, "item": args[1:]}))
+		}
+	}
+}
+
+// displaySketchCommandGuide prints the usage of the sketch commands.
+func displaySketchCommandGuide() {
+	commands := [][2]string{
+		{"BF.RESERVE", "BF.RESERVE <key> <error_rate> <capacity>"},
+		{"BF.ADD", "BF.ADD <key> <item> [<item> ...]"},
+		{"BF.EXISTS", "BF.EXISTS <key> <item> [<item> ...]"},
+		{"PFADD", "PFADD <key> [<element> ...]"},
+		{"PFCOUNT", "PFCOUNT <key> [<key> ...]"},
+		{"PFMERGE", "PFMERGE <destkey> <sourcekey> [<sourcekey> ...]"},
+		{"CMS.INITBYDIM", "CMS.INITBYDIM <key> <width> <depth>"},
+		{"CMS.INITBYPROB", "CMS.INITBYPROB <key> <error> <probability>"},
+		{"CMS.INCRBY", "CMS.INCRBY <key> <item> <increment> [<item> <increment> ...]"},
+		{"CMS.QUERY", "CMS.QUERY <key> <item> [<item> ...]"},
+	}
+	for _, command := range commands {
+		fmt.Printf(" %-14s | %s\n", GreenColor+command[0]+ResetColor, command[1])
+	}
+}
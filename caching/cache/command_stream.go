@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// handleStreamCommand runs the stream commands. Reads blocking with BLOCK wait
+// for the response, as long as the request is open for BLOCK 0.
+func handleStreamCommand(command Command, args []string) {
+	switch command {
+	case CMDXAdd:
+		usage := "XADD <key> [MAXLEN <n>] <id|*> <field> <value> [<field> <value> ...]"
+		request := map[string]interface{}{}
+		if len(args) >= 3 && strings.EqualFold(args[1], "MAXLEN") {
+			maxLen, err := strconv.Atoi(args[2])
+			if err != nil {
+				fmt.Println(RedColor + "Error: MAXLEN must be an integer." + ResetColor)
+				return
+			}
+			request["maxlen"] = maxLen
+			args = append([]string{args[0]}, args[3:]...)
+		}
+		if checkArgs(args, len(args) >= 4 && len(args)%2 == 0, usage) {
+			fields := make(map[string]string)
+			for i := 2; i < len(args); i += 2 {
+				fields[args[i]] = args[i+1]
+			}
+			request["key"], request["id"], request["fields"] = args[0], args[1], fields
+			printResponse(sendJSONRequest("/cache/xadd", request))
+		}
+
+	case CMDXLen:
+		if checkArgs(args, len(args) == 1, "XLEN <key>") {
+			printResponse(sendQueryRequest("/cache/xlen", url.Values{"key": {args[0]}}))
+		}
+
+	case CMDXRange:
+		usage := "XRANGE <key> <start> <end> [COUNT <count>]"
+		if checkArgs(args, len(args) == 3 || (len(args) == 5 && strings.EqualFold(args[3], "COUNT")), usage) {
+			params := url.Values{"key": {args[0]}, "start": {args[1]}, "end": {args[2]}}
+			if len(args) == 5 {
+				params.Set("count", args[4])
+			}
+			printResponse(sendQueryRequest("/cache/xrange", params))
+		}
+
+	case CMDXRead:
+		usage := "XREAD [COUNT <count>] [BLOCK <ms>] STREAMS <key> [<key> ...] <id> [<id> ...]"
+		options, keys, ids, ok := parseStreamsArgs(args)
+		if checkArgs(args, ok && len(options)%2 == 0, usage) {
+			params := url.Values{"key": keys, "id": ids}
+			for i := 0; i < len(options); i += 2 {
+				switch strings.ToUpper(options[i]) {
+				case "COUNT", "BLOCK":
+					params.Set(strings.ToLower(options[i]), options[i+1])
+				default:
+					checkArgs(args, false, usage)
+					return
+				}
+			}
+			printResponse(sendQueryRequest("/cache/xread", params))
+		}
+
+	case CMDXTrim:
+		if checkArgs(args, len(args) == 3 && strings.EqualFold(args[1], "MAXLEN"), "XTRIM <key> MAXLEN <n>") {
+			maxLen, err := strconv.Atoi(args[2])
+			if err != nil {
+				fmt.Println(RedColor + "Error: MAXLEN must be an integer." + ResetColor)
+				return
+			}
+			printResponse(sendJSONRequest("/cache/xtrim", map[string]interface{}{"key": args[0], "maxlen": maxLen}))
+		}
+
+	case CMDXGroup:
+		usage := "XGROUP CREATE <key> <group> <id|$> [MKSTREAM]"
+		valid := (len(args) == 4 || (len(args) == 5 && strings.EqualFold(args[4], "MKSTREAM"))) && strings.EqualFold(args[0], "CREATE")
+		if checkArgs(args, valid, usage) {
+			request := map[string]interface{}{"key": args[1], "group": args[2], "id": args[3], "mkstream": len(args) == 5}
+			printResponse(sendJSONRequest("/cache/xgroupcreate", request))
+		}
+
+	case CMDXReadGroup:
+		usage := "XREADGROUP GROUP <group> <consumer> [COUNT <count>] [BLOCK <ms>] [NOACK] STREAMS <key> [<key> ...] <id> [<id> ...]"
+		options, keys, ids, ok := parseStreamsArgs(args)
+		if !checkArgs(args, ok && len(options) >= 3 && strings.EqualFold(options[0], "GROUP"), usage) {
+			return
+		}
+		request := map[string]interface{}{"group": options[1], "consumer": options[2], "keys": keys, "ids": ids}
+		for i := 3; i < len(options); i++ {
+			switch option := strings.ToUpper(options[i]); {
+			case option == "NOACK":
+				request["noack"] = true
+			case (option == "COUNT" || option == "BLOCK") && i+1 < len(options):
+				value, err := strconv.Atoi(options[i+1])
+				if err != nil {
+					fmt.Println(RedColor + "Error: " + option + " must be an integer." + ResetColor)
+					return
+				}
+				request[strings.ToLower(option)] = value
+				i++
+			default:
+				checkArgs(args, false, usage)
+				return
+			}
+		}
+		printResponse(sendJSONRequest("/cache/xreadgroup", request))
+
+	case CMDXAck:
+		if checkArgs(args, len(args) >= 3, "XACK <key> <group> <id> [<id> ...]") {
+			printResponse(sendJSONRequest("/cache/xack", map[string]interface{}{"key": args[0], "group": args[1], "ids": args[2:]}))
+		}
+
+	case CMDXPending:
+		if checkArgs(args, len(args) == 2 || len(args) == 3, "XPENDING <key> <group> [<consumer>]") {
+			params := url.Values{"key": {args[0]}, "group": {args[1]}}
+			if len(args) == 3 {
+				params.Set("consumer", args[2])
+			}
+			printResponse(sendQueryRequest("/cache/xpending", params))
+		}
+	}
+}
+
+// parseStreamsArgs splits the arguments of XREAD and XREADGROUP into the
+// options before STREAMS and the keys and IDs after it, as many of each.
+func parseStreamsArgs(args []string) (options []string, keys []string, ids []string, ok bool) {
+	for i, arg := range args {
+		if !strings.EqualFold(arg, "STREAMS") {
+			continue
+		}
+		rest := args[i+1:]
+		if len(rest) == 0 || len(rest)%2 != 0 {
+			return nil, nil, nil, false
+		}
+		return args[:i], rest[:len(rest)/2], rest[len(rest)/2:], true
+	}
+	return nil, nil, nil, false
+}
+
+// displayStreamCommandGuide prints the usage of the stream commands.
+func displayStreamCommandGuide() {
+	commands := [][2]string{
+		{"XADD", "XADD <key> [MAXLEN <n>] <id|*> <field> <value> [<field> <value> ...]"},
+		{"XLEN", "XLEN <key>"},
+		{"XRANGE", "XRANGE <key> <start> <end> [COUNT <count>]"},
+		{"XREAD", "XREAD [COUNT <count>] [BLOCK <ms>] STREAMS <key> [<key> ...] <id> [<id> ...]"},
+		{"XTRIM", "XTRIM <key> MAXLEN <n>"},
+		{"XGROUP", "XGROUP CREATE <key> <group> <id|$> [MKSTREAM]"},
+		{"XREADGROUP", "XREADGROUP GROUP <group> <consumer> [COUNT <count>] [BLOCK <ms>] [NOACK] STREAMS <key> [<key> ...] <id> [<id> ...]"},
+		{"XACK", "XACK <key> <group> <id> [<id> ...]"},
+		{"XPENDING", "XPENDING <key> <group> [<consumer>]"},
+	}
+	for _, command := range commands {
+		fmt.Printf(" %-14s | %s\n", GreenColor+command[0]+ResetColor, command[1])
+	}
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// cliTransaction holds the keys watched with WATCH and the commands queued
+// since MULTI, until EXEC sends them to the master or DISCARD drops them.
+var cliTransaction struct {
+	active   bool
+	watch    map[string]uint64
+	commands [][]string
+}
+
+// queueTransactionCommand queues a command while a MULTI is open. It reports
+// false when no transaction is open or the command controls the transaction.
+func queueTransactionCommand(parts []string) bool {
+	if !cliTransaction.active {
+		return false
+	}
+	switch Command(strings.ToUpper(parts[0])) {
+	case CMDMulti, CMDExec, CMDDiscard, CMDWatch:
+		return false
+	}
+
+	cliTransaction.commands = append(cliTransaction.commands, parts)
+	fmt.Println(GreenColor + "QUEUED" + ResetColor)
+	return true
+}
+
+// handleTransactionCommand runs MULTI, EXEC, DISCARD and WATCH.
+func handleTransactionCommand(command Command, args []string) {
+	switch command {
+	case CMDWatch:
+		if !checkArgs(args, len(args) >= 1, "WATCH <key> [<key> ...]") {
+			return
+		}
+		if cliTransaction.active {
+			fmt.Println(RedColor + "Error: WATCH inside MULTI is not allowed." + ResetColor)
+			return
+		}
+		watchKeys(args)
+
+	case CMDMulti:
+		if cliTransaction.active {
+			fmt.Println(RedColor + "Error: MULTI calls can not be nested." + ResetColor)
+			return
+		}
+		cliTransaction.active = true
+		fmt.Println(GreenColor + "OK" + ResetColor)
+
+	case CMDExec:
+		if !cliTransaction.active {
+			fmt.Println(RedColor + "Error: EXEC without MULTI." + ResetColor)
+			return
+		}
+		request := map[string]interface{}{"watch": cliTransaction.watch, "commands": cliTransaction.commands}
+		resetCLITransaction()
+		printResponse(sendJSONRequest("/cache/exec", request))
+
+	case CMDDiscard:
+		if !cliTransaction.active {
+			fmt.Println(RedColor + "Error: DISCARD without MULTI." + ResetColor)
+			return
+		}
+		resetCLITransaction()
+		fmt.Println(GreenColor + "OK" + ResetColor)
+	}
+}
+
+// watchKeys reads the current versions of keys so EXEC can check them.
+func watchKeys(keys []string) {
+	resp, err := sendQueryRequest("/cache/versions", url.Values{"key": keys})
+	if err != nil {
+		fmt.Println(RedColor+"Error sending request:", err, ResetColor)
+		return
+	}
+	defer resp.Body.Close()
+
+	var versions map[string]uint64
+	if err := json.NewDecoder(resp.Body).Decode(&versions); err != nil {
+		fmt.Println(RedColor+"Error decoding response:", err, ResetColor)
+		return
+	}
+	if cliTransaction.watch == nil {
+		cliTransaction.watch = make(map[string]uint64)
+	}
+	for key, version := range versions {
+		cliTransaction.watch[key] = version
+	}
+	fmt.Println(GreenColor + "OK" + ResetColor)
+}
+
+func resetCLITransaction() {
+	cliTransaction.active = false
+	cliTransaction.watch = nil
+	cliTransaction.commands = nil
+}
@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// loadBalancerURL is where the CLI sends its requests.
+const loadBalancerURL = "http://localhost:8888"
+
+// handleTypeCommand handles the commands of the rich data types. It reports
+// false when the command is not one of them.
+func handleTypeCommand(command string, args []string) bool {
+	switch Command(command) {
+	case CMDType:
+		if checkArgs(args, len(args) == 1, "TYPE <key>") {
+			printResponse(sendQueryRequest("/cache/type", url.Values{"key": {args[0]}}))
+		}
+
+	case CMDHSet:
+		if checkArgs(args, len(args) >= 3 && len(args)%2 == 1, "HSET <key> <field> <value> [<field> <value> ...]") {
+			fields := make(map[string]string)
+			for i := 1; i < len(args); i += 2 {
+				fields[args[i]] = args[i+1]
+			}
+			printResponse(sendJSONRequest("/cache/hset", map[string]interface{}{"key": args[0], "fields": fields}))
+		}
+
+	case CMDHGet:
+		if checkArgs(args, len(args) == 2, "HGET <key> <field>") {
+			printResponse(sendQueryRequest("/cache/hget", url.Values{"key": {args[0]}, "field": {args[1]}}))
+		}
+
+	case CMDHGetAll:
+		if checkArgs(args, len(args) == 1, "HGETALL <key>") {
+			printResponse(sendQueryRequest("/cache/hgetall", url.Values{"key": {args[0]}}))
+		}
+
+	case CMDLPush:
+		if checkArgs(args, len(args) >= 2, "LPUSH <key> <value> [<value> ...]") {
+			printResponse(sendJSONRequest("/cache/lpush", map[string]interface{}{"key": args[0], "values": args[1:]}))
+		}
+
+	case CMDRPop:
+		if checkArgs(args, len(args) == 1, "RPOP <key>") {
+			printResponse(sendJSONRequest("/cache/rpop", map[string]interface{}{"key": args[0]}))
+		}
+
+	case CMDLRange:
+		if checkArgs(args, len(args) == 3, "LRANGE <key> <start> <stop>") {
+			printResponse(sendQueryRequest("/cache/lrange", url.Values{"key": {args[0]}, "start": {args[1]}, "stop": {args[2]}}))
+		}
+
+	case CMDSAdd:
+		if checkArgs(args, len(args) >= 2, "SADD <key> <member> [<member> ...]") {
+			printResponse(sendJSONRequest("/cache/sadd", map[string]interface{}{"key": args[0], "members": args[1:]}))
+		}
+
+	case CMDSIsMember:
+		if checkArgs(args, len(args) == 2, "SISMEMBER <key> <member>") {
+			printResponse(sendQueryRequest("/cache/sismember", url.Values{"key": {args[0]}, "member": {args[1]}}))
+		}
+
+	case CMDSInter:
+		if checkArgs(args, len(args) >= 1, "SINTER <key> [<key> ...]") {
+			printResponse(sendQueryRequest("/cache/sinter", url.Values{"keys": {strings.Join(args, ",")}}))
+		}
+
+	case CMDZAdd:
+		if checkArgs(args, len(args) >= 3 && len(args)%2 == 1, "ZADD <key> <score> <member> [<score> <member> ...]") {
+			members := make(map[string]float64)
+			for i := 1; i < len(args); i += 2 {
+				score, err := strconv.ParseFloat(args[i], 64)
+				if err != nil {
+					fmt.Println(RedColor + "Error: Score must be a number." + ResetColor)
+					return true
+				}
+				members[args[i+1]] = score
+			}
+			printResponse(sendJSONRequest("/cache/zadd", map[string]interface{}{"key": args[0], "members": members}))
+		}
+
+	case CMDZRangeByScore:
+		if checkArgs(args, len(args) == 3, "ZRANGEBYSCORE <key> <min> <max>") {
+			printResponse(sendQueryRequest("/cache/zrangebyscore", url.Values{"key": {args[0]}, "min": {args[1]}, "max": {args[2]}}))
+		}
+
+	default:
+		return false
+	}
+	return true
+}
+
+// checkArgs prints the usage of a command when its arguments are invalid.
+func checkArgs(args []string, valid bool, usage string) bool {
+	if !valid {
+		fmt.Println(RedColor + "Error: Invalid command. Usage: " + usage + ResetColor)
+	}
+	return valid
+}
+
+// sendJSONRequest posts a JSON body to a master endpoint through the load balancer.
+func sendJSONRequest(path string, body interface{}) (*http.Response, error) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.Post(loadBalancerURL+path, "application/json", strings.NewReader(string(encoded)))
+}
+
+// sendQueryRequest sends a GET request to a slave endpoint through the load balancer.
+func sendQueryRequest(path string, params url.Values) (*http.Response, error) {
+	return http.Get(loadBalancerURL + path + "?" + params.Encode())
+}
+
+// printResponse prints the body of a response, or its error.
+func printResponse(resp *http.Response, err error) {
+	if err != nil {
+		fmt.Println(RedColor+"Error sending request:", err, ResetColor)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Println(RedColor+"Error reading response:", err, ResetColor)
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Println(RedColor+"Error:", resp.Status, strings.TrimSpace(string(body))+ResetColor)
+		return
+	}
+	fmt.Println(strings.TrimSpace(string(body)))
+}
+
+// displayTypeCommandGuide prints the usage of the rich data type commands.
+func displayTypeCommandGuide() {
+	commands := [][2]string{
+		{"TYPE", "TYPE <key>"},
+		{"HSET", "HSET <key> <field> <value> [<field> <value> ...]"},
+		{"HGET", "HGET <key> <field>"},
+		{"HGETALL", "HGETALL <key>"},
+		{"LPUSH", "LPUSH <key> <value> [<value> ...]"},
+		{"RPOP", "RPOP <key>"},
+		{"LRANGE", "LRANGE <key> <start> <stop>"},
+		{"SADD", "SADD <key> <member> [<member> ...]"},
+		{"SISMEMBER", "SISMEMBER <key> <member>"},
+		{"SINTER", "SINTER <key> [<key> ...]"},
+		{"ZADD", "ZADD <key> <score> <member> [<score> <member> ...]"},
+		{"ZRANGEBYSCORE", "ZRANGEBYSCORE <key> <min> <max>"},
+	}
+	for _, command := range commands {
+		fmt.Printf(" %-14s | %s\n", GreenColor+command[0]+ResetColor, command[1])
+	}
+}
@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Strings of at least Options.CompressionThreshold bytes are stored
+// compressed when that makes them smaller. Each node carries the codec of its
+// data, so compressed and plain values live side by side, and a compressed
+// value is written to the AOF, snapshots and replication stream as is:
+//
+//	SETZ <key> <codec> <base64 data> [PXAT <deadline-ms>] [TAGS <tag> ...]
+//
+// Nodes replaying the record keep the value compressed whatever their own
+// threshold is.
+
+// aofSetCompressed stores a value that is already compressed.
+const aofSetCompressed Command = "SETZ"
+
+// codec is the encoding of the data of a string node.
+type codec uint8
+
+const (
+	codecRaw   codec = iota // Stored as written
+	codecFlate              // Compressed with DEFLATE
+)
+
+// codecNames are the names codecs are written with in records.
+var codecNames = map[codec]string{
+	codecRaw:   "raw",
+	codecFlate: "deflate",
+}
+
+func (c codec) String() string {
+	if name, ok := codecNames[c]; ok {
+		return name
+	}
+	return "codec(" + strconv.Itoa(int(c)) + ")"
+}
+
+func parseCodec(name string) (codec, error) {
+	for c, codecName := range codecNames {
+		if codecName == name {
+			return c, nil
+		}
+	}
+	return codecRaw, fmt.Errorf("unknown codec %q", name)
+}
+
+// flateWriters reuses compressors, which are expensive to allocate.
+var flateWriters = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// compress returns the codec and data a value is stored with: compressed when
+// it reaches the threshold and shrinks, as given otherwise.
+func (c *Cache) compress(value []byte) (codec, []byte) {
+	threshold := c.options.CompressionThreshold
+	if threshold <= 0 || int64(len(value)) < threshold {
+		return codecRaw, value
+	}
+
+	var buf bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(value); err != nil {
+		return codecRaw, value
+	}
+	if err := w.Close(); err != nil {
+		return codecRaw, value
+	}
+
+	if buf.Len() >= len(value) {
+		return codecRaw, value
+	}
+	return codecFlate, buf.Bytes()
+}
+
+// decompress returns the value stored as data with the given codec. sizeHint
+// is the expected size of the value, 0 when unknown.
+func decompress(enc codec, data []byte, sizeHint int64) ([]byte, error) {
+	switch enc {
+	case codecRaw:
+		return data, nil
+	case codecFlate:
+		r := flate.NewReader(bytes.NewReader(data))
+		defer r.Close()
+
+		var buf bytes.Buffer
+		buf.Grow(int(sizeHint))
+		if _, err := io.Copy(&buf, r); err != nil {
+			return nil, fmt.Errorf("decompressing value: %v", err)
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown codec %s", enc)
+	}
+}
+
+// stringValue returns the string held by the node, decompressed. It fails
+// with ErrWrongType when the node holds another type.
+func (n *Node) stringValue() ([]byte, error) {
+	data, ok := n.Data.([]byte)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return decompress(n.codec, data, n.rawSize)
+}
+
+// displayValue returns the data of the node as it is shown to people, strings
+// decompressed.
+func (n *Node) displayValue() interface{} {
+	if value, err := n.stringValue(); err == nil {
+		return value
+	}
+	return n.Data
+}
+
+// setCodec marks the data of a node as stored with enc, standing for rawSize
+// bytes once decompressed. The caller must hold s.mutex.
+func (s *shard) setCodec(node *Node, enc codec, rawSize int64) {
+	s.accountCompression(node, -1)
+	node.codec = enc
+	node.rawSize = rawSize
+	s.accountCompression(node, 1)
+}
+
+// accountCompression adds a compressed node to the compression statistics,
+// or removes it when sign is negative. The caller must hold s.mutex.
+func (s *shard) accountCompression(node *Node, sign int64) {
+	if node.codec == codecRaw {
+		return
+	}
+	s.stats.compressedKeys.Add(sign)
+	s.stats.compressedBytes.Add(sign * node.size)
+	s.stats.uncompressedBytes.Add(sign * node.rawSize)
+}
+
+// storedRecord returns the record of a SET of a value stored with enc as data.
+func storedRecord(key string, enc codec, data []byte, deadline time.Time, tags []string) []string {
+	if enc == codecRaw {
+		return setRecord(key, data, deadline, tags)
+	}
+	args := []string{string(aofSetCompressed), key, enc.String(), base64.StdEncoding.EncodeToString(data)}
+	return appendSetOptions(args, deadline, tags)
+}
+
+// applySetCompressed replays a SETZ record, whose arguments follow the
+// command name. The value is checked to decompress before it is stored. The
+// caller must hold s.mutex.
+func (s *shard) applySetCompressed(args []string) error {
+	enc, err := parseCodec(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid SETZ record: %v", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(args[2])
+	if err != nil {
+		return fmt.Errorf("invalid data in SETZ record: %v", err)
+	}
+	value, err := decompress(enc, data, 0)
+	if err != nil {
+		return fmt.Errorf("invalid data in SETZ record: %v", err)
+	}
+
+	deadline, tags, err := parseSetOptions(args[3:])
+	if err != nil {
+		return fmt.Errorf("invalid SETZ record: %v", err)
+	}
+	_, err = s.store(args[0], enc, data, int64(len(value)), deadline, nil, tags)
+	return err
+}
@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	c := NewCacheWithOptions(Options{CompressionThreshold: 1024})
+	defer c.Close()
+	records := recordWrites(c)
+
+	page := bytes.Repeat([]byte("<div>rendered html</div>"), 1000)
+	if err := c.Set("page", page, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("small", []byte("tiny"), 0); err != nil {
+		t.Fatal(err)
+	}
+	noise := make([]byte, 4096)
+	if _, err := rand.Read(noise); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("noise", noise, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string][]byte{"page": page, "small": []byte("tiny"), "noise": noise} {
+		if value, err := c.Get(key); err != nil || !bytes.Equal(value, want) {
+			t.Fatalf("Get(%q) returned %d bytes, %v, want the %d bytes stored", key, len(value), err, len(want))
+		}
+	}
+
+	// Only the value that shrinks is stored compressed
+	stats := c.Stats()
+	if stats.CompressedKeys != 1 || stats.UncompressedBytes != int64(len(page)) || stats.CompressionRatio <= 10 {
+		t.Fatalf("stats = %d keys, %d bytes, ratio %.2f, want the page compressed", stats.CompressedKeys, stats.UncompressedBytes, stats.CompressionRatio)
+	}
+	if usage, err := c.MemoryUsage("page"); err != nil || usage >= int64(len(page)) {
+		t.Fatalf("MemoryUsage of the compressed page = %d, %v, want below %d", usage, err, len(page))
+	}
+
+	// The record of the page carries it compressed and the slave keeps it so
+	written := records()
+	if !strings.Contains(written[0], string(aofSetCompressed)+" page") || len(written[0]) >= len(page) {
+		t.Fatalf("record of the page = %.60q... (%d bytes), want a compressed SETZ", written[0], len(written[0]))
+	}
+	slave := NewCache()
+	defer slave.Close()
+	for _, record := range written {
+		if err := slave.ApplyRecord(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if value, err := slave.Get("page"); err != nil || !bytes.Equal(value, page) {
+		t.Fatalf("slave Get returned %d bytes, %v", len(value), err)
+	}
+	if compressed := slave.Stats().CompressedKeys; compressed != 1 {
+		t.Fatalf("slave compressed keys = %d, want 1", compressed)
+	}
+
+	if err := c.Delete("page"); err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.Stats(); stats.CompressedKeys != 0 || stats.CompressionRatio != 1 {
+		t.Fatalf("stats after delete = %d keys, ratio %.2f, want none", stats.CompressedKeys, stats.CompressionRatio)
+	}
+}
+
+func TestCompressedValuesSurviveAOFRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aof.log")
+	page := bytes.Repeat([]byte("{\"json\":true}"), 2000)
+
+	c := NewCacheWithOptions(Options{CompressionThreshold: 1024})
+	if err := c.ReplayAOF(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("page", page, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RewriteAOF(); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	// A cache without compression still reads the compressed records
+	restored := NewCache()
+	defer restored.Close()
+	if err := restored.ReplayAOF(path); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := restored.Get("page"); err != nil || !bytes.Equal(value, page) {
+		t.Fatalf("Get after replay returned %d bytes, %v", len(value), err)
+	}
+}
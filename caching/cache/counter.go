@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+var (
+	// ErrNotInteger is returned when an integer counter operation meets a value
+	// that is not a 64-bit integer, or when the result would overflow.
+	ErrNotInteger = errors.New("value is not an integer or out of range")
+
+	// ErrNotFloat is returned when a float counter operation meets a value that
+	// is not a number, or when the result would be NaN or infinite.
+	ErrNotFloat = errors.New("value is not a valid float")
+)
+
+// Incr adds one to the integer stored under key and returns the new value.
+func (c *Cache) Incr(key string) (int64, error) {
+	return c.IncrBy(key, 1)
+}
+
+// Decr subtracts one from the integer stored under key and returns the new value.
+func (c *Cache) Decr(key string) (int64, error) {
+	return c.IncrBy(key, -1)
+}
+
+// IncrBy adds delta to the integer stored under key and returns the new value.
+// A missing key counts as zero.
+func (c *Cache) IncrBy(key string, delta int64) (int64, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.incrBy(key, delta)
+}
+
+// incrBy adds delta to the integer stored under key. The caller must hold s.mutex.
+func (s *shard) incrBy(key string, delta int64) (int64, error) {
+	var result int64
+	err := s.updateString(key, func(current []byte, exists bool) ([]byte, error) {
+		var value int64
+		if exists {
+			parsed, err := strconv.ParseInt(string(current), 10, 64)
+			if err != nil {
+				return nil, ErrNotInteger
+			}
+			value = parsed
+		}
+		if (delta > 0 && value > math.MaxInt64-delta) || (delta < 0 && value < math.MinInt64-delta) {
+			return nil, ErrNotInteger
+		}
+		result = value + delta
+		return []byte(strconv.FormatInt(result, 10)), nil
+	})
+	return result, err
+}
+
+// IncrByFloat adds delta to the number stored under key and returns the new
+// value. A missing key counts as zero.
+func (c *Cache) IncrByFloat(key string, delta float64) (float64, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.incrByFloat(key, delta)
+}
+
+// incrByFloat adds delta to the number stored under key. The caller must hold s.mutex.
+func (s *shard) incrByFloat(key string, delta float64) (float64, error) {
+	var result float64
+	err := s.updateString(key, func(current []byte, exists bool) ([]byte, error) {
+		var value float64
+		if exists {
+			parsed, err := strconv.ParseFloat(string(current), 64)
+			if err != nil {
+				return nil, ErrNotFloat
+			}
+			value = parsed
+		}
+		result = value + delta
+		if math.IsNaN(result) || math.IsInf(result, 0) {
+			return nil, ErrNotFloat
+		}
+		return []byte(strconv.FormatFloat(result, 'f', -1, 64)), nil
+	})
+	return result, err
+}
+
+// updateString replaces the string stored under key with the value returned by
+// update. The key keeps its expiry, and the AOF gets a SET of the resulting
+// value so that replaying it is idempotent. The caller must hold s.mutex.
+func (s *shard) updateString(key string, update func(current []byte, exists bool) ([]byte, error)) error {
+	if err := s.reserveMemory(0); err != nil {
+		return err
+	}
+	node, err := s.lookupTyped(key, TypeString)
+	if err != nil {
+		return err
+	}
+
+	var current []byte
+	if node != nil {
+		if current, err = node.stringValue(); err != nil {
+			return err
+		}
+	}
+	value, err := update(current, node != nil)
+	if err != nil {
+		return err
+	}
+
+	if node == nil {
+		node = newNode(key, value)
+		s.insert(node)
+	} else {
+		s.replaceData(node, value)
+	}
+	s.cache.writeNodeRecord(node, setRecord(key, value, node.expiresAt, node.tags)...)
+
+	s.evictOverflow()
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCounters(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	if value, err := c.Incr("hits"); err != nil || value != 1 {
+		t.Fatalf("Incr of a missing key = %d, %v, want 1", value, err)
+	}
+	if value, err := c.IncrBy("hits", 41); err != nil || value != 42 {
+		t.Fatalf("IncrBy = %d, %v, want 42", value, err)
+	}
+	if value, err := c.Decr("hits"); err != nil || value != 41 {
+		t.Fatalf("Decr = %d, %v, want 41", value, err)
+	}
+	if value, err := c.Get("hits"); err != nil || string(value) != "41" {
+		t.Fatalf("Get = %q, %v, want 41", value, err)
+	}
+
+	if value, err := c.IncrByFloat("ratio", 0.5); err != nil || value != 0.5 {
+		t.Fatalf("IncrByFloat = %v, %v, want 0.5", value, err)
+	}
+	if value, err := c.IncrByFloat("ratio", 1.25); err != nil || value != 1.75 {
+		t.Fatalf("IncrByFloat = %v, %v, want 1.75", value, err)
+	}
+}
+
+func TestCounterErrors(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	if err := c.Set("name", []byte("ada"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Incr("name"); !errors.Is(err, ErrNotInteger) {
+		t.Fatalf("Incr of a non-integer = %v, want ErrNotInteger", err)
+	}
+	if _, err := c.IncrByFloat("name", 1); !errors.Is(err, ErrNotFloat) {
+		t.Fatalf("IncrByFloat of a non-number = %v, want ErrNotFloat", err)
+	}
+
+	if _, err := c.IncrBy("max", math.MaxInt64); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Incr("max"); !errors.Is(err, ErrNotInteger) {
+		t.Fatalf("Incr past MaxInt64 = %v, want ErrNotInteger", err)
+	}
+	if value, err := c.Get("max"); err != nil || string(value) != "9223372036854775807" {
+		t.Fatalf("Get after overflow = %q, %v, want it unchanged", value, err)
+	}
+
+	if _, err := c.IncrByFloat("huge", math.MaxFloat64); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.IncrByFloat("huge", math.MaxFloat64); !errors.Is(err, ErrNotFloat) {
+		t.Fatalf("IncrByFloat to infinity = %v, want ErrNotFloat", err)
+	}
+
+	if _, err := c.LPush("list", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Incr("list"); !errors.Is(err, ErrWrongType) {
+		t.Fatalf("Incr of a list = %v, want ErrWrongType", err)
+	}
+}
+
+func TestCounterKeepsExpiry(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	if err := c.Set("visits", []byte("1"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Incr("visits"); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, err := c.TTL("visits"); err != nil || ttl <= 59*time.Minute {
+		t.Fatalf("TTL after Incr = %v, %v, want about an hour", ttl, err)
+	}
+}
+
+func TestConcurrentIncr(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+	records := recordWrites(c)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if _, err := c.Incr("counter"); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if value, err := c.Get("counter"); err != nil || string(value) != "800" {
+		t.Fatalf("Get = %q, %v, want 800", value, err)
+	}
+
+	// The records hold the resulting values, so a slave ends with the same count
+	slave := NewCache()
+	defer slave.Close()
+	for _, record := range records() {
+		if err := slave.ApplyRecord(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if value, err := slave.Get("counter"); err != nil || string(value) != "800" {
+		t.Fatalf("slave Get = %q, %v, want 800", value, err)
+	}
+}
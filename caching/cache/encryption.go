@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// With Options.Encryption set, every line of the AOF holds a record sealed
+// with AES-GCM under the current key of the keyring:
+//
+//	ENC <key-id> <base64 nonce and ciphertext>
+//
+// The key id names the key without revealing it, so a record sealed with a
+// key that is not configured is reported as such rather than as corruption.
+// Plaintext lines are rejected, since anyone able to append to the file could
+// inject them. An AOF written before encryption was configured is replayed
+// only with Options.EncryptPlaintextAOF set and when none of its lines are
+// sealed. Like records sealed with a previous key, it makes the replay rewrite
+// the AOF under the current key.
+
+// encryptedRecord starts the AOF lines holding a sealed record.
+const encryptedRecord = "ENC"
+
+var (
+	// ErrAOFEncrypted is returned when replaying an encrypted AOF without a keyring.
+	ErrAOFEncrypted = errors.New("the AOF is encrypted but no encryption key is configured")
+
+	// ErrWrongKey is returned when a record of the AOF was sealed with a key that is not configured.
+	ErrWrongKey = errors.New("wrong AOF encryption key")
+
+	// ErrAOFPlaintext is returned when replaying a plaintext record with a keyring.
+	ErrAOFPlaintext = errors.New("plaintext record in an encrypted AOF")
+
+	// ErrAOFCorrupted is returned when a sealed record of the AOF fails authentication.
+	ErrAOFCorrupted = errors.New("AOF record failed authentication")
+)
+
+// Keyring holds the key records are sealed with and the previous keys that
+// are still accepted when replaying, while rotating away from them.
+type Keyring struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring creates a keyring sealing records with current, an AES key of
+// 16, 24 or 32 bytes, and opening records sealed with current or previous.
+func NewKeyring(current []byte, previous ...[]byte) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+	for i, key := range append([][]byte{current}, previous...) {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			if i == 0 {
+				return nil, fmt.Errorf("encryption key: %v", err)
+			}
+			return nil, fmt.Errorf("previous encryption key %d: %v", i, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		id := keyID(key)
+		if i == 0 {
+			k.current = id
+		}
+		if _, exists := k.keys[id]; !exists {
+			k.keys[id] = aead
+		}
+	}
+	return k, nil
+}
+
+// keyID returns the name of a key written in front of the records it seals.
+func keyID(key []byte) string {
+	sum := sha256.Sum256(append([]byte("aof-key-id:"), key...))
+	return hex.EncodeToString(sum[:8])
+}
+
+// CurrentKeyID returns the id of the key records are sealed with.
+func (k *Keyring) CurrentKeyID() string {
+	return k.current
+}
+
+// seal returns the AOF line holding record encrypted with the current key.
+func (k *Keyring) seal(record string) string {
+	aead := k.keys[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(fmt.Sprintf("reading random nonce: %v", err))
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(record), []byte(k.current))
+	return formatRecord(encryptedRecord, k.current, base64.StdEncoding.EncodeToString(sealed))
+}
+
+// openLine returns the record held by an AOF line and the id of the key it
+// was sealed with, empty for plaintext lines. A nil keyring opens plaintext
+// lines only, and any other keyring rejects them with ErrAOFPlaintext.
+func (k *Keyring) openLine(line string) (string, string, error) {
+	if !strings.HasPrefix(line, encryptedRecord+" ") {
+		if k != nil {
+			return "", "", ErrAOFPlaintext
+		}
+		return line, "", nil
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return "", "", fmt.Errorf("%w: malformed encrypted record", ErrAOFCorrupted)
+	}
+	id := fields[1]
+	if k == nil {
+		return "", id, ErrAOFEncrypted
+	}
+	aead, exists := k.keys[id]
+	if !exists {
+		return "", id, fmt.Errorf("%w: record sealed with key %s, configured key is %s", ErrWrongKey, id, k.current)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(fields[2])
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", id, fmt.Errorf("%w: malformed encrypted record", ErrAOFCorrupted)
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	record, err := aead.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return "", id, fmt.Errorf("%w: the record sealed with key %s was altered or is corrupted", ErrAOFCorrupted, id)
+	}
+	return string(record), id, nil
+}
@@ -0,0 +1,232 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestKeyring returns a keyring whose current key is repeated from seed,
+// followed by the previous keys repeated from theirs.
+func newTestKeyring(t *testing.T, seed byte, previous ...byte) *Keyring {
+	t.Helper()
+	var previousKeys [][]byte
+	for _, p := range previous {
+		previousKeys = append(previousKeys, bytes.Repeat([]byte{p}, 32))
+	}
+	keys, err := NewKeyring(bytes.Repeat([]byte{seed}, 32), previousKeys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// writeEncryptedAOF writes an AOF holding a secret in the orders namespace,
+// sealed with keys, and returns its path.
+func writeEncryptedAOF(t *testing.T, keys *Keyring) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "aof.log")
+	namespaces := NewNamespaces(Options{Encryption: keys})
+	defer namespaces.Close()
+	if err := namespaces.ReplayAOF(path); err != nil {
+		t.Fatal(err)
+	}
+	orders, err := namespaces.Namespace("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orders.Set("card", []byte("4111-1111-1111-1111"), 0); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readAOF returns the content of the AOF file at path.
+func readAOF(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestEncryptedAOFReplay(t *testing.T) {
+	keys := newTestKeyring(t, 1)
+	path := writeEncryptedAOF(t, keys)
+	if content := readAOF(t, path); strings.Contains(content, "4111") || !strings.HasPrefix(content, encryptedRecord+" "+keys.CurrentKeyID()) {
+		t.Fatalf("AOF = %q, want records sealed with the current key", content)
+	}
+
+	namespaces := NewNamespaces(Options{Encryption: keys})
+	defer namespaces.Close()
+	if err := namespaces.ReplayAOF(path); err != nil {
+		t.Fatal(err)
+	}
+	orders, err := namespaces.Lookup("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := orders.Get("card"); err != nil || string(value) != "4111-1111-1111-1111" {
+		t.Fatalf("Get after replay = %q, %v", value, err)
+	}
+}
+
+func TestWrongKeyFailsStartup(t *testing.T) {
+	path := writeEncryptedAOF(t, newTestKeyring(t, 1))
+	before := readAOF(t, path)
+
+	for name, keys := range map[string]*Keyring{"wrong key": newTestKeyring(t, 2), "no key": nil} {
+		t.Run(name, func(t *testing.T) {
+			namespaces := NewNamespaces(Options{Encryption: keys})
+			defer namespaces.Close()
+
+			err := namespaces.ReplayAOF(path)
+			want := ErrWrongKey
+			if keys == nil {
+				want = ErrAOFEncrypted
+			}
+			if !errors.Is(err, want) {
+				t.Fatalf("ReplayAOF = %v, want %v", err, want)
+			}
+			if _, err := namespaces.Lookup("orders"); !errors.Is(err, ErrNamespaceNotFound) {
+				t.Fatalf("Lookup after a failed replay = %v, want nothing replayed", err)
+			}
+
+			// Nothing is appended to a file that could not be read
+			if err := namespaces.Default().Set("key", []byte("v"), 0); err != nil {
+				t.Fatal(err)
+			}
+			if after := readAOF(t, path); after != before {
+				t.Fatal("the AOF changed after a failed replay")
+			}
+		})
+	}
+}
+
+func TestTamperedRecordFailsReplay(t *testing.T) {
+	keys := newTestKeyring(t, 1)
+	path := writeEncryptedAOF(t, keys)
+
+	lines := strings.Split(strings.TrimSuffix(readAOF(t, path), "\n"), "\n")
+	fields := strings.Fields(lines[0])
+	// Flip a character of the ciphertext, far from the base64 padding
+	sealed := []byte(fields[2])
+	if sealed[20] == 'A' {
+		sealed[20] = 'B'
+	} else {
+		sealed[20] = 'A'
+	}
+	lines[0] = strings.Join([]string{fields[0], fields[1], string(sealed)}, " ")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	namespaces := NewNamespaces(Options{Encryption: keys})
+	defer namespaces.Close()
+	if err := namespaces.ReplayAOF(path); !errors.Is(err, ErrAOFCorrupted) {
+		t.Fatalf("ReplayAOF of an altered record = %v, want ErrAOFCorrupted", err)
+	}
+}
+
+func TestKeyRotationRewritesAOF(t *testing.T) {
+	path := writeEncryptedAOF(t, newTestKeyring(t, 1))
+
+	// Replaying with the new key and the old one as previous re-encrypts the file
+	rotated := newTestKeyring(t, 2, 1)
+	namespaces := NewNamespaces(Options{Encryption: rotated})
+	if err := namespaces.ReplayAOF(path); err != nil {
+		t.Fatal(err)
+	}
+	namespaces.Close()
+	for _, line := range strings.Split(strings.TrimSuffix(readAOF(t, path), "\n"), "\n") {
+		if !strings.HasPrefix(line, encryptedRecord+" "+rotated.CurrentKeyID()+" ") {
+			t.Fatalf("AOF line %q is not sealed with the new key", line)
+		}
+	}
+
+	// The old key is no longer needed
+	namespaces = NewNamespaces(Options{Encryption: newTestKeyring(t, 2)})
+	defer namespaces.Close()
+	if err := namespaces.ReplayAOF(path); err != nil {
+		t.Fatal(err)
+	}
+	orders, err := namespaces.Lookup("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := orders.Get("card"); err != nil || string(value) != "4111-1111-1111-1111" {
+		t.Fatalf("Get after rotation = %q, %v", value, err)
+	}
+}
+
+func TestInvalidEncryptionKey(t *testing.T) {
+	if _, err := NewKeyring([]byte("short")); err == nil {
+		t.Fatal("NewKeyring accepted a 5-byte key")
+	}
+}
+
+func TestInjectedPlaintextRecordFailsStartup(t *testing.T) {
+	keys := newTestKeyring(t, 1)
+	path := writeEncryptedAOF(t, keys)
+
+	// A record appended in plaintext by someone without the key
+	injected := readAOF(t, writeEncryptedAOF(t, nil))
+	aof, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := aof.WriteString(injected); err != nil {
+		t.Fatal(err)
+	}
+	aof.Close()
+	before := readAOF(t, path)
+
+	for _, migrate := range []bool{false, true} {
+		namespaces := NewNamespaces(Options{Encryption: keys, EncryptPlaintextAOF: migrate})
+		if err := namespaces.ReplayAOF(path); !errors.Is(err, ErrAOFPlaintext) {
+			t.Fatalf("ReplayAOF with EncryptPlaintextAOF %v = %v, want ErrAOFPlaintext", migrate, err)
+		}
+		namespaces.Close()
+		if after := readAOF(t, path); after != before {
+			t.Fatalf("the AOF changed after a failed replay with EncryptPlaintextAOF %v", migrate)
+		}
+	}
+}
+
+func TestEncryptPlaintextAOF(t *testing.T) {
+	path := writeEncryptedAOF(t, nil)
+	keys := newTestKeyring(t, 1)
+
+	// A plaintext AOF is only accepted when asked for
+	namespaces := NewNamespaces(Options{Encryption: keys})
+	if err := namespaces.ReplayAOF(path); !errors.Is(err, ErrAOFPlaintext) {
+		t.Fatalf("ReplayAOF of a plaintext AOF = %v, want ErrAOFPlaintext", err)
+	}
+	namespaces.Close()
+
+	namespaces = NewNamespaces(Options{Encryption: keys, EncryptPlaintextAOF: true})
+	if err := namespaces.ReplayAOF(path); err != nil {
+		t.Fatal(err)
+	}
+	namespaces.Close()
+	if content := readAOF(t, path); strings.Contains(content, "4111") || !strings.HasPrefix(content, encryptedRecord+" "+keys.CurrentKeyID()) {
+		t.Fatalf("AOF = %q, want it rewritten sealed with the current key", content)
+	}
+
+	namespaces = NewNamespaces(Options{Encryption: keys})
+	defer namespaces.Close()
+	if err := namespaces.ReplayAOF(path); err != nil {
+		t.Fatal(err)
+	}
+	orders, err := namespaces.Lookup("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := orders.Get("card"); err != nil || string(value) != "4111-1111-1111-1111" {
+		t.Fatalf("Get after encrypting the AOF = %q, %v", value, err)
+	}
+}
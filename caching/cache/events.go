@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Operations reported by keyspace events.
+const (
+	EventSet     = "set"     // The key was written, Reason holds the recorded command
+	EventDel     = "del"     // The key was deleted, Reason holds the command that did it or "empty"
+	EventExpired = "expired" // The TTL of the key passed
+	EventEvicted = "evicted" // The key was evicted, Reason is "capacity" or "maxmemory"
+	EventFlush   = "flush"   // Every key of the namespace was removed, Key is empty
+)
+
+// Reasons of evictions.
+const (
+	evictedForCapacity  = "capacity"
+	evictedForMaxMemory = "maxmemory"
+)
+
+// Event describes a change to a key of the keyspace.
+type Event struct {
+	Namespace string    `json:"namespace"`
+	Key       string    `json:"key"`
+	Op        string    `json:"op"`
+	Reason    string    `json:"reason"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// EventFilter selects the events a subscription receives. Empty fields match
+// every event.
+type EventFilter struct {
+	Match string   // Glob pattern the key must match
+	Ops   []string // Operations to receive
+}
+
+// EventOps returns the operations keyspace events can report.
+func EventOps() []string {
+	return []string{EventSet, EventDel, EventExpired, EventEvicted, EventFlush}
+}
+
+// Validate reports an error for operations that events never carry.
+func (f EventFilter) Validate() error {
+	for _, op := range f.Ops {
+		known := false
+		for _, candidate := range EventOps() {
+			known = known || op == candidate
+		}
+		if !known {
+			return fmt.Errorf("unknown event type %q", op)
+		}
+	}
+	return nil
+}
+
+func (f EventFilter) matches(event Event) bool {
+	if len(f.Ops) > 0 {
+		wanted := false
+		for _, op := range f.Ops {
+			wanted = wanted || op == event.Op
+		}
+		if !wanted {
+			return false
+		}
+	}
+	// Flushes concern every key
+	return f.Match == "" || event.Op == EventFlush || globMatch(f.Match, event.Key)
+}
+
+// Subscription receives the keyspace events of a cache on Events. A
+// subscriber that lets its buffer fill up is dropped: Events is closed and
+// Dropped reports true.
+type Subscription struct {
+	Events <-chan Event
+
+	hub     *eventHub
+	events  chan Event
+	filter  EventFilter
+	dropped atomic.Bool
+}
+
+// Dropped reports whether the subscription was closed because its buffer overflowed.
+func (s *Subscription) Dropped() bool {
+	return s.dropped.Load()
+}
+
+// Close stops the subscription and closes Events.
+func (s *Subscription) Close() {
+	s.hub.remove(s)
+}
+
+// eventHub fans keyspace events out to the subscriptions of a cache.
+type eventHub struct {
+	mutex         sync.Mutex
+	subscriptions map[*Subscription]struct{}
+	count         atomic.Int32 // Lets writes skip building events nobody listens to
+}
+
+// Subscribe starts receiving the keyspace events selected by filter, with room
+// for buffer events that have not been read yet.
+func (c *Cache) Subscribe(filter EventFilter, buffer int) *Subscription {
+	events := make(chan Event, max(buffer, 1))
+	sub := &Subscription{Events: events, hub: &c.events, events: events, filter: filter}
+
+	c.events.mutex.Lock()
+	defer c.events.mutex.Unlock()
+
+	if c.events.subscriptions == nil {
+		c.events.subscriptions = make(map[*Subscription]struct{})
+	}
+	c.events.subscriptions[sub] = struct{}{}
+	c.events.count.Add(1)
+	return sub
+}
+
+func (h *eventHub) remove(sub *Subscription) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, exists := h.subscriptions[sub]; exists {
+		delete(h.subscriptions, sub)
+		h.count.Add(-1)
+		close(sub.events)
+	}
+}
+
+// notify sends an event to the subscribers that want it without ever blocking
+// the write that caused it.
+func (c *Cache) notify(op string, reason string, key string) {
+	if c.events.count.Load() == 0 {
+		return
+	}
+	event := Event{Namespace: c.namespace, Key: key, Op: op, Reason: reason, Timestamp: time.Now()}
+
+	c.events.mutex.Lock()
+	defer c.events.mutex.Unlock()
+
+	for sub := range c.events.subscriptions {
+		if !sub.filter.matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			sub.dropped.Store(true)
+			delete(c.events.subscriptions, sub)
+			c.events.count.Add(-1)
+			close(sub.events)
+		}
+	}
+}
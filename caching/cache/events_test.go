@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// nextEvent returns the next event of a subscription, failing when none
+// arrives within a second.
+func nextEvent(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case event, ok := <-sub.Events:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return Event{}
+}
+
+func TestKeyspaceEvents(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+	sub := c.Subscribe(EventFilter{}, 16)
+	defer sub.Close()
+
+	if err := c.Set("key", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete("key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("other", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ResetCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ op, reason, key string }{
+		{EventSet, string(CMDSet), "key"},
+		{EventDel, string(CMDDel), "key"},
+		{EventSet, string(CMDSet), "other"},
+		{EventFlush, string(CMDFlushAll), ""},
+	}
+	for _, expected := range want {
+		event := nextEvent(t, sub)
+		if event.Op != expected.op || event.Reason != expected.reason || event.Key != expected.key {
+			t.Fatalf("event = %+v, want %s %s of %q", event, expected.op, expected.reason, expected.key)
+		}
+		if time.Since(event.Timestamp) > time.Second {
+			t.Fatalf("event timestamp %v is not recent", event.Timestamp)
+		}
+	}
+}
+
+func TestExpiredAndEvictedEvents(t *testing.T) {
+	c := NewCacheWithOptions(Options{MaxEntries: 1, Shards: 1})
+	defer c.Close()
+	sub := c.Subscribe(EventFilter{Ops: []string{EventExpired, EventEvicted}}, 16)
+	defer sub.Close()
+
+	if err := c.Set("old", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("new", []byte("v"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, sub); event.Op != EventEvicted || event.Key != "old" || event.Reason != evictedForCapacity {
+		t.Fatalf("event = %+v, want old evicted for capacity", event)
+	}
+	if event := nextEvent(t, sub); event.Op != EventExpired || event.Key != "new" {
+		t.Fatalf("event = %+v, want new expired", event)
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+	sub := c.Subscribe(EventFilter{Match: "user:*", Ops: []string{EventDel}}, 16)
+	defer sub.Close()
+
+	for _, key := range []string{"user:1", "order:1"} {
+		if err := c.Set(key, []byte("v"), 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Delete(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if event := nextEvent(t, sub); event.Op != EventDel || event.Key != "user:1" {
+		t.Fatalf("event = %+v, want del of user:1", event)
+	}
+	select {
+	case event := <-sub.Events:
+		t.Fatalf("unexpected event %+v", event)
+	default:
+	}
+
+	if err := (EventFilter{Ops: []string{"renamed"}}).Validate(); err == nil {
+		t.Fatal("Validate accepted an unknown event type")
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+	slow := c.Subscribe(EventFilter{}, 2)
+	fast := c.Subscribe(EventFilter{}, 100)
+
+	for i := 0; i < 10; i++ {
+		if err := c.Set("key:"+strconv.Itoa(i), []byte("v"), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Writes never wait for the slow subscriber, which is closed instead
+	received := 0
+	for range slow.Events {
+		received++
+	}
+	if received != 2 || !slow.Dropped() {
+		t.Fatalf("slow subscriber received %d events, dropped = %v, want 2 and dropped", received, slow.Dropped())
+	}
+	if len(fast.Events) != 10 || fast.Dropped() {
+		t.Fatalf("fast subscriber has %d events, dropped = %v, want 10", len(fast.Events), fast.Dropped())
+	}
+
+	// Closing ends the subscription once the buffered events are read
+	fast.Close()
+	received = 0
+	for range fast.Events {
+		received++
+	}
+	if received != 10 {
+		t.Fatalf("fast subscriber read %d events after closing, want 10", received)
+	}
+}
+
+func TestSlaveReportsReplicatedExpiry(t *testing.T) {
+	master := NewCache()
+	defer master.Close()
+	records := recordWrites(master)
+
+	if err := master.Set("session", []byte("v"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the key to expire", func() bool {
+		written := records()
+		return written[len(written)-1] == formatRecord(string(aofExpired), "session")
+	})
+
+	// The slave holds the key without a TTL, so only the record can expire it
+	slave := NewCache()
+	defer slave.Close()
+	if err := slave.ApplyRecord(formatRecord(string(CMDSet), "session", "v")); err != nil {
+		t.Fatal(err)
+	}
+	sub := slave.Subscribe(EventFilter{}, 16)
+	defer sub.Close()
+	written := records()
+	if err := slave.ApplyRecord(written[len(written)-1]); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, sub); event.Op != EventExpired || event.Key != "session" || event.Reason != expiredForTTL {
+		t.Fatalf("slave event = %+v, want session expired", event)
+	}
+	if stats := slave.Stats(); stats.Size != 0 || stats.Expirations != 1 {
+		t.Fatalf("slave size, expirations = %d, %d, want 0, 1", stats.Size, stats.Expirations)
+	}
+}
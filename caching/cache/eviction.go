@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"container/heap"
+	"fmt"
+	"strings"
+)
+
+// Names of the supported eviction policies, as used in config.yml.
+const (
+	PolicyLRU     = "lru"
+	PolicyLFU     = "lfu"
+	PolicyARC     = "arc"
+	PolicyTinyLFU = "tinylfu"
+)
+
+// EvictionPolicy decides which entry leaves the cache once it is over its limits.
+// Implementations are not safe for concurrent use; the Cache serializes access.
+type EvictionPolicy interface {
+	// Name returns the configuration name of the policy.
+	Name() string
+	// Add tracks a newly inserted node.
+	Add(node *Node)
+	// Access records a hit or an update of a tracked node.
+	Access(node *Node)
+	// Remove stops tracking a node that was deleted from the cache.
+	Remove(node *Node)
+	// Victim detaches and returns the next node to evict, or nil when empty.
+	Victim() *Node
+	// Keys returns the tracked keys, the ones kept longest first.
+	Keys() []string
+	// Reset forgets every tracked node.
+	Reset()
+}
+
+// NewEvictionPolicy creates the policy with the given name. Capacity is the
+// expected maximum number of entries and may be 0 when the cache is unbounded.
+func NewEvictionPolicy(name string, capacity int) (EvictionPolicy, error) {
+	switch strings.ToLower(name) {
+	case "", PolicyLRU:
+		return newLRUPolicy(), nil
+	case PolicyLFU:
+		return newLFUPolicy(), nil
+	case PolicyARC:
+		return newARCPolicy(capacity), nil
+	case PolicyTinyLFU, "w-tinylfu":
+		return newTinyLFUPolicy(capacity), nil
+	default:
+		return nil, fmt.Errorf("unknown eviction policy %q", name)
+	}
+}
+
+// EvictionPolicies returns the names of all supported eviction policies.
+func EvictionPolicies() []string {
+	return []string{PolicyLRU, PolicyLFU, PolicyARC, PolicyTinyLFU}
+}
+
+// lruPolicy evicts the least recently used entry using the doubly linked Queue.
+type lruPolicy struct {
+	queue *Queue
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{queue: NewQueue()}
+}
+
+func (p *lruPolicy) Name() string { return PolicyLRU }
+
+func (p *lruPolicy) Add(node *Node) {
+	p.queue.AddToFront(node)
+}
+
+func (p *lruPolicy) Access(node *Node) {
+	p.queue.MoveToFront(node)
+}
+
+func (p *lruPolicy) Remove(node *Node) {
+	p.queue.RemoveNode(node)
+	node.prev = nil
+	node.Next = nil
+}
+
+func (p *lruPolicy) Victim() *Node {
+	node := p.queue.RemoveFromEnd()
+	if node != nil {
+		node.prev = nil
+		node.Next = nil
+	}
+	return node
+}
+
+func (p *lruPolicy) Keys() []string {
+	var keys []string
+	for node := p.queue.Head; node != nil; node = node.Next {
+		keys = append(keys, node.Key)
+	}
+	return keys
+}
+
+func (p *lruPolicy) Reset() {
+	p.queue = NewQueue()
+}
+
+// lfuPolicy evicts the least frequently used entry, breaking ties by recency.
+type lfuPolicy struct {
+	entries map[*Node]*lfuEntry
+	heap    lfuHeap
+	clock   uint64
+}
+
+type lfuEntry struct {
+	node       *Node
+	frequency  uint64
+	lastAccess uint64
+	index      int
+}
+
+// lfuHeap is a min-heap ordered by frequency, then by last access.
+type lfuHeap []*lfuEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].frequency != h[j].frequency {
+		return h[i].frequency < h[j].frequency
+	}
+	return h[i].lastAccess < h[j].lastAccess
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	entry := x.(*lfuEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	entry.index = -1
+	return entry
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{entries: make(map[*Node]*lfuEntry)}
+}
+
+func (p *lfuPolicy) Name() string { return PolicyLFU }
+
+func (p *lfuPolicy) Add(node *Node) {
+	p.clock++
+	entry := &lfuEntry{node: node, frequency: 1, lastAccess: p.clock}
+	p.entries[node] = entry
+	heap.Push(&p.heap, entry)
+}
+
+func (p *lfuPolicy) Access(node *Node) {
+	entry, ok := p.entries[node]
+	if !ok {
+		return
+	}
+	p.clock++
+	entry.frequency++
+	entry.lastAccess = p.clock
+	heap.Fix(&p.heap, entry.index)
+}
+
+func (p *lfuPolicy) Remove(node *Node) {
+	entry, ok := p.entries[node]
+	if !ok {
+		return
+	}
+	heap.Remove(&p.heap, entry.index)
+	delete(p.entries, node)
+}
+
+func (p *lfuPolicy) Victim() *Node {
+	if p.heap.Len() == 0 {
+		return nil
+	}
+	entry := heap.Pop(&p.heap).(*lfuEntry)
+	delete(p.entries, entry.node)
+	return entry.node
+}
+
+func (p *lfuPolicy) Keys() []string {
+	// Copy the heap so draining it leaves the policy untouched
+	h := make(lfuHeap, len(p.heap))
+	for i, entry := range p.heap {
+		copied := *entry
+		h[i] = &copied
+	}
+	keys := make([]string, len(h))
+	for i := len(keys) - 1; i >= 0; i-- {
+		keys[i] = heap.Pop(&h).(*lfuEntry).node.Key
+	}
+	return keys
+}
+
+func (p *lfuPolicy) Reset() {
+	p.entries = make(map[*Node]*lfuEntry)
+	p.heap = nil
+	p.clock = 0
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestEvictionPoliciesTrackNodes(t *testing.T) {
+	for _, name := range EvictionPolicies() {
+		t.Run(name, func(t *testing.T) {
+			policy, err := NewEvictionPolicy(name, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if policy.Name() != name {
+				t.Fatalf("Name = %q, want %q", policy.Name(), name)
+			}
+
+			nodes := make([]*Node, 10)
+			for i := range nodes {
+				nodes[i] = &Node{Key: strconv.Itoa(i)}
+				policy.Add(nodes[i])
+			}
+			for _, node := range nodes[:5] {
+				policy.Access(node)
+			}
+			policy.Remove(nodes[3])
+			if keys := policy.Keys(); len(keys) != 9 {
+				t.Fatalf("Keys = %q, want 9 keys", keys)
+			}
+
+			// Every tracked node comes out once, and the removed one never
+			seen := make(map[string]bool)
+			for victim := policy.Victim(); victim != nil; victim = policy.Victim() {
+				if seen[victim.Key] || victim == nodes[3] {
+					t.Fatalf("Victim returned %q again or after it was removed", victim.Key)
+				}
+				seen[victim.Key] = true
+			}
+			if len(seen) != 9 {
+				t.Fatalf("got %d victims, want 9", len(seen))
+			}
+
+			policy.Add(nodes[0])
+			policy.Reset()
+			if victim := policy.Victim(); victim != nil {
+				t.Fatalf("Victim after Reset = %q, want none", victim.Key)
+			}
+		})
+	}
+}
+
+func TestLFUEvictsLeastFrequent(t *testing.T) {
+	policy, _ := NewEvictionPolicy(PolicyLFU, 3)
+	hot, warm, cold := &Node{Key: "hot"}, &Node{Key: "warm"}, &Node{Key: "cold"}
+	for _, node := range []*Node{hot, warm, cold} {
+		policy.Add(node)
+	}
+	for i := 0; i < 3; i++ {
+		policy.Access(hot)
+	}
+	policy.Access(warm)
+
+	for _, want := range []*Node{cold, warm, hot} {
+		if victim := policy.Victim(); victim != want {
+			t.Fatalf("Victim = %v, want %q", victim, want.Key)
+		}
+	}
+}
+
+func TestUnknownEvictionPolicy(t *testing.T) {
+	if _, err := NewEvictionPolicy("fifo", 10); err == nil {
+		t.Fatal("NewEvictionPolicy of an unknown policy succeeded")
+	}
+	c := NewCacheWithOptions(Options{EvictionPolicy: PolicyARC, MaxEntries: 10})
+	defer c.Close()
+	if c.EvictionPolicy() != PolicyARC {
+		t.Fatalf("EvictionPolicy = %q, want %q", c.EvictionPolicy(), PolicyARC)
+	}
+}
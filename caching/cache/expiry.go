@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"container/heap"
+	"strconv"
+	"time"
+)
+
+// NoExpiry is the TTL reported for keys that never expire.
+const NoExpiry time.Duration = -1
+
+const (
+	activeExpireInterval = 100 * time.Millisecond // How often the active expiry cycle runs
+	activeExpireBatch    = 20                     // Keys expired per batch before checking the time budget
+	activeExpireBudget   = 25 * time.Millisecond  // Longest time a single cycle may hold the cache lock
+)
+
+// expiryHeap is a min-heap of the nodes that carry a TTL, ordered by deadline.
+type expiryHeap []*Node
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].expiryIndex = i
+	h[j].expiryIndex = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	node := x.(*Node)
+	node.expiryIndex = len(*h)
+	*h = append(*h, node)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	node := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	node.expiryIndex = -1
+	return node
+}
+
+// expired reports whether the node has a deadline that has passed.
+func (n *Node) expired(now time.Time) bool {
+	return !n.expiresAt.IsZero() && !now.Before(n.expiresAt)
+}
+
+// scheduleExpiry sets the absolute deadline of a node, rescheduling or
+// cancelling any previous one. A zero deadline removes the expiry.
+// The caller must hold s.mutex.
+func (s *shard) scheduleExpiry(node *Node, deadline time.Time) {
+	node.expiresAt = deadline
+	scheduled := node.expiryIndex >= 0
+
+	switch {
+	case deadline.IsZero() && scheduled:
+		heap.Remove(&s.expiry, node.expiryIndex)
+	case deadline.IsZero():
+		return
+	case scheduled:
+		heap.Fix(&s.expiry, node.expiryIndex)
+	default:
+		heap.Push(&s.expiry, node)
+	}
+}
+
+// aofExpired marks an entry removed because its TTL passed, so the slaves
+// report it as expired rather than deleted.
+const aofExpired Command = "EXPIRED"
+
+// expiredForTTL is the reason of the events of keys whose TTL passed.
+const expiredForTTL = "ttl"
+
+// expireNode removes a node whose TTL has passed. The caller must hold s.mutex.
+func (s *shard) expireNode(node *Node) {
+	s.removeNode(node)
+	s.stats.expirations.Add(1)
+
+	s.cache.writeToAOF(string(aofExpired), node.Key)
+	s.cache.notify(EventExpired, expiredForTTL, node.Key)
+	println(RedColor+"Expired cache with key: ", node.Key, ResetColor)
+}
+
+// runActiveExpiry periodically removes expired keys that are never read again,
+// much like Redis' active expire cycle. Each cycle works in small batches and
+// gives the shard lock back between batches and moves on once its time budget
+// is spent.
+func (c *Cache) runActiveExpiry() {
+	ticker := time.NewTicker(activeExpireInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopExpiry:
+			return
+		case <-ticker.C:
+			c.activeExpireCycle()
+		}
+	}
+}
+
+func (c *Cache) activeExpireCycle() {
+	for _, s := range c.shards {
+		s.activeExpireCycle()
+	}
+}
+
+func (s *shard) activeExpireCycle() {
+	start := time.Now()
+	for time.Since(start) < activeExpireBudget {
+		s.mutex.Lock()
+		now := time.Now()
+		s.expireLocks(now)
+		expired := 0
+		for expired < activeExpireBatch && s.expiry.Len() > 0 && s.expiry[0].expired(now) {
+			s.expireNode(s.expiry[0])
+			expired++
+		}
+		s.mutex.Unlock()
+
+		// Stop once a batch comes back short: nothing else is due
+		if expired < activeExpireBatch {
+			return
+		}
+	}
+}
+
+// Close stops the background expiry and closes the AOF file.
+func (c *Cache) Close() {
+	c.closeOnce.Do(func() { close(c.stopExpiry) })
+	c.CloseAOF()
+}
+
+// TTL returns how long the key has left to live, or NoExpiry when it never expires.
+func (c *Cache) TTL(key string) (time.Duration, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	node, exists := s.lookup(key)
+	if !exists {
+		return 0, ErrNotFound
+	}
+	if node.expiresAt.IsZero() {
+		return NoExpiry, nil
+	}
+	return time.Until(node.expiresAt), nil
+}
+
+// Expire makes the key expire after duration, replacing any previous expiry.
+// A duration that is not positive deletes the key right away.
+func (c *Cache) Expire(key string, duration time.Duration) error {
+	return c.ExpireAt(key, time.Now().Add(duration))
+}
+
+// ExpireAt makes the key expire at deadline, replacing any previous expiry.
+// A deadline that has already passed deletes the key right away.
+func (c *Cache) ExpireAt(key string, deadline time.Time) error {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.expireAt(key, deadline)
+}
+
+// expireAt makes the key expire at deadline. The caller must hold s.mutex.
+func (s *shard) expireAt(key string, deadline time.Time) error {
+	node, exists := s.lookup(key)
+	if !exists {
+		return ErrNotFound
+	}
+
+	if !deadline.After(time.Now()) {
+		s.removeNode(node)
+		s.cache.writeToAOF(string(CMDDel), key)
+		s.cache.notify(EventDel, string(CMDExpire), key)
+		return nil
+	}
+
+	// The record holds the absolute deadline so replaying it late does not extend the TTL
+	s.scheduleExpiry(node, deadline)
+	s.cache.writeNodeRecord(node, expireAtRecord(node)...)
+	return nil
+}
+
+// Persist removes the expiry of the key. It reports false when the key had none.
+func (c *Cache) Persist(key string) (bool, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.persist(key)
+}
+
+// persist removes the expiry of the key. The caller must hold s.mutex.
+func (s *shard) persist(key string) (bool, error) {
+	node, exists := s.lookup(key)
+	if !exists {
+		return false, ErrNotFound
+	}
+	if node.expiresAt.IsZero() {
+		return false, nil
+	}
+
+	s.scheduleExpiry(node, time.Time{})
+	s.cache.writeNodeRecord(node, string(CMDPersist), key)
+	return true, nil
+}
+
+// expireAtRecord returns the record that sets the absolute deadline of a node
+// in Unix milliseconds.
+func expireAtRecord(node *Node) []string {
+	return []string{string(CMDPExpireAt), node.Key, strconv.FormatInt(node.expiresAt.UnixMilli(), 10)}
+}
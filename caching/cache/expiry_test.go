@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// waitFor polls condition until it holds or a second passed.
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestActiveExpiry(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	for i := 0; i < 100; i++ {
+		if err := c.Set("short:"+strconv.Itoa(i), []byte("v"), 20*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Set("long", []byte("v"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("forever", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys nobody reads again are removed by the background cycle
+	waitFor(t, "the short keys to expire", func() bool { return c.Stats().Size == 2 })
+	if expirations := c.Stats().Expirations; expirations != 100 {
+		t.Fatalf("expirations = %d, want 100", expirations)
+	}
+	if _, err := c.Get("long"); err != nil {
+		t.Fatalf("Get of a key with an hour left = %v", err)
+	}
+}
+
+func TestOverwriteReplacesExpiry(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	if err := c.Set("key", []byte("v1"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("key", []byte("v2"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("gone", []byte("v"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if value, err := c.Get("key"); err != nil || string(value) != "v2" {
+		t.Fatalf("Get = %q, %v, want v2 without expiry", value, err)
+	}
+	// Reading an expired key removes it even before the background cycle runs
+	if _, err := c.Get("gone"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of an expired key = %v, want ErrNotFound", err)
+	}
+}
+
+func TestExpireAndPersist(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	if err := c.Set("key", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, err := c.TTL("key"); err != nil || ttl != NoExpiry {
+		t.Fatalf("TTL = %v, %v, want NoExpiry", ttl, err)
+	}
+	if err := c.Expire("key", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, err := c.TTL("key"); err != nil || ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Fatalf("TTL after Expire = %v, %v, want about an hour", ttl, err)
+	}
+
+	// Shortening the expiry takes effect
+	if err := c.Expire("key", 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the key to expire", func() bool { return !c.Has("key") })
+
+	if err := c.Set("kept", []byte("v"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := c.Persist("kept"); err != nil || !removed {
+		t.Fatalf("Persist = %v, %v, want true", removed, err)
+	}
+	if removed, err := c.Persist("kept"); err != nil || removed {
+		t.Fatalf("Persist of a key without expiry = %v, %v, want false", removed, err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, err := c.Get("kept"); err != nil {
+		t.Fatalf("Get of a persisted key = %v", err)
+	}
+
+	if _, err := c.TTL("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("TTL of a missing key = %v, want ErrNotFound", err)
+	}
+	if err := c.Expire("missing", time.Hour); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expire of a missing key = %v, want ErrNotFound", err)
+	}
+}
+
+func TestExpireAtInThePastDeletes(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+	records := recordWrites(c)
+
+	if err := c.Set("key", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ExpireAt("key", time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if c.Has("key") {
+		t.Fatal("key with a passed deadline still exists")
+	}
+	written := records()
+	if last := written[len(written)-1]; last != "DEL key" {
+		t.Fatalf("last record = %q, want DEL key", last)
+	}
+}
+
+func TestSlaveFollowsExpiryChanges(t *testing.T) {
+	master := NewCache()
+	defer master.Close()
+	records := recordWrites(master)
+
+	if err := master.Set("extended", []byte("v"), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := master.Expire("extended", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := master.Set("persisted", []byte("v"), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := master.Persist("persisted"); err != nil {
+		t.Fatal(err)
+	}
+
+	slave := NewCache()
+	defer slave.Close()
+	for _, record := range records() {
+		if err := slave.ApplyRecord(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ttl, err := slave.TTL("extended"); err != nil || ttl <= 59*time.Minute {
+		t.Fatalf("slave TTL = %v, %v, want about an hour", ttl, err)
+	}
+	if ttl, err := slave.TTL("persisted"); err != nil || ttl != NoExpiry {
+		t.Fatalf("slave TTL = %v, %v, want NoExpiry", ttl, err)
+	}
+}
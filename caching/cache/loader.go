@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNoValue is returned by loaders when the key has no value in the system of
+// record, and by GetOrLoad for such keys. GetOrLoad can remember it for a
+// while so a missing key does not hit the source on every read.
+var ErrNoValue = errors.New("no value for key")
+
+// Loader fetches the value of a key that is missing from the cache, from the
+// system of record the cache sits in front of.
+type Loader interface {
+	Load(key string) ([]byte, error)
+}
+
+// LoaderFunc adapts a function to the Loader interface.
+type LoaderFunc func(key string) ([]byte, error)
+
+// Load calls f(key).
+func (f LoaderFunc) Load(key string) ([]byte, error) {
+	return f(key)
+}
+
+// LoadError is returned by GetOrLoad when the loader failed, so callers can
+// tell a failing source from a key that has no value.
+type LoadError struct {
+	Key string
+	Err error
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("loading key %s: %v", e.Key, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// LoadOptions tells GetOrLoad how long to cache what the loader returns.
+type LoadOptions struct {
+	TTL         time.Duration // How long loaded values are cached, 0 keeps them until evicted
+	NegativeTTL time.Duration // How long ErrNoValue is remembered, 0 never remembers it
+}
+
+// loadGroup coalesces concurrent loads of a key and remembers the keys that
+// have no value. Negative results are local to the node and never replicated.
+type loadGroup struct {
+	mutex     sync.Mutex
+	calls     map[string]*loadCall
+	negative  map[string]time.Time // Key to the time its negative result expires
+	sweepSize int                  // Size of negative that triggers the next sweep
+}
+
+// loadCall is a load in flight. Done is closed once value and err are set.
+type loadCall struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+// GetOrLoad returns the string stored under key. On a miss it calls loader and
+// caches the value for opts.TTL; concurrent misses of the same key wait for a
+// single load. A loader returning ErrNoValue makes GetOrLoad return ErrNoValue,
+// remembered for opts.NegativeTTL, and any other loader error is returned as a
+// *LoadError and never cached.
+func (c *Cache) GetOrLoad(key string, loader Loader, opts LoadOptions) ([]byte, error) {
+	value, err := c.Get(key)
+	if err == nil || errors.Is(err, ErrWrongType) {
+		return value, err
+	}
+
+	c.loads.mutex.Lock()
+	if expiresAt, exists := c.loads.negative[key]; exists {
+		if time.Now().Before(expiresAt) {
+			c.loads.mutex.Unlock()
+			return nil, ErrNoValue
+		}
+		delete(c.loads.negative, key)
+	}
+	if call, exists := c.loads.calls[key]; exists {
+		c.loads.mutex.Unlock()
+		<-call.done
+		return call.value, call.err
+	}
+	call := &loadCall{done: make(chan struct{})}
+	if c.loads.calls == nil {
+		c.loads.calls = make(map[string]*loadCall)
+	}
+	c.loads.calls[key] = call
+	c.loads.mutex.Unlock()
+
+	call.value, call.err = c.load(key, loader, opts)
+
+	c.loads.mutex.Lock()
+	delete(c.loads.calls, key)
+	c.loads.mutex.Unlock()
+	close(call.done)
+
+	return call.value, call.err
+}
+
+// load runs the loader and caches its outcome. A panicking loader is reported
+// as a *LoadError so the callers waiting on the load are released.
+func (c *Cache) load(key string, loader Loader, opts LoadOptions) (value []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			value, err = nil, &LoadError{Key: key, Err: fmt.Errorf("loader panicked: %v", r)}
+		}
+	}()
+
+	println(GreenColor+"Loading cache for key: ", key, ResetColor)
+	value, err = loader.Load(key)
+	switch {
+	case err == nil:
+		if err := c.Set(key, value, opts.TTL); err != nil {
+			// The value is still good to return, it just could not be cached
+			println(RedColor+"Error caching loaded key: ", key, err.Error(), ResetColor)
+		}
+		return value, nil
+
+	case errors.Is(err, ErrNoValue):
+		if opts.NegativeTTL > 0 {
+			c.loads.rememberMissing(key, time.Now().Add(opts.NegativeTTL))
+		}
+		return nil, ErrNoValue
+
+	default:
+		return nil, &LoadError{Key: key, Err: err}
+	}
+}
+
+// rememberMissing records that key has no value until expiresAt. Expired
+// entries are swept whenever the map doubled since the last sweep.
+func (g *loadGroup) rememberMissing(key string, expiresAt time.Time) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.negative == nil {
+		g.negative = make(map[string]time.Time)
+	}
+	g.negative[key] = expiresAt
+
+	if len(g.negative) < g.sweepSize {
+		return
+	}
+	now := time.Now()
+	for key, expiresAt := range g.negative {
+		if !now.Before(expiresAt) {
+			delete(g.negative, key)
+		}
+	}
+	g.sweepSize = max(2*len(g.negative), 64)
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrLoadCoalescesMisses(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	var loads atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loader := LoaderFunc(func(key string) ([]byte, error) {
+		if loads.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return []byte("loaded " + key), nil
+	})
+
+	var wg sync.WaitGroup
+	values := make([][]byte, 20)
+	errs := make([]error, 20)
+	for i := range values {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values[i], errs[i] = c.GetOrLoad("user:1", loader, LoadOptions{TTL: time.Hour})
+		}(i)
+	}
+	<-started
+	// Let the other readers pile up behind the load in flight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("loader called %d times, want 1", n)
+	}
+	for i := range values {
+		if errs[i] != nil || string(values[i]) != "loaded user:1" {
+			t.Fatalf("GetOrLoad = %q, %v, want the loaded value", values[i], errs[i])
+		}
+	}
+	if ttl, err := c.TTL("user:1"); err != nil || ttl <= 59*time.Minute {
+		t.Fatalf("TTL of the loaded key = %v, %v, want about an hour", ttl, err)
+	}
+}
+
+func TestGetOrLoadErrors(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	var loads atomic.Int32
+	failure := errors.New("database down")
+	failing := LoaderFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		return nil, failure
+	})
+
+	// Loader errors are told apart from misses and never cached
+	for i := 0; i < 2; i++ {
+		_, err := c.GetOrLoad("key", failing, LoadOptions{NegativeTTL: time.Hour})
+		var loadErr *LoadError
+		if !errors.As(err, &loadErr) || !errors.Is(err, failure) || loadErr.Key != "key" {
+			t.Fatalf("GetOrLoad with a failing loader = %v, want a *LoadError wrapping it", err)
+		}
+	}
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("failing loader called %d times, want 2", n)
+	}
+	if c.Has("key") {
+		t.Fatal("a failed load was cached")
+	}
+
+	panicking := LoaderFunc(func(key string) ([]byte, error) { panic("boom") })
+	var loadErr *LoadError
+	if _, err := c.GetOrLoad("key", panicking, LoadOptions{}); !errors.As(err, &loadErr) {
+		t.Fatalf("GetOrLoad with a panicking loader = %v, want a *LoadError", err)
+	}
+}
+
+func TestGetOrLoadNegativeTTL(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	var loads atomic.Int32
+	missing := LoaderFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		return nil, ErrNoValue
+	})
+	opts := LoadOptions{NegativeTTL: 50 * time.Millisecond}
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetOrLoad("ghost", missing, opts); !errors.Is(err, ErrNoValue) {
+			t.Fatalf("GetOrLoad of a key without value = %v, want ErrNoValue", err)
+		}
+	}
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("loader called %d times within the negative TTL, want 1", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := c.GetOrLoad("ghost", missing, opts); !errors.Is(err, ErrNoValue) {
+		t.Fatal(err)
+	}
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("loader called %d times after the negative TTL, want 2", n)
+	}
+
+	// Without a negative TTL every read asks the loader again
+	if _, err := c.GetOrLoad("other", missing, LoadOptions{}); !errors.Is(err, ErrNoValue) {
+		t.Fatal(err)
+	}
+	if _, err := c.GetOrLoad("other", missing, LoadOptions{}); !errors.Is(err, ErrNoValue) {
+		t.Fatal(err)
+	}
+	if n := loads.Load(); n != 4 {
+		t.Fatalf("loader called %d times, want 4", n)
+	}
+}
@@ -0,0 +1,215 @@
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Locks are held by an owner for a lease, after which they are free again
+// without anyone deleting them: an expired lock is simply not held, so a late
+// release or expiry can never drop a lock somebody acquired since. Only the
+// owner token returned by AcquireLock renews or releases a lock.
+//
+// Every acquisition also gets a fencing token, drawn from a counter shared by
+// the whole cache, so tokens only ever grow. A lock holder passes its token
+// along with its writes to the protected resource, which refuses tokens lower
+// than one it has already seen, so a holder whose lease ran out while it was
+// paused cannot overwrite the work of the next one.
+//
+// Locks live apart from the keys: they are never evicted, flushing the cache
+// keeps them and scans do not return them. They are written to the AOF and
+// replicated as:
+//
+//	LOCK <name> <owner> <token> <deadline-ms>
+//	UNLOCK <name> <owner>
+//	LOCKTOKEN <token>
+//
+// LOCK both acquires and renews, the deadline being absolute. LOCKTOKEN keeps
+// the last fencing token in snapshots, so tokens keep growing after a restart
+// even when no lock is held.
+
+const aofLockToken Command = "LOCKTOKEN"
+
+var (
+	// ErrLocked is returned when acquiring a lock that another owner holds.
+	ErrLocked = errors.New("lock is held by another owner")
+
+	// ErrNotLockOwner is returned when renewing or releasing a lock that the
+	// owner does not hold, because it was released, its lease ran out or it
+	// was acquired by someone else since.
+	ErrNotLockOwner = errors.New("lock is not held by this owner")
+
+	// ErrInvalidLease is returned for leases that are not positive.
+	ErrInvalidLease = errors.New("lease must be positive")
+)
+
+// Lock is a lock held by Owner until ExpiresAt.
+type Lock struct {
+	Name      string
+	Owner     string    // Secret that renews and releases the lock
+	Token     uint64    // Fencing token of the acquisition
+	ExpiresAt time.Time // End of the lease
+}
+
+type lockState struct {
+	owner     string
+	token     uint64
+	expiresAt time.Time
+}
+
+// heldLock returns the lock of the given name if its lease has not run out,
+// forgetting it otherwise. The caller must hold s.mutex.
+func (s *shard) heldLock(name string, now time.Time) (*lockState, bool) {
+	lock, exists := s.locks[name]
+	if !exists {
+		return nil, false
+	}
+	if !now.Before(lock.expiresAt) {
+		delete(s.locks, name)
+		return nil, false
+	}
+	return lock, true
+}
+
+// AcquireLock acquires the lock of the given name for lease, unless another
+// owner holds it, and returns it with a new owner token and fencing token.
+func (c *Cache) AcquireLock(name string, lease time.Duration) (Lock, error) {
+	if lease <= 0 {
+		return Lock{}, ErrInvalidLease
+	}
+	owner, err := newLockOwner()
+	if err != nil {
+		return Lock{}, err
+	}
+
+	s := c.shardFor(name)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if _, held := s.heldLock(name, now); held {
+		return Lock{}, ErrLocked
+	}
+	lock := &lockState{owner: owner, token: c.lockTokens.Add(1), expiresAt: now.Add(lease)}
+	s.setLock(name, lock)
+
+	return Lock{Name: name, Owner: owner, Token: lock.token, ExpiresAt: lock.expiresAt}, nil
+}
+
+// RenewLock extends the lease of a lock the owner holds to lease from now. The
+// fencing token stays the same.
+func (c *Cache) RenewLock(name string, owner string, lease time.Duration) (Lock, error) {
+	if lease <= 0 {
+		return Lock{}, ErrInvalidLease
+	}
+
+	s := c.shardFor(name)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	lock, held := s.heldLock(name, now)
+	if !held || lock.owner != owner {
+		return Lock{}, ErrNotLockOwner
+	}
+	renewed := &lockState{owner: owner, token: lock.token, expiresAt: now.Add(lease)}
+	s.setLock(name, renewed)
+
+	return Lock{Name: name, Owner: owner, Token: renewed.token, ExpiresAt: renewed.expiresAt}, nil
+}
+
+// ReleaseLock releases a lock the owner holds.
+func (c *Cache) ReleaseLock(name string, owner string) error {
+	s := c.shardFor(name)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	lock, held := s.heldLock(name, time.Now())
+	if !held || lock.owner != owner {
+		return ErrNotLockOwner
+	}
+	delete(s.locks, name)
+	s.cache.writeToAOF(string(CMDUnlock), name, owner)
+	return nil
+}
+
+// setLock stores a lock and writes its record. The caller must hold s.mutex.
+func (s *shard) setLock(name string, lock *lockState) {
+	s.locks[name] = lock
+	s.cache.writeToAOF(string(CMDLock), name, lock.owner, strconv.FormatUint(lock.token, 10), strconv.FormatInt(lock.expiresAt.UnixMilli(), 10))
+}
+
+// newLockOwner returns a random owner token.
+func newLockOwner() (string, error) {
+	owner := make([]byte, 16)
+	if _, err := rand.Read(owner); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(owner), nil
+}
+
+// observeLockToken makes sure fencing tokens handed out later are above token.
+func (c *Cache) observeLockToken(token uint64) {
+	for {
+		current := c.lockTokens.Load()
+		if current >= token || c.lockTokens.CompareAndSwap(current, token) {
+			return
+		}
+	}
+}
+
+// expireLocks forgets the locks whose lease ran out. The caller must hold s.mutex.
+func (s *shard) expireLocks(now time.Time) {
+	for name := range s.locks {
+		s.heldLock(name, now)
+	}
+}
+
+// applyLockCommand replays the records of locks. The caller must hold s.mutex.
+func (s *shard) applyLockCommand(command Command, args []string) error {
+	switch {
+	case command == CMDLock && len(args) == 4:
+		token, err := strconv.ParseUint(args[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid token in LOCK record: %v", err)
+		}
+		deadline, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid deadline in LOCK record: %v", err)
+		}
+		s.cache.observeLockToken(token)
+		s.setLock(args[0], &lockState{owner: args[1], token: token, expiresAt: time.UnixMilli(deadline)})
+		return nil
+
+	case command == CMDUnlock && len(args) == 2:
+		if lock, exists := s.locks[args[0]]; exists && lock.owner == args[1] {
+			delete(s.locks, args[0])
+			s.cache.writeToAOF(string(CMDUnlock), args[0], args[1])
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("invalid record: %s", formatRecord(append([]string{string(command)}, args...)...))
+	}
+}
+
+// dumpLocks returns the records that recreate the last fencing token and the
+// locks still held. The caller must hold every shard lock.
+func (c *Cache) dumpLocks(now time.Time) [][]string {
+	var records [][]string
+	if token := c.lockTokens.Load(); token > 0 {
+		records = append(records, []string{string(aofLockToken), strconv.FormatUint(token, 10)})
+	}
+	for _, s := range c.shards {
+		for name := range s.locks {
+			if lock, held := s.heldLock(name, now); held {
+				records = append(records, []string{string(CMDLock), name, lock.owner, strconv.FormatUint(lock.token, 10), strconv.FormatInt(lock.expiresAt.UnixMilli(), 10)})
+			}
+		}
+	}
+	return records
+}
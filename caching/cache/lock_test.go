@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFlushKeepsLocks(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	lock, err := c.AcquireLock("deploy", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ResetCache(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ApplyRecord("FLUSHALL"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.AcquireLock("deploy", time.Minute); !errors.Is(err, ErrLocked) {
+		t.Fatalf("AcquireLock after a flush = %v, want ErrLocked", err)
+	}
+	if err := c.ReleaseLock("deploy", "someone else"); !errors.Is(err, ErrNotLockOwner) {
+		t.Fatalf("ReleaseLock by another owner = %v, want ErrNotLockOwner", err)
+	}
+	if err := c.ReleaseLock("deploy", lock.Owner); err != nil {
+		t.Fatalf("ReleaseLock by the owner = %v", err)
+	}
+
+	next, err := c.AcquireLock("deploy", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Token <= lock.Token {
+		t.Fatalf("token after a flush = %d, want above %d", next.Token, lock.Token)
+	}
+}
+
+func TestFencingTokensIncrease(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	// Concurrent holders of different locks never share a token
+	var mutex sync.Mutex
+	seen := make(map[uint64]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				lock, err := c.AcquireLock(name, time.Minute)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mutex.Lock()
+				if seen[lock.Token] {
+					t.Errorf("token %d handed out twice", lock.Token)
+				}
+				seen[lock.Token] = true
+				mutex.Unlock()
+				if err := c.ReleaseLock(name, lock.Owner); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(string(rune('a' + i)))
+	}
+	wg.Wait()
+
+	// An expired lease frees the lock for the next holder, with a greater token
+	first, err := c.AcquireLock("job", 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	second, err := c.AcquireLock("job", time.Minute)
+	if err != nil {
+		t.Fatalf("AcquireLock after the lease ran out = %v", err)
+	}
+	if second.Token <= first.Token {
+		t.Fatalf("token %d after %d, want it greater", second.Token, first.Token)
+	}
+	if _, err := c.RenewLock("job", first.Owner, time.Minute); !errors.Is(err, ErrNotLockOwner) {
+		t.Fatalf("RenewLock by the expired holder = %v, want ErrNotLockOwner", err)
+	}
+
+	// A replica starting from a snapshot keeps handing out greater tokens
+	replica := NewCache()
+	defer replica.Close()
+	for _, record := range c.Dump() {
+		if err := replica.ApplyRecord(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	third, err := replica.AcquireLock("other", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.Token <= second.Token {
+		t.Fatalf("token %d on the replica after %d, want it greater", third.Token, second.Token)
+	}
+}
+
+func TestLockTokenRecordDuringTransactions(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+	c.SetReplicationHook(func(string) {})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 200; i++ {
+			if err := c.ApplyRecord("LOCKTOKEN " + strconv.Itoa(i)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			tx := c.Multi()
+			tx.Set("key", []byte(strconv.Itoa(i)), 0)
+			if _, err := tx.Exec(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	if token := c.lockTokens.Load(); token != 200 {
+		t.Fatalf("last fencing token = %d, want 200", token)
+	}
+}
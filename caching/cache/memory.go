@@ -0,0 +1,196 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Names of the maxmemory policies, chosen with Options.MaxMemoryPolicy.
+const (
+	MaxMemoryNoEviction    = "noeviction"     // Reject writes once the limit is reached
+	MaxMemoryAllKeysLRU    = "allkeys-lru"    // Evict the least recently used keys
+	MaxMemoryVolatileLRU   = "volatile-lru"   // Evict the least recently used keys that have a TTL
+	MaxMemoryAllKeysRandom = "allkeys-random" // Evict random keys
+	MaxMemoryVolatileTTL   = "volatile-ttl"   // Evict the keys closest to expiring
+)
+
+const (
+	// nodeOverhead approximates what a key costs besides its name and value:
+	// the node itself and its entries in the map, scan index, eviction policy and
+	// expiry heap.
+	nodeOverhead = int64(unsafe.Sizeof(Node{})) + 64
+
+	// elementOverhead approximates the bookkeeping of one element of a hash,
+	// list, set or sorted set.
+	elementOverhead = 16
+
+	// maxMemorySamples is how many keys the LRU policies compare to pick a
+	// victim, like Redis' maxmemory-samples.
+	maxMemorySamples = 5
+)
+
+// ErrOutOfMemory is returned for writes refused because the cache reached
+// its maxmemory limit and its policy could not free enough memory. It
+// matches ErrFull.
+var ErrOutOfMemory error = fullError("OOM command not allowed when used memory > 'maxmemory'")
+
+// MaxMemoryPolicies returns the names of the supported maxmemory policies.
+func MaxMemoryPolicies() []string {
+	return []string{MaxMemoryNoEviction, MaxMemoryAllKeysLRU, MaxMemoryVolatileLRU, MaxMemoryAllKeysRandom, MaxMemoryVolatileTTL}
+}
+
+// validMaxMemoryPolicy returns the policy to use for name, which defaults to noeviction.
+func validMaxMemoryPolicy(name string) (string, error) {
+	if name == "" {
+		return MaxMemoryNoEviction, nil
+	}
+	for _, policy := range MaxMemoryPolicies() {
+		if name == policy {
+			return name, nil
+		}
+	}
+	return MaxMemoryNoEviction, fmt.Errorf("unknown maxmemory policy %q", name)
+}
+
+// memoryCounter tracks used memory and its high-water mark.
+type memoryCounter struct {
+	used atomic.Int64
+	peak atomic.Int64
+}
+
+func (m *memoryCounter) add(delta int64) {
+	used := m.used.Add(delta)
+	for {
+		peak := m.peak.Load()
+		if used <= peak || m.peak.CompareAndSwap(peak, used) {
+			return
+		}
+	}
+}
+
+// entryMemory returns the memory accounted to a key holding data of the given
+// size and element count.
+func entryMemory(key string, size int64, elements int) int64 {
+	return nodeOverhead + int64(len(key)) + size + elementOverhead*int64(elements)
+}
+
+// elementCount returns the number of elements of a container, 0 for strings.
+func elementCount(data interface{}) int {
+	switch v := data.(type) {
+	case hashValue:
+		return len(v)
+	case *listValue:
+		return len(*v)
+	case setValue:
+		return len(v)
+	case zsetValue:
+		return len(v)
+	case *streamValue:
+		return len(v.entries)
+	default:
+		return 0
+	}
+}
+
+// MemoryUsage returns the memory accounted to key, in bytes.
+func (c *Cache) MemoryUsage(key string) (int64, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	node, exists := s.lookup(key)
+	if !exists {
+		return 0, ErrNotFound
+	}
+	return node.memory, nil
+}
+
+// touch records an access to a node. The caller must hold s.mutex.
+func (s *shard) touch(node *Node) {
+	node.accessedAt = time.Now().UnixNano()
+	s.policy.Access(node)
+}
+
+// addMemory accounts a change of memory to the shard, its cache and the node
+// the cache lives in. The caller must hold s.mutex.
+func (s *shard) addMemory(delta int64) {
+	s.stats.usedMemory.Add(delta)
+	s.cache.memory.add(delta)
+	s.cache.nodeMemory.add(delta)
+}
+
+// refreshMemory recomputes the memory accounted to a node after its data or
+// size changed. The caller must hold s.mutex.
+func (s *shard) refreshMemory(node *Node) {
+	memory := entryMemory(node.Key, node.size, elementCount(node.Data))
+	s.addMemory(memory - node.memory)
+	node.memory = memory
+}
+
+// reserveMemory makes room for a write that grows memory by extra bytes,
+// evicting keys as the maxmemory policy says. It fails with ErrOutOfMemory
+// when the policy is noeviction or finds nothing left to evict. Writes are not
+// refused while the AOF is replayed. The caller must hold s.mutex.
+func (s *shard) reserveMemory(extra int64) error {
+	if s.maxMemory <= 0 || s.cache.aof.replaying.Load() {
+		return nil
+	}
+
+	for s.stats.usedMemory.Load()+extra > s.maxMemory {
+		victim := s.memoryVictim()
+		if victim == nil {
+			return ErrOutOfMemory
+		}
+		s.removeNode(victim)
+		s.evicted(victim, evictedForMaxMemory)
+	}
+	return nil
+}
+
+// memoryVictim picks the key the maxmemory policy evicts next, or nil when it
+// evicts nothing. The caller must hold s.mutex.
+func (s *shard) memoryVictim() *Node {
+	switch s.maxMemoryPolicy {
+	case MaxMemoryAllKeysLRU:
+		var victim *Node
+		sampled := 0
+		// Map iteration starts at a random key, so these are close to a random sample
+		for _, node := range s.items {
+			if victim == nil || node.accessedAt < victim.accessedAt {
+				victim = node
+			}
+			if sampled++; sampled == maxMemorySamples {
+				break
+			}
+		}
+		return victim
+
+	case MaxMemoryVolatileLRU:
+		var victim *Node
+		for i := 0; i < maxMemorySamples && len(s.expiry) > 0; i++ {
+			node := s.expiry[rand.Intn(len(s.expiry))]
+			if victim == nil || node.accessedAt < victim.accessedAt {
+				victim = node
+			}
+		}
+		return victim
+
+	case MaxMemoryAllKeysRandom:
+		for _, node := range s.items {
+			return node
+		}
+		return nil
+
+	case MaxMemoryVolatileTTL:
+		if len(s.expiry) > 0 {
+			return s.expiry[0]
+		}
+		return nil
+
+	default:
+		return nil
+	}
+}
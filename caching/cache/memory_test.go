@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMemoryAccounting(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	value := bytes.Repeat([]byte("x"), 1000)
+	if err := c.Set("key", value, 0); err != nil {
+		t.Fatal(err)
+	}
+	usage, err := c.MemoryUsage("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := entryMemory("key", 1000, 0); usage != want {
+		t.Fatalf("MemoryUsage = %d, want %d", usage, want)
+	}
+	if used := c.Stats().UsedMemory; used != usage {
+		t.Fatalf("UsedMemory = %d, want %d", used, usage)
+	}
+
+	// Elements of containers are accounted for
+	if _, err := c.SAdd("set", "a", "b", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if usage, err := c.MemoryUsage("set"); err != nil || usage < entryMemory("set", 3, 3) {
+		t.Fatalf("MemoryUsage of a set = %d, %v, want at least %d", usage, err, entryMemory("set", 3, 3))
+	}
+
+	peak := c.Stats().PeakMemory
+	if err := c.Delete("key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete("set"); err != nil {
+		t.Fatal(err)
+	}
+	stats := c.Stats()
+	if stats.UsedMemory != 0 || stats.PeakMemory != peak {
+		t.Fatalf("after deleting everything used = %d, peak = %d, want 0 and %d", stats.UsedMemory, stats.PeakMemory, peak)
+	}
+}
+
+func TestMaxMemoryNoEviction(t *testing.T) {
+	c := NewCacheWithOptions(Options{Shards: 1, MaxMemory: 4 * entryMemory("key:0", 100, 0)})
+	defer c.Close()
+
+	value := bytes.Repeat([]byte("x"), 100)
+	for i := 0; i < 4; i++ {
+		if err := c.Set("key:"+strconv.Itoa(i), value, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := c.Set("key:4", value, 0)
+	if !errors.Is(err, ErrOutOfMemory) || !errors.Is(err, ErrFull) {
+		t.Fatalf("Set past maxmemory = %v, want ErrOutOfMemory", err)
+	}
+	if size := c.Stats().Size; size != 4 {
+		t.Fatalf("size = %d, want 4", size)
+	}
+
+	// Freeing memory lets writes through again
+	if err := c.Delete("key:0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("key:4", value, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaxMemoryPolicies(t *testing.T) {
+	value := bytes.Repeat([]byte("x"), 100)
+	limit := 10 * entryMemory("key:00", 100, 0)
+
+	for _, policy := range []string{MaxMemoryAllKeysLRU, MaxMemoryAllKeysRandom} {
+		t.Run(policy, func(t *testing.T) {
+			c := NewCacheWithOptions(Options{Shards: 1, MaxMemory: limit, MaxMemoryPolicy: policy})
+			defer c.Close()
+			for i := 0; i < 50; i++ {
+				if err := c.Set("key:"+strconv.Itoa(i), value, 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if used := c.Stats().UsedMemory; used > limit {
+				t.Fatalf("used memory = %d, want at most %d", used, limit)
+			}
+			if _, err := c.Get("key:49"); err != nil {
+				t.Fatalf("Get of the latest key = %v", err)
+			}
+		})
+	}
+
+	t.Run(MaxMemoryVolatileTTL, func(t *testing.T) {
+		c := NewCacheWithOptions(Options{Shards: 1, MaxMemory: limit, MaxMemoryPolicy: MaxMemoryVolatileTTL})
+		defer c.Close()
+		for i := 0; i < 9; i++ {
+			if err := c.Set("key:"+strconv.Itoa(i), value, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := c.Set("soon", value, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Set("later", value, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if c.Has("soon") || !c.Has("later") {
+			t.Fatal("volatile-ttl did not evict the key closest to expiring")
+		}
+
+		// Keys without a TTL are never evicted
+		for i := 0; i < 5; i++ {
+			if err := c.Set("more:"+strconv.Itoa(i), value, 0); errors.Is(err, ErrOutOfMemory) {
+				return
+			}
+		}
+		t.Fatal("volatile-ttl evicted keys without a TTL")
+	})
+}
+
+func TestUnknownMaxMemoryPolicy(t *testing.T) {
+	if _, err := validMaxMemoryPolicy("allkeys-lfu"); err == nil {
+		t.Fatal("validMaxMemoryPolicy accepted an unknown policy")
+	}
+	if policy, err := validMaxMemoryPolicy(""); err != nil || policy != MaxMemoryNoEviction {
+		t.Fatalf("default policy = %q, %v, want noeviction", policy, err)
+	}
+}
@@ -0,0 +1,289 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultNamespace is the namespace used when a request does not select one.
+const DefaultNamespace = "default"
+
+// maxNamespaceLength is the longest accepted namespace name.
+const maxNamespaceLength = 64
+
+// aofFlushNamespaces clears every namespace. It starts the snapshots sent to
+// followers so that no stale key lingers in a namespace the snapshot skips.
+const aofFlushNamespaces Command = "FLUSHNAMESPACES"
+
+// namespaceTagPrefix starts the leading argument that tags a record with its
+// namespace. Records of the default namespace are not tagged, so AOF files
+// written before namespaces existed replay into it.
+const namespaceTagPrefix = "ns="
+
+var (
+	// ErrInvalidNamespace is returned for namespace names that are empty, too
+	// long or contain characters other than letters, digits, '-', '_', '.' and ':'.
+	ErrInvalidNamespace = errors.New("invalid namespace name")
+
+	// ErrNamespaceNotFound is returned when looking up a namespace that was
+	// never written to.
+	ErrNamespaceNotFound = errors.New("namespace not found")
+
+	// ErrTooManyNamespaces is returned when creating a namespace would exceed
+	// Options.MaxNamespaces.
+	ErrTooManyNamespaces = fmt.Errorf("%w: too many namespaces", ErrFull)
+)
+
+// Namespaces holds the independent logical caches of a node. Each namespace
+// has its own shards, eviction policy, limits and statistics, while all of
+// them share one AOF file and replication stream.
+type Namespaces struct {
+	mutex   sync.RWMutex
+	options Options
+	aof     *aofLog
+	memory  *memoryCounter
+	caches  map[string]*Cache
+	broker  broker
+}
+
+// NewNamespaces creates the namespaces of a node. Every namespace is created
+// on first write with the given options, so the limits apply per namespace,
+// and at most Options.MaxNamespaces of them are created.
+func NewNamespaces(opts Options) *Namespaces {
+	aof, memory := &aofLog{keys: opts.Encryption, migrate: opts.EncryptPlaintextAOF}, &memoryCounter{}
+	return &Namespaces{
+		options: opts,
+		aof:     aof,
+		memory:  memory,
+		caches:  map[string]*Cache{DefaultNamespace: newCache(opts, DefaultNamespace, aof, memory)},
+	}
+}
+
+// Namespace returns the cache of the named namespace, creating it if needed
+// unless that would exceed Options.MaxNamespaces. An empty name selects
+// DefaultNamespace.
+func (n *Namespaces) Namespace(name string) (*Cache, error) {
+	return n.namespace(name, n.options.MaxNamespaces)
+}
+
+// Lookup returns the cache of a namespace that already exists, for requests
+// that only read and must not create one. An empty name selects DefaultNamespace.
+func (n *Namespaces) Lookup(name string) (*Cache, error) {
+	if name == "" {
+		name = DefaultNamespace
+	}
+	if !validNamespace(name) {
+		return nil, ErrInvalidNamespace
+	}
+
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	c, exists := n.caches[name]
+	if !exists {
+		return nil, ErrNamespaceNotFound
+	}
+	return c, nil
+}
+
+// namespace returns the cache of the named namespace, creating it if there
+// are fewer than limit namespaces, or in any case when limit is 0.
+func (n *Namespaces) namespace(name string, limit int) (*Cache, error) {
+	if c, err := n.Lookup(name); !errors.Is(err, ErrNamespaceNotFound) {
+		return c, err
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if c, exists := n.caches[name]; exists {
+		return c, nil
+	}
+	if limit > 0 && len(n.caches) >= limit {
+		return nil, ErrTooManyNamespaces
+	}
+	c := newCache(n.options, name, n.aof, n.memory)
+	n.caches[name] = c
+	return c, nil
+}
+
+// Default returns the cache of DefaultNamespace.
+func (n *Namespaces) Default() *Cache {
+	c, _ := n.Lookup(DefaultNamespace)
+	return c
+}
+
+// Names returns the names of the namespaces in use, sorted.
+func (n *Namespaces) Names() []string {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	names := make([]string, 0, len(n.caches))
+	for name := range n.caches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stats returns the statistics of every namespace.
+func (n *Namespaces) Stats() map[string]Stats {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	stats := make(map[string]Stats, len(n.caches))
+	for name, c := range n.caches {
+		stats[name] = c.Stats()
+	}
+	return stats
+}
+
+// Memory returns the memory used by all namespaces together and its peak, in bytes.
+func (n *Namespaces) Memory() (used int64, peak int64) {
+	return n.memory.used.Load(), n.memory.peak.Load()
+}
+
+// FlushAll clears every namespace.
+func (n *Namespaces) FlushAll() {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	for _, c := range n.caches {
+		_ = c.ResetCache()
+	}
+}
+
+// ReplayAOF rebuilds every namespace from the AOF file and keeps appending to
+// it. It fails when the file is encrypted and cannot be opened with
+// Options.Encryption, or holds plaintext records despite it, and rewrites the file when some records are not sealed
+// with its current key, which completes a key rotation.
+func (n *Namespaces) ReplayAOF(aofFilePath string) error {
+	stale, err := n.aof.replay(aofFilePath, n.applyRecord)
+	if err != nil || !stale {
+		return err
+	}
+	println(GreenColor+"Rewriting AOF with the current encryption key", ResetColor)
+	return n.RewriteAOF()
+}
+
+// RewriteAOF replaces the AOF file with the records that recreate every
+// namespace, sealed with the current encryption key. It compacts the file and
+// re-encrypts it after a key rotation.
+func (n *Namespaces) RewriteAOF() error {
+	var err error
+	n.withSnapshot(func(snapshot []string) {
+		err = n.aof.rewrite(snapshot)
+	})
+	return err
+}
+
+// SetReplicationHook registers a function that receives every record written
+// by any namespace, in the order they were written.
+func (n *Namespaces) SetReplicationHook(hook func(record string)) {
+	n.aof.setReplicationHook(hook)
+}
+
+// ApplyRecord parses a record line, as streamed by the master, and applies it
+// to the namespace it is tagged with.
+func (n *Namespaces) ApplyRecord(line string) error {
+	args, err := parseRecord(line)
+	if err != nil {
+		return err
+	}
+	return n.applyRecord(args)
+}
+
+func (n *Namespaces) applyRecord(args []string) error {
+	if len(args) == 1 && Command(strings.ToUpper(args[0])) == aofFlushNamespaces {
+		n.FlushAll()
+		return nil
+	}
+	if len(args) == 3 && Command(strings.ToUpper(args[0])) == CMDPublish {
+		n.broker.deliver(args[1], args[2])
+		return nil
+	}
+
+	// The namespaces of records were created within the limit when they were
+	// written, so replaying them never refuses one
+	name, args := splitNamespaceTag(args)
+	c, err := n.namespace(name, 0)
+	if err != nil {
+		return err
+	}
+	return c.applyRecord(args)
+}
+
+// SyncFollower hands a snapshot of every namespace to register while all of
+// them are locked, so no write can fall between the snapshot and the moment
+// register starts receiving the replication stream.
+func (n *Namespaces) SyncFollower(register func(snapshot []string)) {
+	n.withSnapshot(register)
+}
+
+// withSnapshot hands fn the records that recreate every namespace while all of
+// them are locked.
+func (n *Namespaces) withSnapshot(fn func(snapshot []string)) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	names := make([]string, 0, len(n.caches))
+	for name := range n.caches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	snapshot := []string{formatRecord(string(aofFlushNamespaces))}
+	for _, name := range names {
+		c := n.caches[name]
+		c.lockAll()
+		defer c.unlockAll()
+		snapshot = append(snapshot, c.dump()...)
+	}
+	fn(snapshot)
+}
+
+// Close stops the background expiry of every namespace and closes the AOF file.
+func (n *Namespaces) Close() {
+	n.mutex.RLock()
+	for _, c := range n.caches {
+		c.closeOnce.Do(func() { close(c.stopExpiry) })
+	}
+	n.mutex.RUnlock()
+
+	n.aof.close()
+}
+
+// record formats a record tagged with the cache's namespace.
+func (c *Cache) record(args ...string) string {
+	if c.namespace != DefaultNamespace {
+		args = append([]string{namespaceTagPrefix + c.namespace}, args...)
+	}
+	return formatRecord(args...)
+}
+
+// splitNamespaceTag removes the namespace tag from the arguments of a record.
+// Records without one belong to DefaultNamespace.
+func splitNamespaceTag(args []string) (string, []string) {
+	if len(args) == 0 || !strings.HasPrefix(args[0], namespaceTagPrefix) {
+		return DefaultNamespace, args
+	}
+	return strings.TrimPrefix(args[0], namespaceTagPrefix), args[1:]
+}
+
+func validNamespace(name string) bool {
+	if len(name) == 0 || len(name) > maxNamespaceLength {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
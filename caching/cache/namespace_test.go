@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLookupDoesNotCreateNamespaces(t *testing.T) {
+	namespaces := NewNamespaces(Options{})
+	defer namespaces.Close()
+
+	if _, err := namespaces.Lookup("orders"); !errors.Is(err, ErrNamespaceNotFound) {
+		t.Fatalf("Lookup = %v, want ErrNamespaceNotFound", err)
+	}
+	if _, err := namespaces.Lookup("bad name"); !errors.Is(err, ErrInvalidNamespace) {
+		t.Fatalf("Lookup = %v, want ErrInvalidNamespace", err)
+	}
+	if names := namespaces.Names(); len(names) != 1 || names[0] != DefaultNamespace {
+		t.Fatalf("Names = %q, want only the default namespace", names)
+	}
+
+	created, err := namespaces.Namespace("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found, err := namespaces.Lookup("orders"); err != nil || found != created {
+		t.Fatalf("Lookup after Namespace = %p, %v, want %p", found, err, created)
+	}
+}
+
+func TestMaxNamespaces(t *testing.T) {
+	namespaces := NewNamespaces(Options{MaxNamespaces: 2})
+	defer namespaces.Close()
+
+	if _, err := namespaces.Namespace("orders"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := namespaces.Namespace("users"); !errors.Is(err, ErrTooManyNamespaces) || !errors.Is(err, ErrFull) {
+		t.Fatalf("Namespace over the limit = %v, want ErrTooManyNamespaces", err)
+	}
+	if _, err := namespaces.Namespace("orders"); err != nil {
+		t.Fatalf("Namespace on an existing one = %v", err)
+	}
+
+	// Records were written within the master's limit, so replaying them never refuses a namespace
+	if err := namespaces.ApplyRecord("ns=users SET a 1"); err != nil {
+		t.Fatal(err)
+	}
+	users, err := namespaces.Lookup("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := users.Get("a"); err != nil || string(value) != "1" {
+		t.Fatalf("Get = %q, %v, want 1", value, err)
+	}
+}
@@ -2,27 +2,100 @@ package cache
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"strconv"
 	"strings"
-	"time"
+	"sync"
+	"sync/atomic"
 )
 
+// aofEvict marks an entry evicted to keep the cache within its limits.
+const aofEvict Command = "EVICT"
+
+// maxRecordSize is the longest AOF or replication record that can be read back.
+const maxRecordSize = 64 * 1024 * 1024
+
 // Open or create AOF file.
 func openOrCreateAOFFile(aofFilePath string) (*os.File, error) {
 	return os.OpenFile(aofFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 }
 
-func (c *Cache) ReplayAOF(aofFilePath string) {
-	c.replayingAOF = true
+// aofLog is the append-only file and replication hook that records are written
+// to. The namespaces of a node share a single log.
+type aofLog struct {
+	mutex     sync.Mutex
+	file      *os.File
+	path      string   // Path of the AOF file, set by replay
+	keys      *Keyring // Keys records are sealed with, nil to write them in plaintext
+	migrate   bool     // Whether a plaintext AOF is replayed despite keys, see Options.EncryptPlaintextAOF
+	replaying atomic.Bool
+	replicate func(record string)
+}
+
+// ReplayAOF rebuilds the cache from the AOF file and keeps appending to it.
+// It fails when the file is encrypted and cannot be opened with the keyring of
+// the cache, or holds plaintext records despite it, and rewrites the file when some records are not sealed with its
+// current key.
+func (c *Cache) ReplayAOF(aofFilePath string) error {
+	stale, err := c.aof.replay(aofFilePath, func(args []string) error {
+		namespace, args := splitNamespaceTag(args)
+		if namespace != c.namespace {
+			return fmt.Errorf("record of namespace %s cannot be replayed without namespaces", namespace)
+		}
+		return c.applyRecord(args)
+	})
+	if err != nil || !stale {
+		return err
+	}
+	println(GreenColor+"Rewriting AOF with the current encryption key", ResetColor)
+	return c.RewriteAOF()
+}
+
+// RewriteAOF replaces the AOF file with the records that recreate the cache,
+// sealed with the current encryption key.
+func (c *Cache) RewriteAOF() error {
+	c.lockAll()
+	defer c.unlockAll()
+
+	return c.aof.rewrite(c.dump())
+}
+
+// replay applies every record of the AOF file and then reopens it for
+// appending. Records are not written back while they are replayed. It stops
+// at the first record the keyring cannot open and then leaves the file closed,
+// so nothing is appended to a file that was not read. A last line cut short by
+// a crash is skipped instead. stale reports whether some records are not
+// sealed with the current key.
+func (l *aofLog) replay(aofFilePath string, apply func(args []string) error) (stale bool, err error) {
+	l.path = aofFilePath
+	l.replaying.Store(true)
+	stale, err = l.replayFile(aofFilePath, apply)
+	l.replaying.Store(false)
+	if err != nil {
+		return false, err
+	}
+
+	// Reopen the AOF for appending once the replay is done so new writes are persisted
+	aofFile, err := openOrCreateAOFFile(aofFilePath)
+	if err != nil {
+		fmt.Println(RedColor+"Error opening AOF file for append:", err, ResetColor)
+		return stale, nil
+	}
+	l.mutex.Lock()
+	l.file = aofFile
+	l.mutex.Unlock()
+	return stale, nil
+}
+
+func (l *aofLog) replayFile(aofFilePath string, apply func(args []string) error) (bool, error) {
 	aofFile, err := os.Open(aofFilePath)
 	if err != nil {
 		fmt.Println(RedColor+"Error opening AOF file for replay:", err, ResetColor)
-		return
+		return false, nil
 	}
-	c.aofFile = aofFile
 
 	defer func(file *os.File) {
 		err := file.Close()
@@ -31,58 +104,182 @@ func (c *Cache) ReplayAOF(aofFilePath string) {
 		}
 	}(aofFile)
 
-	scanner := bufio.NewScanner(aofFile)
-	for scanner.Scan() {
-		line := scanner.Text()
-		fields := strings.Fields(line)
-		if len(fields) > 1 {
-			command := fields[0]
-
-			// Replay the command to reconstruct the cache
-			switch command {
-			case string(CMDSet):
-				key := fields[1]
-				value := []byte(fields[2])
-				ttl, _ := strconv.Atoi(fields[3])
-				duration := time.Duration(ttl/1000) * time.Second
-				_ = c.Set(key, value, duration)
-			case string(CMDDel):
-				key := fields[1]
-				_ = c.Delete(key)
-			case string(CMDFlushAll):
-				_ = c.ResetCache()
+	stale, plaintext, sealed := false, false, false
+	reader := bufio.NewReaderSize(aofFile, 64*1024)
+	for lineNumber := 1; ; lineNumber++ {
+		line, readErr := reader.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return stale, fmt.Errorf("reading AOF file: %v", readErr)
+		}
+		// Only the last line can lack its newline, when a crash cut it short
+		torn := readErr == io.EOF
+		line = strings.TrimSuffix(line, "\n")
 
+		if line != "" {
+			record, keyID, err := l.keys.openLine(line)
+			if errors.Is(err, ErrAOFPlaintext) && l.migrate && !sealed {
+				// An AOF written before encryption was configured, rewritten sealed once replayed
+				record, err, plaintext = line, nil, true
+			} else if err == nil && keyID != "" {
+				sealed = true
+				if plaintext {
+					err = fmt.Errorf("%w: sealed records follow plaintext ones", ErrAOFPlaintext)
+				}
+			}
+			switch {
+			case errors.Is(err, ErrAOFPlaintext):
+				// Even cut short, an injected record must not go unnoticed
+				return stale, fmt.Errorf("AOF line %d: %w", lineNumber, err)
+			case err != nil && torn:
+				fmt.Println(RedColor+"Skipping AOF record cut short:", err, ResetColor)
+			case err != nil:
+				return stale, fmt.Errorf("AOF line %d: %w", lineNumber, err)
+			default:
+				if l.keys != nil && keyID != l.keys.current {
+					stale = true
+				}
+				// Replay the command to reconstruct the cache
+				args, err := parseRecord(record)
+				if err == nil {
+					err = apply(args)
+				}
+				if err != nil {
+					fmt.Println(RedColor+"Error replaying AOF record:", err, ResetColor)
+				}
 			}
 		}
-		log.Printf("Replay of AOF end")
-	}
-	c.replayingAOF = false
-	if err := scanner.Err(); err != nil {
-		fmt.Println(RedColor+"Error reading AOF file:", err, ResetColor)
+		if torn {
+			break
+		}
 	}
+	log.Printf("Replay of AOF end")
+	return stale, nil
+}
 
+// SetReplicationHook registers a function that receives every record written
+// to the AOF, in the same order, so it can be streamed to the slaves.
+func (c *Cache) SetReplicationHook(hook func(record string)) {
+	c.aof.setReplicationHook(hook)
+}
+
+func (l *aofLog) setReplicationHook(hook func(record string)) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.replicate = hook
+}
+
+// writeToAOF appends a record, tagged with the cache's namespace, to the AOF
+// file and hands it to the replication hook. Inside a transaction the record
+// is collected instead, to be written with the others as a single unit.
+func (c *Cache) writeToAOF(args ...string) {
+	if c.transaction != nil {
+		*c.transaction = append(*c.transaction, formatRecord(args...))
+		return
+	}
+	c.aof.write(c.record(args...))
 }
 
-func (c *Cache) writeToAOF(command string, key string, value []byte, ttl time.Duration) {
-	if c.aofFile == nil {
-		log.Printf("Error! No AOF file.")
+func (l *aofLog) write(record string) {
+	if l.replaying.Load() {
 		return
 	}
 
-	// Format the command and write to the AOF file
-	var cmd = fmt.Sprintf("%s %s %s \n", command, key, value)
-	if ttl != 0 {
-		cmd = fmt.Sprintf("%s %s %s %d\n", command, key, value, ttl.Milliseconds())
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.replicate != nil {
+		l.replicate(record)
+	}
+
+	// Slaves keep no AOF of their own
+	if l.file == nil {
+		return
 	}
-	_, err := c.aofFile.WriteString(cmd)
+
+	// Write the record to the AOF file
+	_, err := l.file.WriteString(l.line(record) + "\n")
 	if err != nil {
 		fmt.Println("Error writing to AOF file:", err)
 	}
 }
 
+// line returns the AOF line holding record, sealed when the log has keys.
+func (l *aofLog) line(record string) string {
+	if l.keys == nil {
+		return record
+	}
+	return l.keys.seal(record)
+}
+
+// rewrite replaces the AOF file with records, sealed with the current key,
+// through a temporary file renamed over it. The caller must keep the cache
+// from changing meanwhile, so no record falls between the two files.
+func (l *aofLog) rewrite(records []string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.path == "" {
+		return errors.New("no AOF file to rewrite")
+	}
+	tmpPath := l.path + ".rewrite"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("creating rewritten AOF: %v", err)
+	}
+	writer := bufio.NewWriter(tmpFile)
+	for _, record := range records {
+		writer.WriteString(l.line(record) + "\n")
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, l.path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("writing rewritten AOF: %v", err)
+	}
+
+	// Keep appending to the new file
+	aofFile, err := openOrCreateAOFFile(l.path)
+	if err != nil {
+		return fmt.Errorf("opening rewritten AOF for append: %v", err)
+	}
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file = aofFile
+	log.Printf("AOF rewritten with %d records", len(records))
+	return nil
+}
+
+// broadcast hands a record to the replication hook without writing it to the
+// AOF file, for records the slaves need but a restart must not replay.
+func (l *aofLog) broadcast(record string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.replicate != nil {
+		l.replicate(record)
+	}
+}
+
 func (c *Cache) CloseAOF() {
-	if c.aofFile != nil {
-		err := c.aofFile.Close()
+	c.aof.close()
+}
+
+func (l *aofLog) close() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file != nil {
+		err := l.file.Close()
 		if err != nil {
 			log.Printf("Error closing AOF file.")
 			return
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrNoChannels is returned for subscriptions to no channel and no pattern.
+var ErrNoChannels = errors.New("no channel or pattern to subscribe to")
+
+// Message is a message published on a channel. Pattern is set when the message
+// reached the subscriber through a pattern subscription.
+type Message struct {
+	Channel string `json:"channel"`
+	Pattern string `json:"pattern,omitempty"`
+	Payload string `json:"message"`
+}
+
+// MessageSubscription receives the messages published on its channels and on
+// the channels matching its glob patterns. Like Redis, a message matching
+// several of them is received once for each. A subscriber that lets its buffer
+// fill up is dropped: Messages is closed and Dropped reports true.
+type MessageSubscription struct {
+	Messages <-chan Message
+
+	broker   *broker
+	messages chan Message
+	channels []string
+	patterns []string
+	dropped  atomic.Bool
+}
+
+// Dropped reports whether the subscription was closed because its buffer overflowed.
+func (s *MessageSubscription) Dropped() bool {
+	return s.dropped.Load()
+}
+
+// Close stops the subscription and closes Messages.
+func (s *MessageSubscription) Close() {
+	s.broker.remove(s)
+}
+
+// broker fans published messages out to the subscriptions of a node. Channels
+// are shared by every namespace, like in Redis.
+type broker struct {
+	mutex         sync.Mutex
+	subscriptions map[*MessageSubscription]struct{}
+}
+
+// Subscribe starts receiving the messages published on channels and on the
+// channels matching patterns, with room for buffer messages that have not been
+// read yet.
+func (n *Namespaces) Subscribe(channels []string, patterns []string, buffer int) (*MessageSubscription, error) {
+	if len(channels) == 0 && len(patterns) == 0 {
+		return nil, ErrNoChannels
+	}
+	messages := make(chan Message, max(buffer, 1))
+	sub := &MessageSubscription{
+		Messages: messages,
+		broker:   &n.broker,
+		messages: messages,
+		channels: channels,
+		patterns: patterns,
+	}
+
+	n.broker.mutex.Lock()
+	defer n.broker.mutex.Unlock()
+
+	if n.broker.subscriptions == nil {
+		n.broker.subscriptions = make(map[*MessageSubscription]struct{})
+	}
+	n.broker.subscriptions[sub] = struct{}{}
+	return sub, nil
+}
+
+// Publish sends message to the subscribers of channel on this node and on
+// every slave, and returns how many subscriptions of this node received it.
+// The record carrying it only travels on the replication stream: messages are
+// fire and forget, so the AOF never keeps them.
+func (n *Namespaces) Publish(channel string, message string) int {
+	receivers := n.broker.deliver(channel, message)
+	n.aof.broadcast(formatRecord(string(CMDPublish), channel, message))
+	return receivers
+}
+
+func (b *broker) remove(sub *MessageSubscription) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, exists := b.subscriptions[sub]; exists {
+		delete(b.subscriptions, sub)
+		close(sub.messages)
+	}
+}
+
+// deliver hands a message to every matching subscription without ever
+// blocking the publisher, and returns how many times it was delivered.
+func (b *broker) deliver(channel string, payload string) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	receivers := 0
+	for sub := range b.subscriptions {
+		var matches []Message
+		for _, subscribed := range sub.channels {
+			if subscribed == channel {
+				matches = append(matches, Message{Channel: channel, Payload: payload})
+			}
+		}
+		for _, pattern := range sub.patterns {
+			if globMatch(pattern, channel) {
+				matches = append(matches, Message{Channel: channel, Pattern: pattern, Payload: payload})
+			}
+		}
+
+		for _, message := range matches {
+			select {
+			case sub.messages <- message:
+				receivers++
+			default:
+				sub.dropped.Store(true)
+			}
+			if sub.dropped.Load() {
+				delete(b.subscriptions, sub)
+				close(sub.messages)
+				break
+			}
+		}
+	}
+	return receivers
+}
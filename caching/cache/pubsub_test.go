@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// nextMessage returns the next message of a subscription, failing when none
+// arrives within a second.
+func nextMessage(t *testing.T, sub *MessageSubscription) Message {
+	t.Helper()
+	select {
+	case message, ok := <-sub.Messages:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return message
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a message")
+	}
+	return Message{}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	namespaces := NewNamespaces(Options{})
+	defer namespaces.Close()
+
+	sub, err := namespaces.Subscribe([]string{"news"}, []string{"news.*", "n*"}, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	other, err := namespaces.Subscribe([]string{"sports"}, nil, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	// A message is received once for every channel and pattern it matches
+	if receivers := namespaces.Publish("news", "hello"); receivers != 2 {
+		t.Fatalf("Publish = %d receivers, want 2", receivers)
+	}
+	if message := nextMessage(t, sub); message != (Message{Channel: "news", Payload: "hello"}) {
+		t.Fatalf("message = %+v, want hello on news", message)
+	}
+	if message := nextMessage(t, sub); message != (Message{Channel: "news", Pattern: "n*", Payload: "hello"}) {
+		t.Fatalf("message = %+v, want hello on news through n*", message)
+	}
+
+	if receivers := namespaces.Publish("news.tech", "go"); receivers != 2 {
+		t.Fatalf("Publish = %d receivers, want 2", receivers)
+	}
+	if receivers := namespaces.Publish("weather", "rain"); receivers != 0 {
+		t.Fatalf("Publish without subscribers = %d receivers, want 0", receivers)
+	}
+	if len(other.Messages) != 0 {
+		t.Fatal("subscriber of another channel received a message")
+	}
+
+	if _, err := namespaces.Subscribe(nil, nil, 1); !errors.Is(err, ErrNoChannels) {
+		t.Fatalf("Subscribe to nothing = %v, want ErrNoChannels", err)
+	}
+}
+
+func TestSlowMessageSubscriberIsDropped(t *testing.T) {
+	namespaces := NewNamespaces(Options{})
+	defer namespaces.Close()
+
+	sub, err := namespaces.Subscribe([]string{"events"}, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		namespaces.Publish("events", strconv.Itoa(i))
+	}
+
+	received := 0
+	for range sub.Messages {
+		received++
+	}
+	if received != 2 || !sub.Dropped() {
+		t.Fatalf("slow subscriber received %d messages, dropped = %v, want 2 and dropped", received, sub.Dropped())
+	}
+}
+
+func TestMessagesReachSlaveSubscribers(t *testing.T) {
+	master := NewNamespaces(Options{})
+	defer master.Close()
+	slave := NewNamespaces(Options{})
+	defer slave.Close()
+	master.SetReplicationHook(func(record string) {
+		if err := slave.ApplyRecord(record); err != nil {
+			t.Error(err)
+		}
+	})
+
+	sub, err := slave.Subscribe(nil, []string{"orders:*"}, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	master.Publish("orders:eu", "payload with spaces")
+	if message := nextMessage(t, sub); message.Channel != "orders:eu" || message.Payload != "payload with spaces" {
+		t.Fatalf("slave message = %+v, want the published one", message)
+	}
+}
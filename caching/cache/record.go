@@ -0,0 +1,392 @@
+package cache
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// A record is one write operation, as stored in the AOF and streamed to the
+// slaves: the command name followed by its arguments on a single line.
+// Arguments that are empty or contain whitespace, quotes or unprintable
+// characters are written as Go quoted strings.
+
+// formatRecord encodes a record as a single line without the trailing newline.
+func formatRecord(args ...string) string {
+	encoded := make([]string, len(args))
+	for i, arg := range args {
+		if needsQuoting(arg) {
+			arg = strconv.Quote(arg)
+		}
+		encoded[i] = arg
+	}
+	return strings.Join(encoded, " ")
+}
+
+func needsQuoting(arg string) bool {
+	if arg == "" || strings.HasPrefix(arg, "\"") {
+		return true
+	}
+	for _, r := range arg {
+		if unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRecord splits a line written by formatRecord back into its arguments.
+func parseRecord(line string) ([]string, error) {
+	var args []string
+	for {
+		line = strings.TrimLeftFunc(line, unicode.IsSpace)
+		if line == "" {
+			return args, nil
+		}
+
+		if line[0] == '"' {
+			quoted, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				return nil, fmt.Errorf("malformed record argument: %v", err)
+			}
+			arg, err := strconv.Unquote(quoted)
+			if err != nil {
+				return nil, fmt.Errorf("malformed record argument: %v", err)
+			}
+			args = append(args, arg)
+			line = line[len(quoted):]
+			continue
+		}
+
+		end := strings.IndexFunc(line, unicode.IsSpace)
+		if end < 0 {
+			end = len(line)
+		}
+		args = append(args, line[:end])
+		line = line[end:]
+	}
+}
+
+// recordDeadline introduces the absolute deadline of a SET or SETZ record.
+const recordDeadline = "PXAT"
+
+// setRecord returns the record of a SET, with its deadline in Unix
+// milliseconds when it has one and its tags when it has some:
+//
+//	SET <key> <value> [PXAT <deadline-ms>] [TAGS <tag> ...]
+//
+// The deadline is absolute, like the one of PEXPIREAT, so replaying the
+// record after a restart or a slow stream does not extend the TTL.
+func setRecord(key string, value []byte, deadline time.Time, tags []string) []string {
+	return appendSetOptions([]string{string(CMDSet), key, string(value)}, deadline, tags)
+}
+
+// appendSetOptions appends the deadline and tags of a SET or SETZ record.
+func appendSetOptions(args []string, deadline time.Time, tags []string) []string {
+	if !deadline.IsZero() {
+		args = append(args, recordDeadline, strconv.FormatInt(deadline.UnixMilli(), 10))
+	}
+	if len(tags) > 0 {
+		args = append(append(args, recordTags), tags...)
+	}
+	return args
+}
+
+// parseSetOptions parses the deadline and tags following the value of a SET
+// or SETZ record. Records written before deadlines were absolute carry a TTL
+// in milliseconds instead, 0 standing for none, which counts from now.
+func parseSetOptions(args []string) (time.Time, []string, error) {
+	var deadline time.Time
+	switch {
+	case len(args) >= 2 && args[0] == recordDeadline:
+		ms, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return time.Time{}, nil, fmt.Errorf("invalid deadline: %v", err)
+		}
+		deadline, args = time.UnixMilli(ms), args[2:]
+	case len(args) >= 1 && args[0] != recordTags:
+		ttl, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return time.Time{}, nil, fmt.Errorf("invalid TTL: %v", err)
+		}
+		deadline, args = deadlineAfter(time.Duration(ttl)*time.Millisecond), args[1:]
+	}
+
+	if len(args) == 0 {
+		return deadline, nil, nil
+	}
+	if args[0] != recordTags || len(args) == 1 {
+		return time.Time{}, nil, fmt.Errorf("unexpected arguments after deadline: %s", formatRecord(args...))
+	}
+	return deadline, args[1:], nil
+}
+
+// ApplyRecord parses a record line, as streamed by the master, and applies it to the cache.
+func (c *Cache) ApplyRecord(line string) error {
+	args, err := parseRecord(line)
+	if err != nil {
+		return err
+	}
+	return c.applyRecord(args)
+}
+
+// applyRecord replays a single record against the cache and gives the key the
+// version the record is tagged with.
+func (c *Cache) applyRecord(args []string) error {
+	version, args, err := splitVersionTag(args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	switch Command(strings.ToUpper(args[0])) {
+	case CMDFlushAll:
+		return c.ResetCache()
+	case CMDExec:
+		return c.applyTransaction(args[1:])
+	case aofLockToken:
+		if len(args) != 2 {
+			return fmt.Errorf("invalid record: %s", formatRecord(args...))
+		}
+		token, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid token in LOCKTOKEN record: %v", err)
+		}
+		// Any shard lock keeps the record out of a running transaction
+		s := c.shards[0]
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		c.observeLockToken(token)
+		c.writeToAOF(args...)
+		return nil
+	case CMDInvalidateTag:
+		if len(args) != 2 {
+			return fmt.Errorf("invalid record: %s", formatRecord(args...))
+		}
+		c.InvalidateTag(args[1])
+		return nil
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("invalid record: %s", formatRecord(args...))
+	}
+
+	s := c.shardFor(args[1])
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.applyRecord(version, args)
+}
+
+// applyRecord replays a record whose key belongs to the shard and gives the
+// key the version the record is tagged with. The caller must hold s.mutex.
+func (s *shard) applyRecord(version uint64, args []string) error {
+	if err := s.applyCommand(args); err != nil {
+		return err
+	}
+	if version > 0 {
+		s.restoreVersion(args[1], version)
+	}
+	return nil
+}
+
+// applyCommand replays the command of a record. Deleting a key that is
+// already gone, or changing its expiry, is not an error: it may have expired
+// or been evicted locally. The caller must hold s.mutex.
+func (s *shard) applyCommand(args []string) error {
+	command, args := Command(strings.ToUpper(args[0])), args[1:]
+	switch {
+	case command == CMDSet && len(args) >= 2:
+		deadline, tags, err := parseSetOptions(args[2:])
+		if err != nil {
+			return fmt.Errorf("invalid SET record: %v", err)
+		}
+		_, err = s.setUntil(args[0], []byte(args[1]), deadline, nil, tags)
+		return err
+
+	case command == aofSetCompressed && len(args) >= 3:
+		return s.applySetCompressed(args)
+
+	case command == CMDDel && len(args) == 1:
+		_ = s.remove(args[0], EventDel, string(CMDDel), string(CMDDel), args[0])
+		return nil
+
+	case command == aofExpired && len(args) == 1:
+		_ = s.remove(args[0], EventExpired, expiredForTTL, string(aofExpired), args[0])
+		return nil
+
+	case command == aofEvict && (len(args) == 1 || len(args) == 2):
+		reason := evictedForCapacity
+		if len(args) == 2 {
+			reason = args[1]
+		}
+		_ = s.remove(args[0], EventEvicted, reason, append([]string{string(aofEvict)}, args...)...)
+		return nil
+
+	case command == CMDPExpireAt && len(args) == 2:
+		deadline, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid deadline in PEXPIREAT record: %v", err)
+		}
+		_ = s.expireAt(args[0], time.UnixMilli(deadline))
+		return nil
+
+	case command == CMDPersist && len(args) == 1:
+		_, _ = s.persist(args[0])
+		return nil
+
+	case command == CMDHSet && len(args) >= 3 && len(args)%2 == 1:
+		fields := make(map[string][]byte, len(args)/2)
+		for i := 1; i < len(args); i += 2 {
+			fields[args[i]] = []byte(args[i+1])
+		}
+		_, err := s.hset(args[0], fields)
+		return err
+
+	case command == CMDLPush && len(args) >= 2:
+		values := make([][]byte, len(args)-1)
+		for i, value := range args[1:] {
+			values[i] = []byte(value)
+		}
+		_, err := s.lpush(args[0], values...)
+		return err
+
+	case command == CMDRPop && len(args) == 1:
+		_, err := s.rpop(args[0])
+		return err
+
+	case command == CMDSAdd && len(args) >= 2:
+		_, err := s.sadd(args[0], args[1:]...)
+		return err
+
+	case command == CMDZAdd && len(args) >= 3 && len(args)%2 == 1:
+		members := make(map[string]float64, len(args)/2)
+		for i := 1; i < len(args); i += 2 {
+			score, err := strconv.ParseFloat(args[i], 64)
+			if err != nil {
+				return fmt.Errorf("invalid score in ZADD record: %v", err)
+			}
+			members[args[i+1]] = score
+		}
+		_, err := s.zadd(args[0], members)
+		return err
+
+	case command == CMDXAdd && len(args) >= 4:
+		return s.applyXAdd(args)
+
+	case command == CMDXTrim && len(args) == 2:
+		maxLen, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid length in XTRIM record: %v", err)
+		}
+		_, err = s.xtrim(args[0], maxLen)
+		return err
+
+	case command == aofXGroupCreate, command == aofXDeliver, command == aofXSetID, command == CMDXAck:
+		return s.applyStreamCommand(command, args)
+
+	case command == CMDBFReserve, command == CMDBFAdd, command == CMDPFAdd,
+		command == CMDCMSInitByDim, command == CMDCMSIncrBy, command == aofLoadSketch:
+		return s.applySketchCommand(command, args)
+
+	case command == CMDLock, command == CMDUnlock:
+		return s.applyLockCommand(command, args)
+
+	default:
+		return fmt.Errorf("invalid record: %s", formatRecord(append([]string{string(command)}, args...)...))
+	}
+}
+
+// dumpNode returns the arguments of the records that recreate a node. The
+// caller must hold the lock of the node's shard.
+func dumpNode(node *Node) [][]string {
+	var args []string
+	var commands [][]string
+	switch v := node.Data.(type) {
+	case []byte:
+		args = storedRecord(node.Key, node.codec, v, node.expiresAt, node.tags)
+	case *streamValue:
+		commands = v.dump(node.Key)
+	case *bloomValue, *hllValue, *countMinValue:
+		args = []string{string(aofLoadSketch), node.Key, base64.StdEncoding.EncodeToString(encodeSketch(v))}
+	case hashValue:
+		args = []string{string(CMDHSet), node.Key}
+		for field, value := range v {
+			args = append(args, field, string(value))
+		}
+	case *listValue:
+		// LPUSH inserts one value after the other, so push the tail first
+		args = []string{string(CMDLPush), node.Key}
+		for i := len(*v) - 1; i >= 0; i-- {
+			args = append(args, string((*v)[i]))
+		}
+	case setValue:
+		args = []string{string(CMDSAdd), node.Key}
+		for member := range v {
+			args = append(args, member)
+		}
+	case zsetValue:
+		args = []string{string(CMDZAdd), node.Key}
+		for member, score := range v {
+			args = append(args, strconv.FormatFloat(score, 'g', -1, 64), member)
+		}
+	default:
+		return nil
+	}
+
+	if args != nil {
+		commands = [][]string{args}
+	}
+	tag := versionTag(node.version)
+	records := make([][]string, 0, len(commands)+1)
+	for _, args := range commands {
+		records = append(records, append([]string{tag}, args...))
+	}
+	if _, isString := node.Data.([]byte); !isString && !node.expiresAt.IsZero() {
+		records = append(records, append([]string{tag}, expireAtRecord(node)...))
+	}
+	return records
+}
+
+// dump returns the records that recreate the whole cache, starting with a
+// FLUSHALL. The caller must hold every shard lock.
+func (c *Cache) dump() []string {
+	now := time.Now()
+	records := []string{c.record(string(CMDFlushAll))}
+	for _, s := range c.shards {
+		for _, node := range s.items {
+			if node.expired(now) {
+				continue
+			}
+			for _, args := range dumpNode(node) {
+				records = append(records, c.record(args...))
+			}
+		}
+	}
+	for _, args := range c.dumpLocks(now) {
+		records = append(records, c.record(args...))
+	}
+	return records
+}
+
+// Dump returns the records that recreate the whole cache, starting with a FLUSHALL.
+func (c *Cache) Dump() []string {
+	c.lockAll()
+	defer c.unlockAll()
+
+	return c.dump()
+}
+
+// SyncFollower hands a snapshot of the cache to register while every shard is
+// locked, so no write can fall between the snapshot and the moment register
+// starts receiving the replication stream set with SetReplicationHook.
+func (c *Cache) SyncFollower(register func(snapshot []string)) {
+	c.lockAll()
+	defer c.unlockAll()
+
+	register(c.dump())
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetRecordKeepsAbsoluteDeadline(t *testing.T) {
+	master := NewCache()
+	defer master.Close()
+	var mutex sync.Mutex
+	var records []string
+	master.SetReplicationHook(func(record string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		records = append(records, record)
+	})
+
+	if err := master.Set("session", []byte("alice"), 200*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	mutex.Lock()
+	record := records[0]
+	mutex.Unlock()
+
+	// Replaying the record after the key expired on the master must not bring it back
+	time.Sleep(250 * time.Millisecond)
+	slave := NewCache()
+	defer slave.Close()
+	if err := slave.ApplyRecord(record); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := slave.Get("session"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after late replay = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSetRecordWithPassedDeadlineExpiresKey(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+	if err := c.Set("key", []byte("old"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	passed := strconv.FormatInt(time.Now().Add(-time.Second).UnixMilli(), 10)
+	if err := c.ApplyRecord("SET key new PXAT " + passed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get("key"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSetRecordDeadlineAndTags(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	deadline := time.Now().Add(time.Hour)
+	record := formatRecord(setRecord("key", []byte("value"), deadline, []string{"a", "b"})...)
+	if err := c.ApplyRecord(record); err != nil {
+		t.Fatal(err)
+	}
+	ttl, err := c.TTL("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl > time.Until(deadline) || ttl < time.Until(deadline)-time.Second {
+		t.Fatalf("TTL = %v, want about %v", ttl, time.Until(deadline))
+	}
+
+	// Records written with a relative TTL still replay
+	if err := c.ApplyRecord("SET legacy value 60000 TAGS a"); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, err := c.TTL("legacy"); err != nil || ttl <= 59*time.Second {
+		t.Fatalf("TTL of legacy record = %v, %v, want about a minute", ttl, err)
+	}
+	if err := c.ApplyRecord("SET bare value"); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, err := c.TTL("bare"); err != nil || ttl != NoExpiry {
+		t.Fatalf("TTL of record without deadline = %v, %v, want NoExpiry", ttl, err)
+	}
+}
@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RefreshPolicy keeps hot keys fresh without making their readers wait. A
+// value is fresh for SoftTTL after it was written and then stale until
+// HardTTL, when it expires. Reads of a stale value return it right away and
+// start a background refresh through Loader, at most one per key at a time.
+// Reads within the last RefreshAhead fraction of SoftTTL refresh the value
+// before it even turns stale.
+type RefreshPolicy struct {
+	Loader       Loader
+	SoftTTL      time.Duration // How long a value is fresh
+	HardTTL      time.Duration // TTL of every value written under the policy, at least SoftTTL
+	RefreshAhead float64       // Fraction of SoftTTL before it ends that reads refresh, from 0 to 1
+}
+
+func (p RefreshPolicy) validate() error {
+	switch {
+	case p.Loader == nil:
+		return errors.New("refresh policy needs a loader")
+	case p.SoftTTL <= 0:
+		return errors.New("refresh policy needs a positive soft TTL")
+	case p.HardTTL < p.SoftTTL:
+		return errors.New("refresh policy hard TTL must not be shorter than its soft TTL")
+	case p.RefreshAhead < 0 || p.RefreshAhead >= 1:
+		return errors.New("refresh policy refresh-ahead must be at least 0 and below 1")
+	}
+	return nil
+}
+
+// refreshPolicies holds the refresh policies of a cache and the refreshes in flight.
+type refreshPolicies struct {
+	mutex      sync.RWMutex
+	keys       map[string]RefreshPolicy
+	prefixes   map[string]RefreshPolicy
+	count      atomic.Int32 // Lets reads skip the lookup when no policy is set
+	refreshing sync.Map     // Keys being refreshed
+}
+
+// SetRefreshPolicy applies policy to key, taking precedence over prefix policies.
+func (c *Cache) SetRefreshPolicy(key string, policy RefreshPolicy) error {
+	return c.refresh.set(&c.refresh.keys, key, policy)
+}
+
+// SetPrefixRefreshPolicy applies policy to the keys starting with prefix. When
+// several prefixes match a key, the longest one wins.
+func (c *Cache) SetPrefixRefreshPolicy(prefix string, policy RefreshPolicy) error {
+	return c.refresh.set(&c.refresh.prefixes, prefix, policy)
+}
+
+// RemoveRefreshPolicy removes the policy of a key or a prefix.
+func (c *Cache) RemoveRefreshPolicy(keyOrPrefix string) {
+	c.refresh.mutex.Lock()
+	defer c.refresh.mutex.Unlock()
+
+	delete(c.refresh.keys, keyOrPrefix)
+	delete(c.refresh.prefixes, keyOrPrefix)
+	c.refresh.count.Store(int32(len(c.refresh.keys) + len(c.refresh.prefixes)))
+}
+
+func (r *refreshPolicies) set(policies *map[string]RefreshPolicy, name string, policy RefreshPolicy) error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if *policies == nil {
+		*policies = make(map[string]RefreshPolicy)
+	}
+	(*policies)[name] = policy
+	r.count.Store(int32(len(r.keys) + len(r.prefixes)))
+	return nil
+}
+
+// policyFor returns the policy of key, if any.
+func (r *refreshPolicies) policyFor(key string) (RefreshPolicy, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if policy, exists := r.keys[key]; exists {
+		return policy, true
+	}
+	var best RefreshPolicy
+	bestLength := -1
+	for prefix, policy := range r.prefixes {
+		if len(prefix) > bestLength && strings.HasPrefix(key, prefix) {
+			best, bestLength = policy, len(prefix)
+		}
+	}
+	return best, bestLength >= 0
+}
+
+// ttlFor returns the TTL a write of key gets: the hard TTL of its policy, so
+// the value is still served stale after its soft TTL, or duration when no
+// policy applies.
+func (r *refreshPolicies) ttlFor(key string, duration time.Duration) time.Duration {
+	if r.count.Load() == 0 {
+		return duration
+	}
+	if policy, exists := r.policyFor(key); exists {
+		return policy.HardTTL
+	}
+	return duration
+}
+
+// refreshIfStale starts a background refresh of a string node that was just
+// read, when its policy says it is stale or about to be. The caller must hold
+// the lock of the node's shard.
+func (c *Cache) refreshIfStale(node *Node) {
+	if c.refresh.count.Load() == 0 {
+		return
+	}
+	policy, exists := c.refresh.policyFor(node.Key)
+	if !exists {
+		return
+	}
+
+	age := time.Duration(time.Now().UnixNano() - node.updatedAt)
+	refreshAt := policy.SoftTTL - time.Duration(float64(policy.SoftTTL)*policy.RefreshAhead)
+	if age < refreshAt {
+		return
+	}
+	if _, running := c.refresh.refreshing.LoadOrStore(node.Key, struct{}{}); running {
+		return
+	}
+	go c.revalidate(node.Key, node.version, node.tags, policy)
+}
+
+// revalidate reloads a key and stores the value, keeping its tags, unless the
+// key was written meanwhile. A key the loader reports as gone is deleted, while
+// a failing loader leaves the stale value to be served until it expires.
+func (c *Cache) revalidate(key string, version uint64, tags []string, policy RefreshPolicy) {
+	defer c.refresh.refreshing.Delete(key)
+	defer func() {
+		if r := recover(); r != nil {
+			println(RedColor+"Refresh loader panicked for key: ", key, ResetColor)
+		}
+	}()
+
+	println(GreenColor+"Refreshing cache for key: ", key, ResetColor)
+	value, err := policy.Loader.Load(key)
+	switch {
+	case err == nil:
+		if _, err := c.set(key, value, policy.HardTTL, &version, tags); err != nil {
+			var conflict *ConflictError
+			if !errors.As(err, &conflict) {
+				println(RedColor+"Error storing refreshed key: ", key, err.Error(), ResetColor)
+			}
+		}
+
+	case errors.Is(err, ErrNoValue):
+		s := c.shardFor(key)
+		s.mutex.Lock()
+		if node, exists := s.lookup(key); exists && node.version == version {
+			_ = s.remove(key, EventDel, string(CMDDel), string(CMDDel), key)
+		}
+		s.mutex.Unlock()
+
+	default:
+		println(RedColor+"Error refreshing key: ", key, err.Error(), ResetColor)
+	}
+}
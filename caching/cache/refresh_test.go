@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	loader := LoaderFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		<-release
+		return []byte("fresh"), nil
+	})
+	if err := c.SetRefreshPolicy("hot", RefreshPolicy{Loader: loader, SoftTTL: 50 * time.Millisecond, HardTTL: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("hot", []byte("old"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fresh reads leave the loader alone
+	if value, err := c.Get("hot"); err != nil || string(value) != "old" {
+		t.Fatalf("Get = %q, %v, want old", value, err)
+	}
+	if n := loads.Load(); n != 0 {
+		t.Fatalf("loader called %d times for a fresh value", n)
+	}
+
+	// Stale reads return right away and start a single refresh
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		if value, err := c.Get("hot"); err != nil || string(value) != "old" {
+			t.Fatalf("Get of a stale value = %q, %v, want old", value, err)
+		}
+	}
+	close(release)
+	waitFor(t, "the refreshed value", func() bool {
+		value, err := c.Get("hot")
+		return err == nil && string(value) == "fresh"
+	})
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("loader called %d times, want 1", n)
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	loader := LoaderFunc(func(key string) ([]byte, error) { return []byte("fresh"), nil })
+	policy := RefreshPolicy{Loader: loader, SoftTTL: time.Second, HardTTL: time.Hour, RefreshAhead: 0.9}
+	if err := c.SetPrefixRefreshPolicy("page:", policy); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("page:home", []byte("old"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reads in the last 90% of the soft TTL refresh before the value turns stale
+	time.Sleep(150 * time.Millisecond)
+	if _, err := c.Get("page:home"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the refreshed value", func() bool {
+		value, err := c.Get("page:home")
+		return err == nil && string(value) == "fresh"
+	})
+	if ttl, err := c.TTL("page:home"); err != nil || ttl <= 59*time.Minute {
+		t.Fatalf("TTL of the refreshed key = %v, %v, want the hard TTL", ttl, err)
+	}
+}
+
+func TestRefreshKeepsNewerWrites(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	release := make(chan struct{})
+	loader := LoaderFunc(func(key string) ([]byte, error) {
+		<-release
+		return []byte("refreshed"), nil
+	})
+	if err := c.SetRefreshPolicy("key", RefreshPolicy{Loader: loader, SoftTTL: 10 * time.Millisecond, HardTTL: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("key", []byte("old"), 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := c.Get("key"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A write during the refresh wins over the value the refresh loaded
+	if err := c.Set("key", []byte("written"), 0); err != nil {
+		t.Fatal(err)
+	}
+	c.RemoveRefreshPolicy("key")
+	close(release)
+	waitFor(t, "the refresh to finish", func() bool {
+		_, running := c.refresh.refreshing.Load("key")
+		return !running
+	})
+	if value, err := c.Get("key"); err != nil || string(value) != "written" {
+		t.Fatalf("Get = %q, %v, want the value written during the refresh", value, err)
+	}
+}
+
+func TestRefreshPolicyValidation(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	loader := LoaderFunc(func(key string) ([]byte, error) { return nil, ErrNoValue })
+	invalid := []RefreshPolicy{
+		{SoftTTL: time.Second, HardTTL: time.Second},
+		{Loader: loader, HardTTL: time.Second},
+		{Loader: loader, SoftTTL: time.Minute, HardTTL: time.Second},
+		{Loader: loader, SoftTTL: time.Second, HardTTL: time.Second, RefreshAhead: 1},
+	}
+	for _, policy := range invalid {
+		if err := c.SetRefreshPolicy("key", policy); err == nil {
+			t.Fatalf("SetRefreshPolicy accepted %+v", policy)
+		}
+	}
+}
+
+func TestRefreshPolicyAppliesHardTTL(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	loader := LoaderFunc(func(key string) ([]byte, error) { return []byte("fresh"), nil })
+	if err := c.SetRefreshPolicy("hot", RefreshPolicy{Loader: loader, SoftTTL: 50 * time.Millisecond, HardTTL: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	// Written with its soft TTL, the key still lives until the hard TTL
+	if err := c.Set("hot", []byte("old"), 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, err := c.TTL("hot"); err != nil || ttl <= 59*time.Minute {
+		t.Fatalf("TTL = %v, %v, want the hard TTL", ttl, err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if value, err := c.Get("hot"); err != nil || string(value) != "old" {
+		t.Fatalf("Get after the soft TTL = %q, %v, want the stale value", value, err)
+	}
+	waitFor(t, "the refreshed value", func() bool {
+		value, err := c.Get("hot")
+		return err == nil && string(value) == "fresh"
+	})
+}
@@ -0,0 +1,298 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RemoteCache is a CacherV2 backed by the HTTP API of a cluster, usually
+// through its load balancer, which sends the reads to the slaves and the writes
+// to the master. Values travel base64 encoded, so binary values are safe. Wrap
+// it with WithoutContext where a Cacher is needed, such as for NewTyped.
+type RemoteCache struct {
+	baseURL   string
+	namespace string
+	client    *http.Client
+}
+
+// NewRemoteCache returns a RemoteCache for the default namespace of the
+// cluster served at baseURL, such as "http://localhost:8888".
+func NewRemoteCache(baseURL string) *RemoteCache {
+	return &RemoteCache{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Namespace returns a RemoteCache for the named namespace of the same cluster.
+func (r *RemoteCache) Namespace(name string) *RemoteCache {
+	return &RemoteCache{baseURL: r.baseURL, namespace: name, client: r.client}
+}
+
+// remoteValue is how the HTTP API carries a value in JSON.
+type remoteValue struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Encoding string `json:"encoding"`
+	TTL      string `json:"ttl,omitempty"`
+}
+
+// Get returns the string stored under key.
+func (r *RemoteCache) Get(ctx context.Context, key string) ([]byte, error) {
+	_, body, err := r.do(ctx, http.MethodGet, "/cache/get", url.Values{"key": {key}}, nil, nil)
+	return body, err
+}
+
+// Set stores value under key, expiring after duration when it is positive.
+func (r *RemoteCache) Set(ctx context.Context, key string, value []byte, duration time.Duration) error {
+	_, _, err := r.do(ctx, http.MethodPost, "/cache/set", nil, newRemoteValue(key, value, duration), nil)
+	return err
+}
+
+// CompareAndSwap stores value under key only if the key is still at
+// expectedVersion, zero meaning it must not exist, and returns the new version.
+func (r *RemoteCache) CompareAndSwap(ctx context.Context, key string, expectedVersion uint64, value []byte, duration time.Duration) (uint64, error) {
+	header := http.Header{"If-Match": {`"` + strconv.FormatUint(expectedVersion, 10) + `"`}}
+	resp, _, err := r.do(ctx, http.MethodPost, "/cache/set", nil, newRemoteValue(key, value, duration), header)
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		conflict.Key, conflict.Expected = key, expectedVersion
+	}
+	if err != nil {
+		return 0, err
+	}
+	version, err := strconv.ParseUint(strings.Trim(resp.Header.Get("ETag"), `"`), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ETag in response: %q", resp.Header.Get("ETag"))
+	}
+	return version, nil
+}
+
+// Has reports whether key exists, whatever type it holds.
+func (r *RemoteCache) Has(ctx context.Context, key string) (bool, error) {
+	var response struct {
+		Type string `json:"type"`
+	}
+	if err := r.getJSON(ctx, "/cache/type", url.Values{"key": {key}}, &response); err != nil {
+		return false, err
+	}
+	return response.Type != TypeNone, nil
+}
+
+// Delete deletes key.
+func (r *RemoteCache) Delete(ctx context.Context, key string) error {
+	_, _, err := r.do(ctx, http.MethodDelete, "/cache/delete", url.Values{"key": {key}}, nil, nil)
+	return err
+}
+
+// ResetCache clears the namespace.
+func (r *RemoteCache) ResetCache(ctx context.Context) error {
+	_, _, err := r.do(ctx, http.MethodPost, "/cache/reset", nil, nil, nil)
+	return err
+}
+
+// IsFull reports whether the namespace reached its entry or byte limit as a
+// whole.
+func (r *RemoteCache) IsFull(ctx context.Context) (bool, error) {
+	info, err := r.info(ctx)
+	if err != nil {
+		return false, err
+	}
+	return (info.MaxEntries > 0 && info.Stats.Size >= int64(info.MaxEntries)) ||
+		(info.MaxBytes > 0 && info.Stats.UsedBytes >= info.MaxBytes), nil
+}
+
+// IsEmpty reports whether the namespace holds no key.
+func (r *RemoteCache) IsEmpty(ctx context.Context) (bool, error) {
+	info, err := r.info(ctx)
+	if err != nil {
+		return false, err
+	}
+	return info.Stats.Size == 0, nil
+}
+
+// remoteInfo is the part of the server information RemoteCache uses.
+type remoteInfo struct {
+	Stats      Stats `json:"stats"`
+	MaxEntries int   `json:"max_entries"`
+	MaxBytes   int64 `json:"max_bytes"`
+}
+
+func (r *RemoteCache) info(ctx context.Context) (remoteInfo, error) {
+	var info remoteInfo
+	err := r.getJSON(ctx, "/server/info", nil, &info)
+	return info, err
+}
+
+// getMany reads keys with a single MGET request. Missing keys are left out.
+func (r *RemoteCache) getMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	var response struct {
+		Values map[string]*string `json:"values"`
+	}
+	query := url.Values{"encoding": {"base64"}}
+	if err := r.postJSON(ctx, "/cache/mget", query, map[string][]string{"keys": keys}, &response); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]byte, len(response.Values))
+	for key, value := range response.Values {
+		if value == nil {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(*value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of key %s in response: %v", key, err)
+		}
+		values[key] = decoded
+	}
+	return values, nil
+}
+
+// setMany stores values with a single MSET request and returns the errors of
+// the keys that could not be stored.
+func (r *RemoteCache) setMany(ctx context.Context, values map[string][]byte, duration time.Duration) (map[string]error, error) {
+	request := struct {
+		Values   map[string]string `json:"values"`
+		Encoding string            `json:"encoding"`
+		TTL      string            `json:"ttl,omitempty"`
+	}{Values: make(map[string]string, len(values)), Encoding: "base64"}
+	for key, value := range values {
+		request.Values[key] = base64.StdEncoding.EncodeToString(value)
+	}
+	if duration > 0 {
+		request.TTL = duration.String()
+	}
+
+	var response struct {
+		Results map[string]string `json:"results"`
+	}
+	if err := r.postJSON(ctx, "/cache/mset", nil, request, &response); err != nil {
+		return nil, err
+	}
+	failed := make(map[string]error)
+	for key, result := range response.Results {
+		if result != "OK" {
+			failed[key] = remoteError(0, result)
+		}
+	}
+	return failed, nil
+}
+
+// deleteMany deletes keys with a single MDEL request and reports for each key
+// whether it existed.
+func (r *RemoteCache) deleteMany(ctx context.Context, keys []string) (map[string]bool, error) {
+	var response struct {
+		Deleted map[string]bool `json:"deleted"`
+	}
+	err := r.postJSON(ctx, "/cache/mdel", nil, map[string][]string{"keys": keys}, &response)
+	return response.Deleted, err
+}
+
+func newRemoteValue(key string, value []byte, duration time.Duration) remoteValue {
+	request := remoteValue{Key: key, Value: base64.StdEncoding.EncodeToString(value), Encoding: "base64"}
+	if duration > 0 {
+		request.TTL = duration.String()
+	}
+	return request
+}
+
+func (r *RemoteCache) getJSON(ctx context.Context, path string, query url.Values, response interface{}) error {
+	_, body, err := r.do(ctx, http.MethodGet, path, query, nil, nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, response)
+}
+
+func (r *RemoteCache) postJSON(ctx context.Context, path string, query url.Values, request interface{}, response interface{}) error {
+	_, body, err := r.do(ctx, http.MethodPost, path, query, request, nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, response)
+}
+
+// do sends a request, with request encoded as its JSON body when it is not
+// nil, and returns the response and its body. Error statuses are turned into
+// the errors the cache itself would have returned.
+func (r *RemoteCache) do(ctx context.Context, method string, path string, query url.Values, request interface{}, header http.Header) (*http.Response, []byte, error) {
+	var body io.Reader
+	if request != nil {
+		encoded, err := json.Marshal(request)
+		if err != nil {
+			return nil, nil, err
+		}
+		body = bytes.NewReader(encoded)
+	}
+	target := r.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if r.namespace != "" {
+		req.Header.Set("X-Cache-Namespace", r.namespace)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp, nil, remoteError(resp.StatusCode, string(content))
+	}
+	return resp, content, nil
+}
+
+// remoteError turns the message of a failed request back into the error of
+// the cache it reports, as far as the message tells, and otherwise into an
+// error matching the sentinel of its status.
+func remoteError(status int, message string) error {
+	message = strings.TrimSpace(message)
+	for _, known := range []error{ErrNotFound, ErrFieldNotFound, ErrWrongType, ErrOutOfMemory, ErrNotInteger, ErrNotFloat} {
+		if message == known.Error() {
+			return known
+		}
+	}
+	switch status {
+	case 0:
+		return errors.New(message)
+	case http.StatusPreconditionFailed:
+		// The master reports what CompareAndSwap returned, which ends with the actual version
+		conflict := &ConflictError{}
+		if i := strings.LastIndex(message, "found "); i >= 0 {
+			conflict.Actual, _ = strconv.ParseUint(message[i+len("found "):], 10, 64)
+		}
+		return conflict
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrNotFound, message)
+	case http.StatusInsufficientStorage:
+		return fmt.Errorf("%w: %s", ErrFull, message)
+	}
+	return fmt.Errorf("%s: %s", http.StatusText(status), message)
+}
@@ -0,0 +1,276 @@
+package cache
+
+import (
+	"hash/fnv"
+	"time"
+)
+
+// A scan cursor holds the index of the shard being scanned in its top 16 bits
+// and, in the other 48, the lowest key hash still to be returned from it.
+// Keys are visited in hash order within a shard, so a key present for the
+// whole scan is returned exactly once whatever is added or evicted meanwhile.
+const (
+	scanHashBits     = 48
+	scanHashMask     = 1<<scanHashBits - 1
+	maxShards        = 1 << (64 - scanHashBits)
+	defaultScanCount = 10
+)
+
+const (
+	// scanIndexMinBits and scanIndexMaxBits bound the number of buckets of a
+	// scan index, as powers of two.
+	scanIndexMinBits = 4
+	scanIndexMaxBits = 24
+
+	// scanIndexLoad is the average number of keys per bucket at which the
+	// buckets of a scan index double.
+	scanIndexLoad = 8
+
+	// scanEmptyBuckets is how many empty buckets a page may skip for each key
+	// it is asked to examine, so a sparse index never blocks the shard long.
+	scanEmptyBuckets = 10
+)
+
+// scanHash returns the position of a key in the scan order of its shard.
+func scanHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64() & scanHashMask
+}
+
+// scanIndex holds the keys of a shard in buckets of consecutive scan hashes,
+// so a page of a scan only visits the buckets it examines. Buckets split in
+// two along hash order when the index doubles them, so a cursor, being a
+// hash, stays valid however much the shard grows meanwhile.
+type scanIndex struct {
+	bits    uint
+	buckets [][]scanEntry
+	size    int
+}
+
+type scanEntry struct {
+	hash uint64
+	key  string
+}
+
+// bucket returns the index of the bucket holding hash.
+func (x *scanIndex) bucket(hash uint64) int {
+	return int(hash >> (scanHashBits - x.bits))
+}
+
+// bucketStart returns the lowest hash held by bucket b, or the end of the hash
+// space for the bucket after the last.
+func (x *scanIndex) bucketStart(b int) uint64 {
+	return uint64(b) << (scanHashBits - x.bits)
+}
+
+func (x *scanIndex) add(key string) {
+	if x.buckets == nil {
+		x.resize(scanIndexMinBits)
+	} else if x.size >= scanIndexLoad*len(x.buckets) && x.bits < scanIndexMaxBits {
+		x.resize(x.bits + 1)
+	}
+	hash := scanHash(key)
+	b := x.bucket(hash)
+	x.buckets[b] = append(x.buckets[b], scanEntry{hash: hash, key: key})
+	x.size++
+}
+
+func (x *scanIndex) remove(key string) {
+	if x.buckets == nil {
+		return
+	}
+	b := x.bucket(scanHash(key))
+	bucket := x.buckets[b]
+	for i, entry := range bucket {
+		if entry.key == key {
+			bucket[i] = bucket[len(bucket)-1]
+			bucket[len(bucket)-1] = scanEntry{}
+			x.buckets[b] = bucket[:len(bucket)-1]
+			x.size--
+			return
+		}
+	}
+}
+
+// resize spreads the keys over 1<<bits buckets.
+func (x *scanIndex) resize(bits uint) {
+	old := x.buckets
+	x.bits = bits
+	x.buckets = make([][]scanEntry, 1<<bits)
+	for _, bucket := range old {
+		for _, entry := range bucket {
+			b := x.bucket(entry.hash)
+			x.buckets[b] = append(x.buckets[b], entry)
+		}
+	}
+}
+
+// Scan returns the keys of the next page of a scan started with cursor 0,
+// along with the cursor of the page after it, which is 0 once the scan is
+// complete. Count is a hint of how many keys to examine, and only keys that
+// match the glob pattern and, when kind is set, hold that type are returned.
+// Pages may therefore be empty before the scan is done.
+func (c *Cache) Scan(cursor uint64, match string, count int, kind string) ([]string, uint64) {
+	if count <= 0 {
+		count = defaultScanCount
+	}
+
+	index, low := int(cursor>>scanHashBits), cursor&scanHashMask
+	var keys []string
+	for ; index < len(c.shards); index, low = index+1, 0 {
+		page, next, examined, exhausted := c.shards[index].scan(low, count, match, kind)
+		keys = append(keys, page...)
+		if !exhausted {
+			// Keys from next on are left, so next is within the hash space
+			return keys, uint64(index)<<scanHashBits | next
+		}
+		count -= examined
+		if count <= 0 && index+1 < len(c.shards) {
+			return keys, uint64(index+1) << scanHashBits
+		}
+	}
+	return keys, 0
+}
+
+// scan examines the live keys with a scan hash of at least low, a bucket of
+// the scan index at a time, until count keys were examined, and returns those
+// matching the filters. Buckets are always examined whole, so a page may
+// examine a few more keys than count. It also returns the lowest hash left to
+// examine, how many keys were examined and whether no key is left.
+func (s *shard) scan(low uint64, count int, match string, kind string) ([]string, uint64, int, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	index := &s.scanIndex
+	if index.buckets == nil {
+		return nil, 0, 0, true
+	}
+
+	now := time.Now()
+	var keys []string
+	examined, skipped := 0, 0
+	b := index.bucket(low)
+	for ; b < len(index.buckets) && examined < count && skipped < scanEmptyBuckets*count; b++ {
+		if len(index.buckets[b]) == 0 {
+			skipped++
+			continue
+		}
+		for _, entry := range index.buckets[b] {
+			if entry.hash < low {
+				continue
+			}
+			node := s.items[entry.key]
+			if node.expired(now) {
+				continue
+			}
+			examined++
+			if kind != "" && typeOf(node.Data) != kind {
+				continue
+			}
+			if match != "" && !globMatch(match, entry.key) {
+				continue
+			}
+			keys = append(keys, entry.key)
+		}
+	}
+	if b == len(index.buckets) {
+		return keys, 0, examined, true
+	}
+	return keys, index.bucketStart(b), examined, false
+}
+
+// globMatch reports whether key matches a Redis style glob pattern: '*' matches
+// any run of characters, '?' any single character, '[abc]', '[a-z]' and
+// '[^a]' character classes, and '\' escapes the next character.
+func globMatch(pattern string, key string) bool {
+	p, k := []rune(pattern), []rune(key)
+	// Position to resume from when the last '*' has to swallow one more character
+	starP, starK := -1, 0
+	pi, ki := 0, 0
+	for ki < len(k) {
+		if pi < len(p) {
+			switch p[pi] {
+			case '*':
+				starP, starK = pi, ki
+				pi++
+				continue
+			case '?':
+				pi++
+				ki++
+				continue
+			case '[':
+				if matched, next, ok := matchClass(p, pi, k[ki]); ok {
+					if matched {
+						pi = next
+						ki++
+						continue
+					}
+				} else if k[ki] == '[' {
+					// An unterminated class is a literal '['
+					pi++
+					ki++
+					continue
+				}
+			case '\\':
+				if pi+1 < len(p) && p[pi+1] == k[ki] {
+					pi += 2
+					ki++
+					continue
+				}
+			default:
+				if p[pi] == k[ki] {
+					pi++
+					ki++
+					continue
+				}
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		starK++
+		pi, ki = starP+1, starK
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+// matchClass matches r against the character class starting at p[start],
+// returning the position after the class. It reports false in ok when the
+// class is not terminated.
+func matchClass(p []rune, start int, r rune) (matched bool, next int, ok bool) {
+	i := start + 1
+	negated := i < len(p) && p[i] == '^'
+	if negated {
+		i++
+	}
+	for first := true; i < len(p); first = false {
+		if p[i] == ']' && !first {
+			return matched != negated, i + 1, true
+		}
+		c := p[i]
+		if c == '\\' && i+1 < len(p) {
+			i++
+			c = p[i]
+		}
+		if i+2 < len(p) && p[i+1] == '-' && p[i+2] != ']' {
+			lo, hi := c, p[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if r >= lo && r <= hi {
+				matched = true
+			}
+			i += 3
+			continue
+		}
+		if c == r {
+			matched = true
+		}
+		i++
+	}
+	return false, 0, false
+}
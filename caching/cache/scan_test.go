@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// scanAll runs a scan to completion and returns the keys of all its pages.
+func scanAll(t *testing.T, c *Cache, match string, count int, kind string) []string {
+	t.Helper()
+	var keys []string
+	cursor := uint64(0)
+	for pages := 0; ; pages++ {
+		if pages > 10000 {
+			t.Fatal("scan did not complete")
+		}
+		var page []string
+		page, cursor = c.Scan(cursor, match, count, kind)
+		keys = append(keys, page...)
+		if cursor == 0 {
+			return keys
+		}
+	}
+}
+
+func TestScanMatchAndType(t *testing.T) {
+	c := NewCacheWithOptions(Options{Shards: 4})
+	defer c.Close()
+
+	for i := 0; i < 50; i++ {
+		if err := c.Set("user:"+strconv.Itoa(i), []byte("v"), 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Set("order:"+strconv.Itoa(i), []byte("v"), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.SAdd("user:set", "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := scanAll(t, c, "user:*", 7, "")
+	if len(keys) != 51 {
+		t.Fatalf("scan returned %d keys, want 51", len(keys))
+	}
+	sort.Strings(keys)
+	for i := 1; i < len(keys); i++ {
+		if keys[i] == keys[i-1] {
+			t.Fatalf("scan returned %q twice", keys[i])
+		}
+	}
+
+	if keys := scanAll(t, c, "user:*", 7, TypeSet); len(keys) != 1 || keys[0] != "user:set" {
+		t.Fatalf("scan of sets = %q, want user:set", keys)
+	}
+	if keys := scanAll(t, c, "missing:*", 0, ""); len(keys) != 0 {
+		t.Fatalf("scan of a pattern nothing matches = %q", keys)
+	}
+}
+
+func TestScanDuringWrites(t *testing.T) {
+	c := NewCacheWithOptions(Options{Shards: 4})
+	defer c.Close()
+
+	for i := 0; i < 100; i++ {
+		if err := c.Set("stable:"+strconv.Itoa(i), []byte("v"), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Keys present for the whole scan are returned exactly once, whatever is
+	// added and removed between the pages
+	seen := make(map[string]int)
+	cursor, pages := uint64(0), 0
+	for {
+		var page []string
+		page, cursor = c.Scan(cursor, "stable:*", 5, "")
+		for _, key := range page {
+			seen[key]++
+		}
+		for i := 0; i < 10; i++ {
+			key := "churn:" + strconv.Itoa(pages*10+i)
+			if err := c.Set(key, []byte("v"), 0); err != nil {
+				t.Fatal(err)
+			}
+			if i%2 == 0 {
+				if err := c.Delete(key); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		pages++
+		if cursor == 0 {
+			break
+		}
+	}
+	if len(seen) != 100 {
+		t.Fatalf("scan returned %d stable keys, want 100", len(seen))
+	}
+	for key, count := range seen {
+		if count != 1 {
+			t.Fatalf("scan returned %q %d times", key, count)
+		}
+	}
+}
+
+func TestScanPagesExamineAboutCount(t *testing.T) {
+	c := NewCacheWithOptions(Options{Shards: 1})
+	defer c.Close()
+
+	for i := 0; i < 20000; i++ {
+		if err := c.Set("key:"+strconv.Itoa(i), []byte("v"), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each page examines a few buckets rather than the whole shard
+	pages, low := 0, uint64(0)
+	for {
+		keys, next, examined, exhausted := c.shards[0].scan(low, 50, "", "")
+		if examined > 50+4*scanIndexLoad {
+			t.Fatalf("page %d examined %d keys for a count of 50", pages, examined)
+		}
+		if len(keys) != examined {
+			t.Fatalf("page %d returned %d of the %d keys it examined", pages, len(keys), examined)
+		}
+		pages++
+		if exhausted {
+			break
+		}
+		low = next
+	}
+	if pages < 20000/(50+4*scanIndexLoad) || pages > 20000/50+1 {
+		t.Fatalf("scan took %d pages of 50 keys over 20000 keys", pages)
+	}
+}
@@ -0,0 +1,240 @@
+package cache
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultShards is the number of shards used when Options.Shards is not set.
+const DefaultShards = 16
+
+// shard is an independently locked slice of the keyspace with its own map,
+// eviction policy, expiry heap and statistics.
+type shard struct {
+	cache      *Cache
+	mutex      sync.Mutex
+	items      map[string]*Node
+	scanIndex  scanIndex                      // Keys in scan order
+	tags       map[string]map[string]struct{} // Keys of the shard carrying each tag
+	waiters    map[string][]chan struct{}     // Blocked stream reads, by key
+	locks      map[string]*lockState          // Locks acquired, by name
+	policy     EvictionPolicy
+	expiry     expiryHeap
+	maxEntries int
+	maxBytes   int64
+	stats      shardStats
+
+	maxMemory       int64
+	maxMemoryPolicy string
+}
+
+// shardStats are updated under the shard lock but read atomically, so a stats
+// snapshot never has to take any lock.
+type shardStats struct {
+	size        atomic.Int64
+	usedBytes   atomic.Int64
+	usedMemory  atomic.Int64
+	hits        atomic.Int64
+	misses      atomic.Int64
+	evictions   atomic.Int64
+	expirations atomic.Int64
+
+	compressedKeys    atomic.Int64
+	compressedBytes   atomic.Int64
+	uncompressedBytes atomic.Int64
+}
+
+func newShard(c *Cache, opts Options, shardCount int) *shard {
+	// Limits are split evenly, rounding up so the sum never undercuts the total
+	maxEntries := (opts.MaxEntries + shardCount - 1) / shardCount
+	maxBytes := (opts.MaxBytes + int64(shardCount) - 1) / int64(shardCount)
+	maxMemory := (opts.MaxMemory + int64(shardCount) - 1) / int64(shardCount)
+
+	policy, err := NewEvictionPolicy(opts.EvictionPolicy, maxEntries)
+	if err != nil {
+		fmt.Println(RedColor+"Error creating eviction policy, falling back to LRU:", err, ResetColor)
+		policy = newLRUPolicy()
+	}
+	maxMemoryPolicy, err := validMaxMemoryPolicy(opts.MaxMemoryPolicy)
+	if err != nil {
+		fmt.Println(RedColor+"Error reading maxmemory policy, falling back to noeviction:", err, ResetColor)
+	}
+
+	return &shard{
+		cache:      c,
+		items:      make(map[string]*Node),
+		tags:       make(map[string]map[string]struct{}),
+		waiters:    make(map[string][]chan struct{}),
+		locks:      make(map[string]*lockState),
+		policy:     policy,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+
+		maxMemory:       maxMemory,
+		maxMemoryPolicy: maxMemoryPolicy,
+	}
+}
+
+// shardIndex returns the index of the shard that owns key.
+func (c *Cache) shardIndex(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(c.shards)))
+}
+
+// shardFor returns the shard that owns key.
+func (c *Cache) shardFor(key string) *shard {
+	return c.shards[c.shardIndex(key)]
+}
+
+// lockKeys locks the shards owning the given keys in index order and returns
+// the function that unlocks them.
+func (c *Cache) lockKeys(keys ...string) func() {
+	indexes := make([]int, 0, len(keys))
+	seen := make(map[int]bool, len(keys))
+	for _, key := range keys {
+		if i := c.shardIndex(key); !seen[i] {
+			seen[i] = true
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+
+	for _, i := range indexes {
+		c.shards[i].mutex.Lock()
+	}
+	return func() {
+		for j := len(indexes) - 1; j >= 0; j-- {
+			c.shards[indexes[j]].mutex.Unlock()
+		}
+	}
+}
+
+// lockAll locks every shard in index order, which keeps multi-shard
+// operations from deadlocking each other.
+func (c *Cache) lockAll() {
+	for _, s := range c.shards {
+		s.mutex.Lock()
+	}
+}
+
+func (c *Cache) unlockAll() {
+	for i := len(c.shards) - 1; i >= 0; i-- {
+		c.shards[i].mutex.Unlock()
+	}
+}
+
+// lookup returns the node stored under key, expiring it first if its TTL has
+// passed. The caller must hold s.mutex.
+func (s *shard) lookup(key string) (*Node, bool) {
+	node, exists := s.items[key]
+	if !exists {
+		return nil, false
+	}
+	if node.expired(time.Now()) {
+		s.expireNode(node)
+		return nil, false
+	}
+	return node, true
+}
+
+// insert stores a new node. The caller must hold s.mutex.
+func (s *shard) insert(node *Node) {
+	s.items[node.Key] = node
+	s.scanIndex.add(node.Key)
+	s.policy.Add(node)
+	node.accessedAt = time.Now().UnixNano()
+
+	s.stats.size.Add(1)
+	s.stats.usedBytes.Add(node.size)
+	s.refreshMemory(node)
+}
+
+// replaceData swaps the data of a node for uncompressed data and updates its
+// accounted size. The caller must hold s.mutex.
+func (s *shard) replaceData(node *Node, data interface{}) {
+	s.setCodec(node, codecRaw, 0)
+	size := valueSize(data)
+	s.stats.usedBytes.Add(size - node.size)
+	node.Data = data
+	node.size = size
+	node.updatedAt = time.Now().UnixNano()
+	s.refreshMemory(node)
+}
+
+// removeNode removes a node from the map, the eviction policy and the expiry
+// heap. The caller must hold s.mutex.
+func (s *shard) removeNode(node *Node) {
+	s.policy.Remove(node)
+	s.forgetNode(node)
+}
+
+// forgetNode removes a node that the eviction policy no longer tracks.
+// The caller must hold s.mutex.
+func (s *shard) forgetNode(node *Node) {
+	delete(s.items, node.Key)
+	s.scanIndex.remove(node.Key)
+	s.scheduleExpiry(node, time.Time{})
+	s.accountCompression(node, -1)
+	s.setTags(node, nil)
+
+	s.stats.size.Add(-1)
+	s.stats.usedBytes.Add(-node.size)
+	s.addMemory(-node.memory)
+	node.memory = 0
+}
+
+// evictOverflow removes the victims chosen by the eviction policy until the
+// shard is back within its limits. The caller must hold s.mutex.
+func (s *shard) evictOverflow() {
+	for s.overLimits() {
+		node := s.policy.Victim()
+		if node == nil {
+			return
+		}
+		s.forgetNode(node)
+		s.evicted(node, evictedForCapacity)
+	}
+}
+
+// evicted counts, records and notifies a node that was just evicted for the
+// given reason. The caller must hold s.mutex.
+func (s *shard) evicted(node *Node, reason string) {
+	s.stats.evictions.Add(1)
+
+	s.cache.writeToAOF(string(aofEvict), node.Key, reason)
+	s.cache.notify(EventEvicted, reason, node.Key)
+	println(RedColor+"Evicted cache with key: ", node.Key, ResetColor)
+}
+
+// overLimits reports whether the shard holds more than its limits.
+func (s *shard) overLimits() bool {
+	return (s.maxEntries > 0 && s.stats.size.Load() > int64(s.maxEntries)) ||
+		(s.maxBytes > 0 && s.stats.usedBytes.Load() > s.maxBytes)
+}
+
+// atLimits reports whether the shard cannot take another entry without evicting.
+func (s *shard) atLimits() bool {
+	return (s.maxEntries > 0 && s.stats.size.Load() >= int64(s.maxEntries)) ||
+		(s.maxBytes > 0 && s.stats.usedBytes.Load() >= s.maxBytes)
+}
+
+// reset drops every entry of the shard. Locks are kept, since only their
+// owners may release them. The caller must hold s.mutex.
+func (s *shard) reset() {
+	s.items = make(map[string]*Node)
+	s.scanIndex = scanIndex{}
+	s.tags = make(map[string]map[string]struct{})
+	s.policy.Reset()
+	s.expiry = nil
+	s.stats.size.Store(0)
+	s.stats.usedBytes.Store(0)
+	s.stats.compressedKeys.Store(0)
+	s.stats.compressedBytes.Store(0)
+	s.stats.uncompressedBytes.Store(0)
+	s.addMemory(-s.stats.usedMemory.Load())
+}
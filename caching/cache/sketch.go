@@ -0,0 +1,952 @@
+package cache
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"strconv"
+)
+
+// Sketches answer questions about many items in a fixed amount of memory, at
+// the price of approximate answers:
+//
+//   - a Bloom filter tells whether an item may have been added, never missing
+//     one that was but wrong about others at most at its error rate. It grows
+//     by stacking filters, each twice as large and twice as accurate as the
+//     previous one, once the last one holds its capacity.
+//   - a HyperLogLog estimates the number of distinct elements added to it,
+//     with a standard error of 0.81% in 12KB.
+//   - a Count-Min sketch estimates how many times items were counted, never
+//     less than the true count and more by at most a fraction of the total.
+//
+// Items are hashed the same way on every node, so the writes are recorded as
+// the commands that made them:
+//
+//	BF.RESERVE <key> <error rate> <capacity>
+//	BF.ADD <key> <item> [<item> ...]
+//	PFADD <key> [<element> ...]
+//	CMS.INITBYDIM <key> <width> <depth>
+//	CMS.INCRBY <key> <item> <increment> [<item> <increment> ...]
+//	LOADSKETCH <key> <encoding>
+//
+// LOADSKETCH replaces a key with a sketch in its compact binary encoding,
+// base64 encoded. Snapshots, and so rewritten AOFs and the full syncs of the
+// slaves, store sketches that way, as does PFMERGE for its destination.
+
+const aofLoadSketch Command = "LOADSKETCH"
+
+// Defaults of the Bloom filters created by BFAdd, and how the filters grow.
+const (
+	DefaultBloomErrorRate = 0.01
+	DefaultBloomCapacity  = 100
+
+	bloomExpansion  = 2
+	bloomTightening = 0.5
+)
+
+// hllPrecision is the number of hash bits that pick a HyperLogLog register.
+const (
+	hllPrecision = 14
+	hllRegisters = 1 << hllPrecision
+)
+
+// DefaultMaxSketchBytes is the largest memory a single sketch may take when
+// Options.MaxSketchBytes is not set.
+const DefaultMaxSketchBytes = 4 << 20
+
+var (
+	// ErrSketchParams is returned for error rates, probabilities, capacities
+	// and dimensions a sketch cannot be created with.
+	ErrSketchParams = errors.New("invalid sketch parameters")
+
+	// ErrKeyExists is returned when creating a sketch under a key that is already set.
+	ErrKeyExists = errors.New("key already exists")
+)
+
+// Magic bytes starting the binary encoding of each kind of sketch, followed
+// by the version of the encoding.
+const (
+	sketchBloom    byte = 'B'
+	sketchHLL      byte = 'H'
+	sketchCountMin byte = 'C'
+
+	sketchEncodingVersion byte = 1
+)
+
+// hashItem hashes an item to 64 bits. FNV-1a does not mix its last bytes
+// well, so the hash goes through the finalizer of SplitMix64.
+func hashItem(item string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(item))
+	return mix64(h.Sum64())
+}
+
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// hashPair derives the two hashes from which the positions of an item in a
+// Bloom filter or Count-Min sketch are computed, the i-th as h1 + i*h2.
+func hashPair(item string) (uint64, uint64) {
+	h1 := hashItem(item)
+	return h1, mix64(h1^0x9e3779b97f4a7c15) | 1
+}
+
+type bloomLayer struct {
+	bits      []byte
+	hashes    int
+	capacity  uint64
+	count     uint64
+	errorRate float64
+}
+
+type bloomValue struct {
+	layers []*bloomLayer
+}
+
+// newBloomLayer sizes a filter holding capacity items at errorRate, of at
+// most limit bytes unless limit is 0.
+func newBloomLayer(errorRate float64, capacity uint64, limit int64) (*bloomLayer, error) {
+	bitCount := math.Ceil(-float64(capacity) * math.Log(errorRate) / (math.Ln2 * math.Ln2))
+	if err := checkSketchSize(bitCount/8, limit); err != nil {
+		return nil, err
+	}
+	size := (uint64(bitCount) + 7) / 8
+	return &bloomLayer{
+		bits:      make([]byte, max(size, 1)),
+		hashes:    max(int(math.Ceil(-math.Log2(errorRate))), 1),
+		capacity:  capacity,
+		errorRate: errorRate,
+	}, nil
+}
+
+func (l *bloomLayer) contains(h1, h2 uint64) bool {
+	m := uint64(len(l.bits)) * 8
+	for i := 0; i < l.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % m
+		if l.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *bloomLayer) add(h1, h2 uint64) {
+	m := uint64(len(l.bits)) * 8
+	for i := 0; i < l.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % m
+		l.bits[bit/8] |= 1 << (bit % 8)
+	}
+	l.count++
+}
+
+// checkSketchSize fails when a sketch of size bytes is over limit, unless
+// limit is 0.
+func checkSketchSize(size float64, limit int64) error {
+	if limit > 0 && size > float64(limit) {
+		return fmt.Errorf("%w: a sketch of %.0f bytes exceeds the limit of %d bytes", ErrFull, size, limit)
+	}
+	return nil
+}
+
+func newBloomValue(errorRate float64, capacity uint64, limit int64) (*bloomValue, error) {
+	if errorRate <= 0 || errorRate >= 1 || capacity == 0 {
+		return nil, fmt.Errorf("%w: the error rate must be between 0 and 1 and the capacity positive", ErrSketchParams)
+	}
+	layer, err := newBloomLayer(errorRate, capacity, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &bloomValue{layers: []*bloomLayer{layer}}, nil
+}
+
+func (v *bloomValue) contains(item string) bool {
+	h1, h2 := hashPair(item)
+	for _, layer := range v.layers {
+		if layer.contains(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextLayer returns the filter to stack on a full Bloom filter, keeping the
+// whole filter within limit bytes unless limit is 0.
+func (v *bloomValue) nextLayer(limit int64) (*bloomLayer, error) {
+	last := v.layers[len(v.layers)-1]
+	layer, err := newBloomLayer(last.errorRate*bloomTightening, last.capacity*bloomExpansion, limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSketchSize(float64(v.size()+int64(len(layer.bits))), limit); err != nil {
+		return nil, err
+	}
+	return layer, nil
+}
+
+func (v *bloomValue) size() int64 {
+	var size int64
+	for _, layer := range v.layers {
+		size += int64(len(layer.bits))
+	}
+	return size
+}
+
+// MarshalJSON shows the capacity and size of a Bloom filter in the cache data.
+func (v *bloomValue) MarshalJSON() ([]byte, error) {
+	var capacity, items uint64
+	for _, layer := range v.layers {
+		capacity += layer.capacity
+		items += layer.count
+	}
+	return json.Marshal(map[string]interface{}{
+		"type": TypeBloom, "error_rate": v.layers[0].errorRate, "capacity": capacity, "items": items, "filters": len(v.layers),
+	})
+}
+
+type hllValue struct {
+	registers [hllRegisters]uint8
+}
+
+// add sets the register of an element to the rank of its hash and reports
+// whether that raised the register.
+func (v *hllValue) add(element string) bool {
+	h := hashItem(element)
+	index := h >> (64 - hllPrecision)
+	// The guard bit bounds the rank when the remaining bits are all zero
+	rank := uint8(bits.LeadingZeros64(h<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank <= v.registers[index] {
+		return false
+	}
+	v.registers[index] = rank
+	return true
+}
+
+func (v *hllValue) merge(other *hllValue) {
+	for i, rank := range other.registers {
+		v.registers[i] = max(v.registers[i], rank)
+	}
+}
+
+// count estimates the number of distinct elements, counting the empty
+// registers instead while many are left.
+func (v *hllValue) count() int64 {
+	const m = float64(hllRegisters)
+	sum, zeros := 0.0, 0
+	for _, rank := range v.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(estimate + 0.5)
+}
+
+// MarshalJSON shows the estimated count of a HyperLogLog in the cache data.
+func (v *hllValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"type": TypeHyperLogLog, "count": v.count()})
+}
+
+// countMinValue is the Count-Min sketch of the CMS commands, also used by the
+// W-TinyLFU policy to estimate how often keys are accessed.
+type countMinValue struct {
+	width    int
+	depth    int
+	counters []uint32
+	count    uint64
+}
+
+// newCountMinValue creates a Count-Min sketch of at most limit bytes unless
+// limit is 0.
+func newCountMinValue(width int, depth int, limit int64) (*countMinValue, error) {
+	if width <= 0 || depth <= 0 {
+		return nil, fmt.Errorf("%w: the width and depth must be positive", ErrSketchParams)
+	}
+	if err := checkSketchSize(float64(width)*float64(depth)*4, limit); err != nil {
+		return nil, err
+	}
+	return &countMinValue{width: width, depth: depth, counters: make([]uint32, width*depth)}, nil
+}
+
+// countMinDimensions returns the size of the Count-Min sketch overestimating
+// counts by at most errorRate times the total count, with the given
+// probability of doing worse.
+func countMinDimensions(errorRate float64, probability float64) (int, int, error) {
+	if errorRate <= 0 || errorRate >= 1 || probability <= 0 || probability >= 1 {
+		return 0, 0, fmt.Errorf("%w: the error rate and probability must be between 0 and 1", ErrSketchParams)
+	}
+	return int(math.Ceil(2 / errorRate)), int(math.Ceil(math.Log(probability) / math.Log(0.5))), nil
+}
+
+// counter returns the position of the counter of an item in a row.
+func (v *countMinValue) counter(row int, h1, h2 uint64) int {
+	return row*v.width + int((h1+uint64(row)*h2)%uint64(v.width))
+}
+
+// incrBy adds increment to the counters of an item, saturating at the
+// largest counter, and returns the new estimate of the item.
+func (v *countMinValue) incrBy(item string, increment uint32) int64 {
+	return v.incrByUpTo(item, increment, math.MaxUint32)
+}
+
+// incrByUpTo adds increment to the counters of an item, saturating at
+// ceiling, and returns the new estimate of the item.
+func (v *countMinValue) incrByUpTo(item string, increment uint32, ceiling uint32) int64 {
+	h1, h2 := hashPair(item)
+	estimate := ceiling
+	for row := 0; row < v.depth; row++ {
+		i := v.counter(row, h1, h2)
+		if v.counters[i] >= ceiling || ceiling-v.counters[i] < increment {
+			v.counters[i] = ceiling
+		} else {
+			v.counters[i] += increment
+		}
+		estimate = min(estimate, v.counters[i])
+	}
+	v.count += uint64(increment)
+	return int64(estimate)
+}
+
+func (v *countMinValue) query(item string) int64 {
+	h1, h2 := hashPair(item)
+	estimate := uint32(math.MaxUint32)
+	for row := 0; row < v.depth; row++ {
+		estimate = min(estimate, v.counters[v.counter(row, h1, h2)])
+	}
+	return int64(estimate)
+}
+
+// halve divides every counter and the total count by two, so the counts of
+// items that stopped being added fade away.
+func (v *countMinValue) halve() {
+	for i := range v.counters {
+		v.counters[i] >>= 1
+	}
+	v.count /= 2
+}
+
+// MarshalJSON shows the dimensions and total count of a Count-Min sketch in the cache data.
+func (v *countMinValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"type": TypeCountMin, "width": v.width, "depth": v.depth, "count": v.count})
+}
+
+// encodeSketch returns the compact binary encoding of a sketch:
+//
+//	Bloom filter:     'B' 1 <filters> then per filter <error rate> <capacity> <count> <hashes> <bytes> <bits>
+//	HyperLogLog:      'H' 1 0 <registers> <index delta> <rank> ... (sparse)
+//	                  'H' 1 1 <16384 registers of 6 bits> (dense)
+//	Count-Min sketch: 'C' 1 <width> <depth> <count> <counters>
+//
+// Integers are unsigned varints and error rates 64-bit floats. A HyperLogLog
+// is written sparse, only its raised registers, while that is smaller. A zero
+// counter of a Count-Min sketch is followed by the number of zeros after it.
+func encodeSketch(data interface{}) []byte {
+	switch v := data.(type) {
+	case *bloomValue:
+		buf := []byte{sketchBloom, sketchEncodingVersion}
+		buf = binary.AppendUvarint(buf, uint64(len(v.layers)))
+		for _, layer := range v.layers {
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(layer.errorRate))
+			buf = binary.AppendUvarint(buf, layer.capacity)
+			buf = binary.AppendUvarint(buf, layer.count)
+			buf = binary.AppendUvarint(buf, uint64(layer.hashes))
+			buf = binary.AppendUvarint(buf, uint64(len(layer.bits)))
+			buf = append(buf, layer.bits...)
+		}
+		return buf
+
+	case *hllValue:
+		sparse := []byte{sketchHLL, sketchEncodingVersion, 0}
+		var raised []byte
+		count, previous := 0, 0
+		for i, rank := range v.registers {
+			if rank == 0 {
+				continue
+			}
+			raised = binary.AppendUvarint(raised, uint64(i-previous))
+			raised = append(raised, rank)
+			count, previous = count+1, i
+		}
+		sparse = append(binary.AppendUvarint(sparse, uint64(count)), raised...)
+		if len(sparse) < hllRegisters*6/8+3 {
+			return sparse
+		}
+
+		dense := make([]byte, 3, hllRegisters*6/8+3)
+		copy(dense, []byte{sketchHLL, sketchEncodingVersion, 1})
+		for i := 0; i < hllRegisters; i += 4 {
+			packed := uint32(v.registers[i]) | uint32(v.registers[i+1])<<6 | uint32(v.registers[i+2])<<12 | uint32(v.registers[i+3])<<18
+			dense = append(dense, byte(packed), byte(packed>>8), byte(packed>>16))
+		}
+		return dense
+
+	case *countMinValue:
+		buf := []byte{sketchCountMin, sketchEncodingVersion}
+		buf = binary.AppendUvarint(buf, uint64(v.width))
+		buf = binary.AppendUvarint(buf, uint64(v.depth))
+		buf = binary.AppendUvarint(buf, v.count)
+		for i := 0; i < len(v.counters); i++ {
+			buf = binary.AppendUvarint(buf, uint64(v.counters[i]))
+			if v.counters[i] != 0 {
+				continue
+			}
+			zeros := 0
+			for i+1 < len(v.counters) && v.counters[i+1] == 0 {
+				zeros, i = zeros+1, i+1
+			}
+			buf = binary.AppendUvarint(buf, uint64(zeros))
+		}
+		return buf
+
+	default:
+		return nil
+	}
+}
+
+// sketchReader reads the fields of an encoded sketch, remembering the first
+// field that could not be read.
+type sketchReader struct {
+	buf []byte
+	err error
+}
+
+func (r *sketchReader) uvarint() uint64 {
+	value, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return value
+}
+
+func (r *sketchReader) float64() float64 {
+	if len(r.buf) < 8 {
+		r.fail()
+		return 0
+	}
+	value := math.Float64frombits(binary.LittleEndian.Uint64(r.buf))
+	r.buf = r.buf[8:]
+	return value
+}
+
+func (r *sketchReader) bytes(n uint64) []byte {
+	if uint64(len(r.buf)) < n {
+		r.fail()
+		return nil
+	}
+	value := r.buf[:n]
+	r.buf = r.buf[n:]
+	return value
+}
+
+func (r *sketchReader) fail() {
+	if r.err == nil {
+		r.err = errors.New("truncated sketch encoding")
+	}
+	r.buf = nil
+}
+
+// decodeSketch parses the encoding written by encodeSketch. Count-Min
+// sketches, whose size the encoding does not bound, must fit in limit bytes
+// unless limit is 0.
+func decodeSketch(buf []byte, limit int64) (interface{}, error) {
+	if len(buf) < 2 {
+		return nil, errors.New("truncated sketch encoding")
+	}
+	if buf[1] != sketchEncodingVersion {
+		return nil, fmt.Errorf("unsupported sketch encoding version %d", buf[1])
+	}
+	r := &sketchReader{buf: buf[2:]}
+
+	switch buf[0] {
+	case sketchBloom:
+		layers := r.uvarint()
+		if layers == 0 || layers > 64 {
+			return nil, errors.New("invalid number of Bloom filters")
+		}
+		v := &bloomValue{}
+		for i := uint64(0); i < layers && r.err == nil; i++ {
+			layer := &bloomLayer{}
+			layer.errorRate = r.float64()
+			layer.capacity = r.uvarint()
+			layer.count = r.uvarint()
+			layer.hashes = int(r.uvarint())
+			layer.bits = append([]byte(nil), r.bytes(r.uvarint())...)
+			if r.err == nil && (len(layer.bits) == 0 || layer.hashes <= 0 || layer.hashes > 64) {
+				return nil, errors.New("invalid Bloom filter")
+			}
+			v.layers = append(v.layers, layer)
+		}
+		return v, r.err
+
+	case sketchHLL:
+		v := &hllValue{}
+		switch mode := r.bytes(1); {
+		case r.err != nil:
+		case mode[0] == 0:
+			index := uint64(0)
+			for n := r.uvarint(); n > 0 && r.err == nil; n-- {
+				index += r.uvarint()
+				rank := r.bytes(1)
+				if r.err == nil && index >= hllRegisters {
+					return nil, errors.New("invalid HyperLogLog register")
+				}
+				if r.err == nil {
+					v.registers[index] = rank[0]
+				}
+			}
+		case mode[0] == 1:
+			packed := r.bytes(hllRegisters * 6 / 8)
+			for i := 0; r.err == nil && i < hllRegisters; i += 4 {
+				word := uint32(packed[i/4*3]) | uint32(packed[i/4*3+1])<<8 | uint32(packed[i/4*3+2])<<16
+				for j := 0; j < 4; j++ {
+					v.registers[i+j] = uint8(word >> (6 * j) & 0x3f)
+				}
+			}
+		default:
+			return nil, errors.New("invalid HyperLogLog encoding")
+		}
+		return v, r.err
+
+	case sketchCountMin:
+		width, depth := r.uvarint(), r.uvarint()
+		count := r.uvarint()
+		if r.err != nil {
+			return nil, r.err
+		}
+		if width > math.MaxInt32 || depth > math.MaxInt32 {
+			return nil, errors.New("invalid Count-Min sketch dimensions")
+		}
+		v, err := newCountMinValue(int(width), int(depth), limit)
+		if err != nil {
+			return nil, err
+		}
+		v.count = count
+		for i := 0; i < len(v.counters) && r.err == nil; i++ {
+			v.counters[i] = uint32(min(r.uvarint(), math.MaxUint32))
+			if v.counters[i] == 0 {
+				// The zeros that follow are already in place
+				i += int(min(r.uvarint(), uint64(len(v.counters)-i-1)))
+			}
+		}
+		return v, r.err
+
+	default:
+		return nil, fmt.Errorf("unknown sketch type %q", buf[0])
+	}
+}
+
+// BFReserve creates an empty Bloom filter under key, sized for capacity
+// items at errorRate before it grows. It fails with ErrKeyExists when the key
+// is set.
+func (c *Cache) BFReserve(key string, errorRate float64, capacity int) error {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if capacity <= 0 {
+		return fmt.Errorf("%w: the capacity must be positive", ErrSketchParams)
+	}
+	return s.bfReserve(key, errorRate, uint64(capacity))
+}
+
+// bfReserve creates an empty Bloom filter under key. The caller must hold s.mutex.
+func (s *shard) bfReserve(key string, errorRate float64, capacity uint64) error {
+	if _, exists := s.lookup(key); exists {
+		return ErrKeyExists
+	}
+	bloom, err := newBloomValue(errorRate, capacity, s.cache.sketchLimit())
+	if err != nil {
+		return err
+	}
+	if err := s.reserveSketch(bloom.size(), bloom.size()); err != nil {
+		return err
+	}
+
+	node := newNode(key, bloom)
+	s.insert(node)
+	s.cache.writeNodeRecord(node, string(CMDBFReserve), key, strconv.FormatFloat(errorRate, 'g', -1, 64), strconv.FormatUint(capacity, 10))
+	s.resize(node, 0)
+	return nil
+}
+
+// BFAdd adds items to the Bloom filter stored under key, creating one with
+// DefaultBloomErrorRate and DefaultBloomCapacity when the key does not exist.
+// It reports for each item whether it was new, that is not already in the
+// filter or mistaken for an item that is.
+func (c *Cache) BFAdd(key string, items ...string) ([]bool, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.bfAdd(key, items...)
+}
+
+// bfAdd adds items to the Bloom filter stored under key. The caller must hold s.mutex.
+func (s *shard) bfAdd(key string, items ...string) ([]bool, error) {
+	node, err := s.lookupOrCreate(key, TypeBloom)
+	if err != nil {
+		return nil, err
+	}
+
+	bloom := node.Data.(*bloomValue)
+	record := []string{string(CMDBFAdd), key}
+	added := make([]bool, len(items))
+	var delta int64
+	for i, item := range items {
+		if bloom.contains(item) {
+			continue
+		}
+		last := bloom.layers[len(bloom.layers)-1]
+		if last.count >= last.capacity {
+			if last, err = bloom.nextLayer(s.cache.sketchLimit()); err == nil {
+				err = s.reserveSketch(bloom.size()+int64(len(last.bits)), int64(len(last.bits)))
+			}
+			if err != nil {
+				break
+			}
+			bloom.layers = append(bloom.layers, last)
+			delta += int64(len(last.bits))
+		}
+		last.add(hashPair(item))
+		added[i] = true
+		record = append(record, item)
+	}
+
+	if len(record) > 2 {
+		s.cache.writeNodeRecord(node, record...)
+	}
+	s.resize(node, delta)
+
+	return added, err
+}
+
+// BFExists reports for each item whether it may have been added to the Bloom
+// filter stored under key. A missing key holds no item.
+func (c *Cache) BFExists(key string, items ...string) ([]bool, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	exists := make([]bool, len(items))
+	node, err := s.lookupTyped(key, TypeBloom)
+	if err != nil || node == nil {
+		return exists, err
+	}
+	for i, item := range items {
+		exists[i] = node.Data.(*bloomValue).contains(item)
+	}
+	return exists, nil
+}
+
+// PFAdd adds elements to the HyperLogLog stored under key, creating it when
+// the key does not exist, and reports whether the estimated count may have
+// changed.
+func (c *Cache) PFAdd(key string, elements ...string) (bool, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.pfadd(key, elements...)
+}
+
+// pfadd adds elements to the HyperLogLog stored under key. The caller must hold s.mutex.
+func (s *shard) pfadd(key string, elements ...string) (bool, error) {
+	_, existed := s.lookup(key)
+	if !existed {
+		if err := s.reserveSketch(hllRegisters, hllRegisters); err != nil {
+			return false, err
+		}
+	}
+	node, err := s.lookupOrCreate(key, TypeHyperLogLog)
+	if err != nil {
+		return false, err
+	}
+
+	hll := node.Data.(*hllValue)
+	changed := !existed
+	for _, element := range elements {
+		if hll.add(element) {
+			changed = true
+		}
+	}
+
+	if changed {
+		s.cache.writeNodeRecord(node, append([]string{string(CMDPFAdd), key}, elements...)...)
+	}
+	s.resize(node, 0)
+
+	return changed, nil
+}
+
+// PFCount estimates the number of distinct elements added to the
+// HyperLogLogs stored under keys, counting every element once across them.
+// Missing keys count as empty.
+func (c *Cache) PFCount(keys ...string) (int64, error) {
+	unlock := c.lockKeys(keys...)
+	defer unlock()
+
+	union, err := c.mergeHLLs(keys)
+	if err != nil {
+		return 0, err
+	}
+	return union.count(), nil
+}
+
+// mergeHLLs returns the union of the HyperLogLogs stored under keys. The
+// caller must hold the locks of their shards.
+func (c *Cache) mergeHLLs(keys []string) (*hllValue, error) {
+	union := &hllValue{}
+	for _, key := range keys {
+		node, err := c.shardFor(key).lookupTyped(key, TypeHyperLogLog)
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			union.merge(node.Data.(*hllValue))
+		}
+	}
+	return union, nil
+}
+
+// PFMerge stores under dest the union of the HyperLogLogs stored under dest
+// and sources. The union is recorded as a whole, so replaying it does not
+// depend on the sources.
+func (c *Cache) PFMerge(dest string, sources ...string) error {
+	unlock := c.lockKeys(append([]string{dest}, sources...)...)
+	defer unlock()
+
+	union, err := c.mergeHLLs(append([]string{dest}, sources...))
+	if err != nil {
+		return err
+	}
+
+	s := c.shardFor(dest)
+	if _, exists := s.lookup(dest); !exists {
+		if err := s.reserveSketch(hllRegisters, hllRegisters); err != nil {
+			return err
+		}
+	}
+	return s.loadSketch(dest, union)
+}
+
+// CMSInitByDim creates a Count-Min sketch under key with width counters in
+// each of depth rows. It fails with ErrKeyExists when the key is set.
+func (c *Cache) CMSInitByDim(key string, width int, depth int) error {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.cmsInit(key, width, depth)
+}
+
+// CMSInitByProb creates a Count-Min sketch under key overestimating counts
+// by at most errorRate times the total count, except with the given
+// probability. It fails with ErrKeyExists when the key is set.
+func (c *Cache) CMSInitByProb(key string, errorRate float64, probability float64) error {
+	width, depth, err := countMinDimensions(errorRate, probability)
+	if err != nil {
+		return err
+	}
+	return c.CMSInitByDim(key, width, depth)
+}
+
+// cmsInit creates a Count-Min sketch under key. The caller must hold s.mutex.
+func (s *shard) cmsInit(key string, width int, depth int) error {
+	if _, exists := s.lookup(key); exists {
+		return ErrKeyExists
+	}
+	cms, err := newCountMinValue(width, depth, s.cache.sketchLimit())
+	if err != nil {
+		return err
+	}
+	if err := s.reserveSketch(valueSize(cms), valueSize(cms)); err != nil {
+		return err
+	}
+
+	node := newNode(key, cms)
+	s.insert(node)
+	s.cache.writeNodeRecord(node, string(CMDCMSInitByDim), key, strconv.Itoa(width), strconv.Itoa(depth))
+	s.resize(node, 0)
+	return nil
+}
+
+// CMSIncrBy adds the increments to the counts of their items in the Count-Min
+// sketch stored under key and returns the new estimated counts. The sketch
+// must have been created with CMSInitByDim or CMSInitByProb.
+func (c *Cache) CMSIncrBy(key string, increments map[string]int64) (map[string]int64, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.cmsIncrBy(key, increments)
+}
+
+// cmsIncrBy adds to the counts of items in the Count-Min sketch stored under
+// key. The caller must hold s.mutex.
+func (s *shard) cmsIncrBy(key string, increments map[string]int64) (map[string]int64, error) {
+	for _, increment := range increments {
+		if increment <= 0 || increment > math.MaxUint32 {
+			return nil, fmt.Errorf("%w: increments must be between 1 and %d", ErrSketchParams, uint32(math.MaxUint32))
+		}
+	}
+	node, err := s.lookupTyped(key, TypeCountMin)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, ErrNotFound
+	}
+
+	cms := node.Data.(*countMinValue)
+	record := []string{string(CMDCMSIncrBy), key}
+	counts := make(map[string]int64, len(increments))
+	for item, increment := range increments {
+		counts[item] = cms.incrBy(item, uint32(increment))
+		record = append(record, item, strconv.FormatInt(increment, 10))
+	}
+
+	if len(increments) > 0 {
+		s.cache.writeNodeRecord(node, record...)
+	}
+	s.resize(node, 0)
+
+	return counts, nil
+}
+
+// CMSQuery returns the estimated counts of items in the Count-Min sketch stored under key.
+func (c *Cache) CMSQuery(key string, items ...string) ([]int64, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	node, err := s.lookupTyped(key, TypeCountMin)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, ErrNotFound
+	}
+
+	counts := make([]int64, len(items))
+	for i, item := range items {
+		counts[i] = node.Data.(*countMinValue).query(item)
+	}
+	return counts, nil
+}
+
+// sketchLimit returns the largest memory a single sketch may take in bytes, 0
+// for no limit.
+func (c *Cache) sketchLimit() int64 {
+	switch limit := c.options.MaxSketchBytes; {
+	case limit == 0:
+		return DefaultMaxSketchBytes
+	case limit < 0:
+		return 0
+	default:
+		return limit
+	}
+}
+
+// reserveSketch checks that a sketch of size bytes fits in the shard, whose
+// entry limit it only takes one of, and makes room for extra more bytes under
+// maxmemory. The caller must hold s.mutex.
+func (s *shard) reserveSketch(size int64, extra int64) error {
+	if s.maxBytes > 0 && size > s.maxBytes {
+		return fmt.Errorf("%w: sketch of %d bytes exceeds shard capacity of %d bytes", ErrFull, size, s.maxBytes)
+	}
+	return s.reserveMemory(extra)
+}
+
+// loadSketch stores a sketch under key, replacing its value but keeping its
+// expiry, and records it in its binary encoding. The caller must hold s.mutex.
+func (s *shard) loadSketch(key string, data interface{}) error {
+	node, exists := s.lookup(key)
+	if exists {
+		s.replaceData(node, data)
+		s.touch(node)
+	} else {
+		node = newNode(key, data)
+		s.insert(node)
+	}
+
+	s.cache.writeNodeRecord(node, string(aofLoadSketch), key, base64.StdEncoding.EncodeToString(encodeSketch(data)))
+	s.resize(node, 0)
+	return nil
+}
+
+// applySketchCommand replays the records of sketches. The caller must hold s.mutex.
+func (s *shard) applySketchCommand(command Command, args []string) error {
+	switch {
+	case command == CMDBFReserve && len(args) == 3:
+		errorRate, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return fmt.Errorf("invalid error rate in BF.RESERVE record: %v", err)
+		}
+		capacity, err := strconv.ParseUint(args[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid capacity in BF.RESERVE record: %v", err)
+		}
+		return s.bfReserve(args[0], errorRate, capacity)
+
+	case command == CMDBFAdd && len(args) >= 2:
+		_, err := s.bfAdd(args[0], args[1:]...)
+		return err
+
+	case command == CMDPFAdd && len(args) >= 1:
+		_, err := s.pfadd(args[0], args[1:]...)
+		return err
+
+	case command == CMDCMSInitByDim && len(args) == 3:
+		width, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid width in CMS.INITBYDIM record: %v", err)
+		}
+		depth, err := strconv.Atoi(args[2])
+		if err != nil {
+			return fmt.Errorf("invalid depth in CMS.INITBYDIM record: %v", err)
+		}
+		return s.cmsInit(args[0], width, depth)
+
+	case command == CMDCMSIncrBy && len(args) >= 3 && len(args)%2 == 1:
+		increments := make(map[string]int64, len(args)/2)
+		for i := 1; i < len(args); i += 2 {
+			increment, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid increment in CMS.INCRBY record: %v", err)
+			}
+			increments[args[i]] += increment
+		}
+		_, err := s.cmsIncrBy(args[0], increments)
+		return err
+
+	case command == aofLoadSketch && len(args) == 2:
+		encoded, err := base64.StdEncoding.DecodeString(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid LOADSKETCH record: %v", err)
+		}
+		data, err := decodeSketch(encoded, s.cache.sketchLimit())
+		if err != nil {
+			return fmt.Errorf("invalid LOADSKETCH record: %v", err)
+		}
+		return s.loadSketch(args[0], data)
+
+	default:
+		return fmt.Errorf("invalid record: %s", formatRecord(append([]string{string(command)}, args...)...))
+	}
+}
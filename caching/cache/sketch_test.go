@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestSketchSizeLimits(t *testing.T) {
+	c := NewCacheWithOptions(Options{MaxSketchBytes: 64 << 10})
+	defer c.Close()
+
+	if err := c.CMSInitByDim("small", 1000, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CMSInitByDim("large", 100000, 5); !errors.Is(err, ErrFull) {
+		t.Fatalf("CMSInitByDim over the limit = %v, want ErrFull", err)
+	}
+	if err := c.BFReserve("large", 0.001, 1000000); !errors.Is(err, ErrFull) {
+		t.Fatalf("BFReserve over the limit = %v, want ErrFull", err)
+	}
+
+	// A growing Bloom filter stops at the limit, keeping the items added so far
+	if err := c.BFReserve("seen", 0.01, 1000); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	added := 0
+	for i := 0; err == nil && i < 1000000; i++ {
+		var results []bool
+		results, err = c.BFAdd("seen", strconv.Itoa(i))
+		if err == nil && results[0] {
+			added++
+		}
+	}
+	if !errors.Is(err, ErrFull) {
+		t.Fatalf("BFAdd past the limit = %v, want ErrFull", err)
+	}
+	exists, err := c.BFExists("seen", "0", strconv.Itoa(added-1))
+	if err != nil || !exists[0] || !exists[1] {
+		t.Fatalf("BFExists = %v, %v, want the added items", exists, err)
+	}
+}
+
+func TestSketchShardCapacity(t *testing.T) {
+	c := NewCacheWithOptions(Options{MaxBytes: 64 << 10, Shards: 1})
+	defer c.Close()
+
+	if err := c.CMSInitByDim("hits", 100000, 1); !errors.Is(err, ErrFull) {
+		t.Fatalf("CMSInitByDim over the shard capacity = %v, want ErrFull", err)
+	}
+	if _, err := c.PFAdd("visitors", "a"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSketchEncodingRoundTrip(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	if _, err := c.BFAdd("seen", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.PFAdd("visitors", "a", "b", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CMSInitByDim("hits", 100, 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CMSIncrBy("hits", map[string]int64{"a": 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	replica := NewCache()
+	defer replica.Close()
+	for _, record := range c.Dump() {
+		if err := replica.ApplyRecord(record); err != nil {
+			t.Fatalf("ApplyRecord(%q) = %v", record, err)
+		}
+	}
+	if exists, err := replica.BFExists("seen", "a", "b"); err != nil || !exists[0] || !exists[1] {
+		t.Fatalf("BFExists = %v, %v", exists, err)
+	}
+	if count, err := replica.PFCount("visitors"); err != nil || count != 3 {
+		t.Fatalf("PFCount = %d, %v, want 3", count, err)
+	}
+	if counts, err := replica.CMSQuery("hits", "a"); err != nil || counts[0] != 3 {
+		t.Fatalf("CMSQuery = %v, %v, want [3]", counts, err)
+	}
+}
+
+func TestCountMinSaturatesAndHalves(t *testing.T) {
+	cms, err := newCountMinValue(64, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		cms.incrByUpTo("hot", 1, tinyLFUMaxCount)
+	}
+	cms.incrByUpTo("warm", 4, tinyLFUMaxCount)
+	if got := cms.query("hot"); got != tinyLFUMaxCount {
+		t.Fatalf("query(hot) = %d, want the ceiling %d", got, tinyLFUMaxCount)
+	}
+
+	cms.halve()
+	if got := cms.query("hot"); got != tinyLFUMaxCount/2 {
+		t.Fatalf("query(hot) after halving = %d, want %d", got, tinyLFUMaxCount/2)
+	}
+	if got := cms.query("warm"); got < 2 {
+		t.Fatalf("query(warm) after halving = %d, want at least 2", got)
+	}
+	if cms.count != 12 {
+		t.Fatalf("count after halving = %d, want 12", cms.count)
+	}
+}
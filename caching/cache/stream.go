@@ -0,0 +1,854 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A stream is an append-only log of entries, each a set of fields under an ID
+// made of a millisecond timestamp and a sequence number. Consumer groups read
+// a stream together: every new entry is delivered to one consumer of the group
+// and stays pending until that consumer acknowledges it.
+//
+// Writes are recorded with the IDs they resolved to, and deliveries with
+// their time and count, so replaying them rebuilds the same stream and groups:
+//
+//	XADD <key> [MAXLEN <n>] <id> <field> <value> [<field> <value> ...]
+//	XTRIM <key> <maxlen>
+//	XGROUPCREATE <key> <group> <id>
+//	XDELIVER <key> <group> <consumer> <time-ms> <id> <deliveries> [<id> <deliveries> ...]
+//	XACK <key> <group> <id> [<id> ...]
+//	XSETID <key> <id>
+//
+// XDELIVER sets the pending entries it names, a count of 0 marking an entry
+// delivered without being kept pending. XSETID restores the last ID of a
+// stream in snapshots, since trimmed entries no longer show it.
+
+const (
+	aofXGroupCreate Command = "XGROUPCREATE"
+	aofXDeliver     Command = "XDELIVER"
+	aofXSetID       Command = "XSETID"
+)
+
+// streamEntryOverhead is the size accounted to an entry besides its fields, for its ID.
+const streamEntryOverhead = 16
+
+var (
+	// ErrStreamID is returned by XAdd for IDs not greater than the last ID of the stream.
+	ErrStreamID = errors.New("the ID specified in XADD is equal or smaller than the target stream top item")
+
+	// ErrInvalidStreamID is returned for IDs that are not of the form <ms>-<seq>.
+	ErrInvalidStreamID = errors.New("invalid stream ID")
+
+	// ErrNoGroup is returned when the stream or its consumer group does not exist.
+	ErrNoGroup = errors.New("NOGROUP no such key or consumer group")
+
+	// ErrGroupExists is returned when creating a consumer group that already exists.
+	ErrGroupExists = errors.New("BUSYGROUP consumer group name already exists")
+)
+
+// StreamID identifies an entry of a stream. IDs increase along the stream.
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+func (id StreamID) less(other StreamID) bool {
+	return id.Ms < other.Ms || (id.Ms == other.Ms && id.Seq < other.Seq)
+}
+
+// ParseStreamID parses an ID written as <ms>-<seq>, or as <ms> for the first
+// ID of that millisecond.
+func ParseStreamID(value string) (StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(value, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+	var seq uint64
+	if hasSeq {
+		if seq, err = strconv.ParseUint(seqPart, 10, 64); err != nil {
+			return StreamID{}, ErrInvalidStreamID
+		}
+	}
+	return StreamID{Ms: ms, Seq: seq}, nil
+}
+
+// parseRangeBound parses a bound of XRANGE: "-" and "+" stand for the first
+// and last possible IDs, and a bare <ms> covers the whole millisecond.
+func parseRangeBound(value string, end bool) (StreamID, error) {
+	switch value {
+	case "-":
+		return StreamID{}, nil
+	case "+":
+		return StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}, nil
+	}
+	id, err := ParseStreamID(value)
+	if err == nil && end && !strings.Contains(value, "-") {
+		id.Seq = math.MaxUint64
+	}
+	return id, err
+}
+
+// StreamEntry is an entry of a stream. Entries read again by a consumer after
+// they were trimmed have no fields.
+type StreamEntry struct {
+	ID     string
+	Fields map[string][]byte
+}
+
+// PendingEntry is an entry delivered to a consumer of a group and not yet
+// acknowledged.
+type PendingEntry struct {
+	ID         string
+	Consumer   string
+	Idle       time.Duration // Time since the last delivery
+	Deliveries int64
+}
+
+type streamValue struct {
+	entries []streamEntry // Ordered by ID
+	trimmed int           // Entries trimmed off the front of entries since it was last compacted
+	lastID  StreamID      // Highest ID ever added, even if trimmed since
+	groups  map[string]*consumerGroup
+}
+
+type streamEntry struct {
+	id     StreamID
+	fields []string // Field and value pairs, ordered by field
+}
+
+type consumerGroup struct {
+	lastDelivered StreamID
+	pending       map[StreamID]*pendingEntry
+}
+
+type pendingEntry struct {
+	consumer    string
+	deliveredAt time.Time
+	deliveries  int64
+}
+
+func newStreamValue() *streamValue {
+	return &streamValue{groups: make(map[string]*consumerGroup)}
+}
+
+func (e streamEntry) size() int64 {
+	size := int64(streamEntryOverhead)
+	for _, field := range e.fields {
+		size += int64(len(field))
+	}
+	return size
+}
+
+func (e streamEntry) export() StreamEntry {
+	fields := make(map[string][]byte, len(e.fields)/2)
+	for i := 0; i < len(e.fields); i += 2 {
+		fields[e.fields[i]] = []byte(e.fields[i+1])
+	}
+	return StreamEntry{ID: e.id.String(), Fields: fields}
+}
+
+// after returns the index of the first entry with an ID greater than id.
+func (v *streamValue) after(id StreamID) int {
+	return sort.Search(len(v.entries), func(i int) bool { return id.less(v.entries[i].id) })
+}
+
+// find returns the entry with the given ID.
+func (v *streamValue) find(id StreamID) (streamEntry, bool) {
+	i := sort.Search(len(v.entries), func(i int) bool { return !v.entries[i].id.less(id) })
+	if i < len(v.entries) && v.entries[i].id == id {
+		return v.entries[i], true
+	}
+	return streamEntry{}, false
+}
+
+// nextID returns the ID generated for a new entry: the current millisecond,
+// or the next sequence number of the last ID when the clock is behind it.
+func (v *streamValue) nextID(now time.Time) StreamID {
+	ms := uint64(now.UnixMilli())
+	if ms > v.lastID.Ms {
+		return StreamID{Ms: ms}
+	}
+	return StreamID{Ms: v.lastID.Ms, Seq: v.lastID.Seq + 1}
+}
+
+// trim removes the oldest entries beyond maxLen and returns how many were
+// removed and the size they held. The entries are resliced rather than copied,
+// and only compacted once the trimmed head outgrows the rest of the array, so
+// a capped XADD costs O(1) amortized.
+func (v *streamValue) trim(maxLen int) (int, int64) {
+	excess := len(v.entries) - maxLen
+	if excess <= 0 {
+		return 0, 0
+	}
+	var size int64
+	for i := range v.entries[:excess] {
+		size += v.entries[i].size()
+		v.entries[i] = streamEntry{}
+	}
+	v.entries = v.entries[excess:]
+	v.trimmed += excess
+	if v.trimmed > cap(v.entries) {
+		v.entries = append(make([]streamEntry, 0, len(v.entries)), v.entries...)
+		v.trimmed = 0
+	}
+	return excess, size
+}
+
+// MarshalJSON shows the entries of a stream in the cache data.
+func (v *streamValue) MarshalJSON() ([]byte, error) {
+	entries := make([]map[string]string, len(v.entries))
+	for i, entry := range v.entries {
+		fields := map[string]string{"id": entry.id.String()}
+		for j := 0; j < len(entry.fields); j += 2 {
+			fields[entry.fields[j]] = entry.fields[j+1]
+		}
+		entries[i] = fields
+	}
+	return json.Marshal(entries)
+}
+
+// XAdd appends an entry with fields to the stream stored under key, creating
+// it if needed, and returns the ID of the entry. id is "*" to generate one
+// greater than every ID of the stream. With maxLen above 0 the oldest entries
+// are trimmed so the stream keeps at most maxLen.
+func (c *Cache) XAdd(key string, id string, fields map[string][]byte, maxLen int) (string, error) {
+	if len(fields) == 0 {
+		return "", errors.New("an entry needs at least one field")
+	}
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, 2*len(fields))
+	for _, field := range names {
+		pairs = append(pairs, field, string(fields[field]))
+	}
+
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	added, err := s.xadd(key, id, pairs, maxLen)
+	if err != nil {
+		return "", err
+	}
+	return added.String(), nil
+}
+
+// xadd appends an entry to the stream stored under key and wakes the reads
+// blocked on it. The caller must hold s.mutex.
+func (s *shard) xadd(key string, id string, fields []string, maxLen int) (StreamID, error) {
+	var explicit StreamID
+	if id != "*" {
+		var err error
+		if explicit, err = ParseStreamID(id); err != nil {
+			return StreamID{}, err
+		}
+		if explicit == (StreamID{}) {
+			return StreamID{}, ErrStreamID
+		}
+	}
+
+	node, err := s.lookupOrCreate(key, TypeStream)
+	if err != nil {
+		return StreamID{}, err
+	}
+	stream := node.Data.(*streamValue)
+	added := explicit
+	if id == "*" {
+		added = stream.nextID(time.Now())
+	} else if !stream.lastID.less(explicit) {
+		return StreamID{}, ErrStreamID
+	}
+
+	entry := streamEntry{id: added, fields: fields}
+	stream.entries = append(stream.entries, entry)
+	stream.lastID = added
+	delta := entry.size()
+
+	record := []string{string(CMDXAdd), key}
+	if maxLen > 0 {
+		_, trimmed := stream.trim(maxLen)
+		delta -= trimmed
+		record = append(record, "MAXLEN", strconv.Itoa(maxLen))
+	}
+	record = append(append(record, added.String()), fields...)
+
+	s.cache.writeNodeRecord(node, record...)
+	s.resize(node, delta)
+	s.wakeReaders(key)
+
+	return added, nil
+}
+
+// XTrim removes the oldest entries of the stream stored under key so it keeps
+// at most maxLen, and returns how many were removed.
+func (c *Cache) XTrim(key string, maxLen int) (int, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.xtrim(key, maxLen)
+}
+
+// xtrim trims the stream stored under key. The caller must hold s.mutex.
+func (s *shard) xtrim(key string, maxLen int) (int, error) {
+	node, err := s.lookupTyped(key, TypeStream)
+	if err != nil || node == nil {
+		return 0, err
+	}
+
+	removed, size := node.Data.(*streamValue).trim(max(maxLen, 0))
+	if removed > 0 {
+		s.cache.writeNodeRecord(node, string(CMDXTrim), key, strconv.Itoa(max(maxLen, 0)))
+		s.resize(node, -size)
+	}
+	return removed, nil
+}
+
+// XLen returns the number of entries of the stream stored under key.
+func (c *Cache) XLen(key string) (int, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	node, err := s.lookupTyped(key, TypeStream)
+	if err != nil || node == nil {
+		return 0, err
+	}
+	return len(node.Data.(*streamValue).entries), nil
+}
+
+// XRange returns the entries of the stream stored under key with an ID
+// between start and end, both inclusive, at most count of them when count is
+// above 0. "-" and "+" stand for the first and last entries.
+func (c *Cache) XRange(key string, start string, end string, count int) ([]StreamEntry, error) {
+	from, err := parseRangeBound(start, false)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseRangeBound(end, true)
+	if err != nil {
+		return nil, err
+	}
+
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	node, err := s.lookupTyped(key, TypeStream)
+	if err != nil || node == nil {
+		return []StreamEntry{}, err
+	}
+
+	entries := make([]StreamEntry, 0)
+	stream := node.Data.(*streamValue)
+	for i := sort.Search(len(stream.entries), func(i int) bool { return !stream.entries[i].id.less(from) }); i < len(stream.entries); i++ {
+		if to.less(stream.entries[i].id) || (count > 0 && len(entries) == count) {
+			break
+		}
+		entries = append(entries, stream.entries[i].export())
+	}
+	return entries, nil
+}
+
+// XRead returns, for each stream stored under keys, its entries with an ID
+// greater than the ID at the same position of ids, at most count per stream
+// when count is above 0. "$" stands for the last ID of the stream. Streams
+// without such entries are left out. When none has any, XRead waits up to
+// block for one to be added, and a negative block waits until ctx is done.
+func (c *Cache) XRead(ctx context.Context, keys []string, ids []string, count int, block time.Duration) (map[string][]StreamEntry, error) {
+	if len(keys) == 0 || len(keys) != len(ids) {
+		return nil, errors.New("every stream needs an ID")
+	}
+	from := make([]StreamID, len(keys))
+	for i, key := range keys {
+		if ids[i] != "$" {
+			var err error
+			if from[i], err = ParseStreamID(ids[i]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		s := c.shardFor(key)
+		s.mutex.Lock()
+		if node, exists := s.lookup(key); exists {
+			if stream, ok := node.Data.(*streamValue); ok {
+				from[i] = stream.lastID
+			}
+		}
+		s.mutex.Unlock()
+	}
+
+	return c.readStreams(ctx, keys, block, func(s *shard, i int) ([]StreamEntry, error) {
+		node, err := s.lookupTyped(keys[i], TypeStream)
+		if err != nil || node == nil {
+			return nil, err
+		}
+		stream := node.Data.(*streamValue)
+		var entries []StreamEntry
+		for _, entry := range stream.entries[stream.after(from[i]):] {
+			if count > 0 && len(entries) == count {
+				break
+			}
+			entries = append(entries, entry.export())
+		}
+		return entries, nil
+	})
+}
+
+// XGroupCreate creates a consumer group of the stream stored under key, which
+// will be delivered the entries after id, "$" standing for the last ID of the
+// stream. With mkStream an empty stream is created when the key does not
+// exist; otherwise the call fails with ErrNotFound.
+func (c *Cache) XGroupCreate(key string, group string, id string, mkStream bool) error {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	node, err := s.lookupTyped(key, TypeStream)
+	if err != nil {
+		return err
+	}
+	if node == nil && !mkStream {
+		return ErrNotFound
+	}
+	if node != nil {
+		if _, exists := node.Data.(*streamValue).groups[group]; exists {
+			return ErrGroupExists
+		}
+	}
+
+	var start StreamID
+	if id == "$" {
+		if node != nil {
+			start = node.Data.(*streamValue).lastID
+		}
+	} else if start, err = ParseStreamID(id); err != nil {
+		return err
+	}
+	return s.xgroupCreate(key, group, start)
+}
+
+// xgroupCreate creates a consumer group, and the stream when it does not
+// exist. The caller must hold s.mutex.
+func (s *shard) xgroupCreate(key string, group string, start StreamID) error {
+	node, err := s.lookupOrCreate(key, TypeStream)
+	if err != nil {
+		return err
+	}
+	node.Data.(*streamValue).groups[group] = &consumerGroup{
+		lastDelivered: start,
+		pending:       make(map[StreamID]*pendingEntry),
+	}
+
+	s.cache.writeNodeRecord(node, string(aofXGroupCreate), key, group, start.String())
+	s.resize(node, 0)
+	return nil
+}
+
+// XReadGroup reads the streams stored under keys as consumer of group. An ID
+// of ">" delivers the entries no consumer of the group was given yet, which
+// stay pending until acknowledged unless noAck is set, and waits for new ones
+// like XRead. Any other ID reads again the entries pending for the consumer
+// after it, without waiting.
+func (c *Cache) XReadGroup(ctx context.Context, group string, consumer string, keys []string, ids []string, count int, block time.Duration, noAck bool) (map[string][]StreamEntry, error) {
+	if len(keys) == 0 || len(keys) != len(ids) {
+		return nil, errors.New("every stream needs an ID")
+	}
+	if consumer == "" {
+		return nil, errors.New("missing consumer name")
+	}
+	from := make([]*StreamID, len(keys))
+	for i := range keys {
+		if ids[i] == ">" {
+			continue
+		}
+		id, err := ParseStreamID(ids[i])
+		if err != nil {
+			return nil, err
+		}
+		from[i] = &id
+		block = 0
+	}
+
+	return c.readStreams(ctx, keys, block, func(s *shard, i int) ([]StreamEntry, error) {
+		node, err := s.lookupTyped(keys[i], TypeStream)
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			return nil, ErrNoGroup
+		}
+		stream := node.Data.(*streamValue)
+		g, exists := stream.groups[group]
+		if !exists {
+			return nil, ErrNoGroup
+		}
+
+		var delivered []streamEntry
+		var deliveries []int64
+		if from[i] == nil {
+			for _, entry := range stream.entries[stream.after(g.lastDelivered):] {
+				if count > 0 && len(delivered) == count {
+					break
+				}
+				delivered = append(delivered, entry)
+				deliveries = append(deliveries, 1)
+			}
+			if noAck {
+				deliveries = make([]int64, len(delivered))
+			}
+		} else {
+			for _, id := range g.pendingOf(consumer, *from[i]) {
+				if count > 0 && len(delivered) == count {
+					break
+				}
+				entry, exists := stream.find(id)
+				if !exists {
+					entry = streamEntry{id: id}
+				}
+				delivered = append(delivered, entry)
+				deliveries = append(deliveries, g.pending[id].deliveries+1)
+			}
+		}
+		if len(delivered) == 0 {
+			return nil, nil
+		}
+
+		now := time.Now()
+		record := []string{string(aofXDeliver), keys[i], group, consumer, strconv.FormatInt(now.UnixMilli(), 10)}
+		entries := make([]StreamEntry, len(delivered))
+		for j, entry := range delivered {
+			g.deliver(entry.id, consumer, now, deliveries[j])
+			record = append(record, entry.id.String(), strconv.FormatInt(deliveries[j], 10))
+			entries[j] = entry.export()
+			if entry.fields == nil {
+				entries[j].Fields = nil
+			}
+		}
+		s.cache.writeNodeRecord(node, record...)
+		return entries, nil
+	})
+}
+
+// pendingOf returns the IDs pending for consumer after id, in order.
+func (g *consumerGroup) pendingOf(consumer string, after StreamID) []StreamID {
+	var ids []StreamID
+	for id, entry := range g.pending {
+		if entry.consumer == consumer && after.less(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+	return ids
+}
+
+// deliver records that an entry was delivered to consumer, for the given
+// number of times in all; 0 leaves it out of the pending entries.
+func (g *consumerGroup) deliver(id StreamID, consumer string, at time.Time, deliveries int64) {
+	if g.lastDelivered.less(id) {
+		g.lastDelivered = id
+	}
+	if deliveries == 0 {
+		return
+	}
+	g.pending[id] = &pendingEntry{consumer: consumer, deliveredAt: at, deliveries: deliveries}
+}
+
+// XAck acknowledges entries pending in group and returns how many were pending.
+func (c *Cache) XAck(key string, group string, ids ...string) (int, error) {
+	parsed := make([]StreamID, len(ids))
+	for i, id := range ids {
+		var err error
+		if parsed[i], err = ParseStreamID(id); err != nil {
+			return 0, err
+		}
+	}
+
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.xack(key, group, parsed)
+}
+
+// xack acknowledges entries pending in a group. The caller must hold s.mutex.
+func (s *shard) xack(key string, group string, ids []StreamID) (int, error) {
+	node, err := s.lookupTyped(key, TypeStream)
+	if err != nil || node == nil {
+		return 0, err
+	}
+	g, exists := node.Data.(*streamValue).groups[group]
+	if !exists {
+		return 0, nil
+	}
+
+	record := []string{string(CMDXAck), key, group}
+	for _, id := range ids {
+		if _, pending := g.pending[id]; pending {
+			delete(g.pending, id)
+			record = append(record, id.String())
+		}
+	}
+	acked := len(record) - 3
+	if acked > 0 {
+		s.cache.writeNodeRecord(node, record...)
+	}
+	return acked, nil
+}
+
+// XPending returns the entries pending in group, of consumer only when it is
+// not empty, ordered by ID.
+func (c *Cache) XPending(key string, group string, consumer string) ([]PendingEntry, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	node, err := s.lookupTyped(key, TypeStream)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, ErrNoGroup
+	}
+	g, exists := node.Data.(*streamValue).groups[group]
+	if !exists {
+		return nil, ErrNoGroup
+	}
+
+	ids := make([]StreamID, 0, len(g.pending))
+	for id, entry := range g.pending {
+		if consumer == "" || entry.consumer == consumer {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+
+	now := time.Now()
+	pending := make([]PendingEntry, len(ids))
+	for i, id := range ids {
+		entry := g.pending[id]
+		pending[i] = PendingEntry{
+			ID:         id.String(),
+			Consumer:   entry.consumer,
+			Idle:       now.Sub(entry.deliveredAt),
+			Deliveries: entry.deliveries,
+		}
+	}
+	return pending, nil
+}
+
+// readStreams calls read for every key under the lock of its shard, i being
+// the position of the key, and returns the entries read from the keys that
+// had some. When none had any, it waits up to block for an entry to be added
+// to one of the keys and reads again; a negative block waits until ctx is
+// done.
+func (c *Cache) readStreams(ctx context.Context, keys []string, block time.Duration, read func(s *shard, i int) ([]StreamEntry, error)) (map[string][]StreamEntry, error) {
+	var deadline <-chan time.Time
+	if block > 0 {
+		timer := time.NewTimer(block)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		var wake chan struct{}
+		if block != 0 {
+			wake = make(chan struct{}, 1)
+		}
+
+		results := make(map[string][]StreamEntry)
+		for i, key := range keys {
+			s := c.shardFor(key)
+			s.mutex.Lock()
+			entries, err := read(s, i)
+			if err == nil && len(entries) == 0 && wake != nil {
+				s.waiters[key] = append(s.waiters[key], wake)
+			}
+			s.mutex.Unlock()
+
+			if err != nil {
+				c.stopWaiting(keys, wake)
+				return nil, err
+			}
+			if len(entries) > 0 {
+				results[key] = entries
+			}
+		}
+		if len(results) > 0 || wake == nil {
+			c.stopWaiting(keys, wake)
+			return results, nil
+		}
+
+		select {
+		case <-wake:
+			c.stopWaiting(keys, wake)
+		case <-deadline:
+			c.stopWaiting(keys, wake)
+			return results, nil
+		case <-ctx.Done():
+			c.stopWaiting(keys, wake)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// stopWaiting unregisters a blocked read from the keys it waits on.
+func (c *Cache) stopWaiting(keys []string, wake chan struct{}) {
+	if wake == nil {
+		return
+	}
+	for _, key := range keys {
+		s := c.shardFor(key)
+		s.mutex.Lock()
+		waiters := s.waiters[key]
+		for i, waiter := range waiters {
+			if waiter == wake {
+				waiters = append(waiters[:i:i], waiters[i+1:]...)
+				break
+			}
+		}
+		if len(waiters) == 0 {
+			delete(s.waiters, key)
+		} else {
+			s.waiters[key] = waiters
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// wakeReaders wakes the reads blocked on key. The caller must hold s.mutex.
+func (s *shard) wakeReaders(key string) {
+	for _, wake := range s.waiters[key] {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	delete(s.waiters, key)
+}
+
+// applyStreamCommand replays the records of streams other than XADD and
+// XTRIM. Groups missing locally, evicted along with their stream, are skipped.
+// The caller must hold s.mutex.
+func (s *shard) applyStreamCommand(command Command, args []string) error {
+	switch {
+	case command == aofXGroupCreate && len(args) == 3:
+		start, err := ParseStreamID(args[2])
+		if err != nil {
+			return fmt.Errorf("invalid XGROUPCREATE record: %v", err)
+		}
+		return s.xgroupCreate(args[0], args[1], start)
+
+	case command == aofXSetID && len(args) == 2:
+		id, err := ParseStreamID(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid XSETID record: %v", err)
+		}
+		node, err := s.lookupOrCreate(args[0], TypeStream)
+		if err != nil {
+			return err
+		}
+		node.Data.(*streamValue).lastID = id
+		s.cache.writeNodeRecord(node, string(aofXSetID), args[0], args[1])
+		s.resize(node, 0)
+		return nil
+
+	case command == aofXDeliver && len(args) >= 6 && len(args)%2 == 0:
+		at, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid time in XDELIVER record: %v", err)
+		}
+		node, err := s.lookupTyped(args[0], TypeStream)
+		if err != nil || node == nil {
+			return err
+		}
+		g, exists := node.Data.(*streamValue).groups[args[1]]
+		if !exists {
+			return nil
+		}
+		for i := 4; i < len(args); i += 2 {
+			id, err := ParseStreamID(args[i])
+			if err != nil {
+				return fmt.Errorf("invalid XDELIVER record: %v", err)
+			}
+			deliveries, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid delivery count in XDELIVER record: %v", err)
+			}
+			g.deliver(id, args[2], time.UnixMilli(at), deliveries)
+		}
+		s.cache.writeNodeRecord(node, append([]string{string(aofXDeliver)}, args...)...)
+		return nil
+
+	case command == CMDXAck && len(args) >= 3:
+		ids := make([]StreamID, len(args)-2)
+		for i, id := range args[2:] {
+			var err error
+			if ids[i], err = ParseStreamID(id); err != nil {
+				return fmt.Errorf("invalid XACK record: %v", err)
+			}
+		}
+		_, err := s.xack(args[0], args[1], ids)
+		return err
+	}
+	return fmt.Errorf("invalid record: %s", formatRecord(append([]string{string(command)}, args...)...))
+}
+
+// applyXAdd replays an XADD record. The caller must hold s.mutex.
+func (s *shard) applyXAdd(args []string) error {
+	maxLen := 0
+	if len(args) >= 3 && strings.EqualFold(args[1], "MAXLEN") {
+		var err error
+		if maxLen, err = strconv.Atoi(args[2]); err != nil {
+			return fmt.Errorf("invalid MAXLEN in XADD record: %v", err)
+		}
+		args = append([]string{args[0]}, args[3:]...)
+	}
+	if len(args) < 4 || len(args)%2 != 0 {
+		return fmt.Errorf("invalid XADD record: %s", formatRecord(args...))
+	}
+	_, err := s.xadd(args[0], args[1], args[2:], maxLen)
+	return err
+}
+
+// dump returns the arguments of the records that recreate a stream and its groups.
+func (v *streamValue) dump(key string) [][]string {
+	records := make([][]string, 0, len(v.entries)+len(v.groups)+1)
+	for _, entry := range v.entries {
+		records = append(records, append([]string{string(CMDXAdd), key, entry.id.String()}, entry.fields...))
+	}
+	records = append(records, []string{string(aofXSetID), key, v.lastID.String()})
+
+	names := make([]string, 0, len(v.groups))
+	for name := range v.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		g := v.groups[name]
+		records = append(records, []string{string(aofXGroupCreate), key, name, g.lastDelivered.String()})
+		for id, entry := range g.pending {
+			records = append(records, []string{
+				string(aofXDeliver), key, name, entry.consumer, strconv.FormatInt(entry.deliveredAt.UnixMilli(), 10),
+				id.String(), strconv.FormatInt(entry.deliveries, 10),
+			})
+		}
+	}
+	return records
+}
@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestXAddMaxLenKeepsNewestEntries(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	const maxLen = 10
+	for i := 1; i <= 1000; i++ {
+		if _, err := c.XAdd("events", strconv.Itoa(i), map[string][]byte{"n": []byte(strconv.Itoa(i))}, maxLen); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := c.XRange("events", "-", "+", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != maxLen {
+		t.Fatalf("got %d entries, want %d", len(entries), maxLen)
+	}
+	for i, entry := range entries {
+		if want := strconv.Itoa(991 + i); string(entry.Fields["n"]) != want {
+			t.Fatalf("entry %d = %s, want n=%s", i, entry.Fields["n"], want)
+		}
+	}
+
+	// The trimmed head is compacted away rather than kept behind the entries
+	s := c.shardFor("events")
+	s.mutex.Lock()
+	stream := s.items["events"].Data.(*streamValue)
+	capacity := cap(stream.entries) + stream.trimmed
+	s.mutex.Unlock()
+	if capacity > 4*maxLen {
+		t.Fatalf("stream of %d entries holds an array of %d", maxLen, capacity)
+	}
+}
+
+// waiterCount returns how many blocked reads wait on key.
+func waiterCount(c *Cache, key string) int {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.waiters[key])
+}
+
+func TestXReadBlocksUntilXAdd(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+	if _, err := c.XAdd("events", "1-0", map[string][]byte{"n": []byte("old")}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		entries map[string][]StreamEntry
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		entries, err := c.XRead(context.Background(), []string{"events"}, []string{"$"}, 0, 5*time.Second)
+		done <- result{entries, err}
+	}()
+	waitFor(t, "the read to block", func() bool { return waiterCount(c, "events") == 1 })
+
+	if _, err := c.XAdd("events", "2-0", map[string][]byte{"n": []byte("new")}, 0); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-done:
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		entries := r.entries["events"]
+		if len(entries) != 1 || entries[0].ID != "2-0" || string(entries[0].Fields["n"]) != "new" {
+			t.Fatalf("XRead = %+v, want only the entry added while it waited", r.entries)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("XAdd did not wake the blocked XRead")
+	}
+	if n := waiterCount(c, "events"); n != 0 {
+		t.Fatalf("%d reads still wait on the stream", n)
+	}
+}
+
+func TestXReadBlockEnds(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	// A read without entries returns empty once its block runs out
+	start := time.Now()
+	entries, err := c.XRead(context.Background(), []string{"events"}, []string{"0-0"}, 0, 50*time.Millisecond)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("XRead = %v, %v, want nothing", entries, err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("XRead returned after %v, before its block ran out", elapsed)
+	}
+
+	// A negative block waits until the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.XRead(ctx, []string{"events"}, []string{"$"}, 0, -1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("XRead = %v, want the context error", err)
+	}
+	if n := waiterCount(c, "events"); n != 0 {
+		t.Fatalf("%d reads still wait on the stream", n)
+	}
+}
+
+func TestXReadGroupBlocksAndTracksPending(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+	if err := c.XGroupCreate("jobs", "workers", "$", true); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan map[string][]StreamEntry, 1)
+	go func() {
+		entries, err := c.XReadGroup(context.Background(), "workers", "alice", []string{"jobs"}, []string{">"}, 0, 5*time.Second, false)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- entries
+	}()
+	waitFor(t, "the read to block", func() bool { return waiterCount(c, "jobs") == 1 })
+
+	id, err := c.XAdd("jobs", "*", map[string][]byte{"task": []byte("build")}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case entries := <-done:
+		if len(entries["jobs"]) != 1 || entries["jobs"][0].ID != id {
+			t.Fatalf("XReadGroup = %+v, want the job added while it waited", entries)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("XAdd did not wake the blocked XReadGroup")
+	}
+
+	// The delivered entry stays pending for alice until acknowledged
+	pending, err := c.XPending("jobs", "workers", "")
+	if err != nil || len(pending) != 1 || pending[0].Consumer != "alice" || pending[0].Deliveries != 1 {
+		t.Fatalf("XPending = %+v, %v, want the job pending for alice", pending, err)
+	}
+	if acked, err := c.XAck("jobs", "workers", id); err != nil || acked != 1 {
+		t.Fatalf("XAck = %d, %v, want 1", acked, err)
+	}
+	if pending, err := c.XPending("jobs", "workers", ""); err != nil || len(pending) != 0 {
+		t.Fatalf("XPending after XAck = %+v, %v, want nothing", pending, err)
+	}
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Strings can be set with tags naming what they were built from, such as the
+// products a page shows. InvalidateTag deletes every key carrying a tag at
+// once and writes a single INVALIDATETAG record, which replaying nodes apply
+// the same way against their own tag index. Tags travel with the SET and SETZ
+// records of their keys.
+
+// recordTags separates the deadline of a SET or SETZ record from its tags.
+const recordTags = "TAGS"
+
+// ErrInvalidTag is returned for empty tags.
+var ErrInvalidTag = errors.New("invalid tag: tags cannot be empty")
+
+// SetTagged stores a value under key like SetVersioned and tags the key with
+// tags, replacing the tags it had. Set alone removes them.
+func (c *Cache) SetTagged(key string, value []byte, duration time.Duration, tags ...string) (uint64, error) {
+	for _, tag := range tags {
+		if tag == "" {
+			return 0, ErrInvalidTag
+		}
+	}
+	return c.set(key, value, duration, nil, tags)
+}
+
+// Tags returns the tags of key, sorted.
+func (c *Cache) Tags(key string) ([]string, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	node, exists := s.lookup(key)
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return append([]string(nil), node.tags...), nil
+}
+
+// InvalidateTag deletes every key tagged with tag, atomically, and returns how
+// many were deleted. Subscribers see a del event for each key. Nothing is
+// written to the AOF when no key was deleted.
+func (c *Cache) InvalidateTag(tag string) int {
+	c.lockAll()
+	defer c.unlockAll()
+
+	now := time.Now()
+	deleted := 0
+	for _, s := range c.shards {
+		for key := range s.tags[tag] {
+			node := s.items[key]
+			if node.expired(now) {
+				s.expireNode(node)
+				continue
+			}
+			s.removeNode(node)
+			c.notify(EventDel, string(CMDInvalidateTag), key)
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		c.writeToAOF(string(CMDInvalidateTag), tag)
+	}
+	return deleted
+}
+
+// setTags replaces the tags of a node and updates the tag index. The caller
+// must hold s.mutex.
+func (s *shard) setTags(node *Node, tags []string) {
+	for _, tag := range node.tags {
+		keys := s.tags[tag]
+		delete(keys, node.Key)
+		if len(keys) == 0 {
+			delete(s.tags, tag)
+		}
+	}
+
+	node.tags = nil
+	if len(tags) == 0 {
+		return
+	}
+	// Sorted without duplicates, in a slice of its own since the node keeps it
+	unique := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		if _, seen := unique[tag]; seen {
+			continue
+		}
+		unique[tag] = struct{}{}
+		node.tags = append(node.tags, tag)
+
+		if s.tags[tag] == nil {
+			s.tags[tag] = make(map[string]struct{})
+		}
+		s.tags[tag][node.Key] = struct{}{}
+	}
+	sort.Strings(node.tags)
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// tagIndexSize returns how many tags the shards of c index.
+func tagIndexSize(c *Cache) int {
+	size := 0
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		size += len(s.tags)
+		s.mutex.Unlock()
+	}
+	return size
+}
+
+func TestInvalidateTag(t *testing.T) {
+	master := NewCacheWithOptions(Options{Shards: 4})
+	defer master.Close()
+	records := recordWrites(master)
+
+	for i := 0; i < 10; i++ {
+		if _, err := master.SetTagged("page:"+strconv.Itoa(i), []byte("html"), 0, "product:1", "layout"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := master.SetTagged("page:other", []byte("html"), 0, "product:2"); err != nil {
+		t.Fatal(err)
+	}
+	if tags, err := master.Tags("page:0"); err != nil || !reflect.DeepEqual(tags, []string{"layout", "product:1"}) {
+		t.Fatalf("Tags = %q, %v, want layout and product:1", tags, err)
+	}
+
+	if deleted := master.InvalidateTag("product:1"); deleted != 10 {
+		t.Fatalf("InvalidateTag = %d, want 10", deleted)
+	}
+	if keys := sortedKeys(master); !reflect.DeepEqual(keys, []string{"page:other"}) {
+		t.Fatalf("keys = %q, want page:other", keys)
+	}
+	written := records()
+	if last := written[len(written)-1]; last != string(CMDInvalidateTag)+" product:1" {
+		t.Fatalf("last record = %q, want a single INVALIDATETAG", last)
+	}
+
+	// A tag no key carries anymore leaves the AOF alone
+	if deleted := master.InvalidateTag("product:1"); deleted != 0 {
+		t.Fatalf("InvalidateTag of an unused tag = %d, want 0", deleted)
+	}
+	if after := records(); len(after) != len(written) {
+		t.Fatalf("InvalidateTag of an unused tag wrote %q", after[len(written):])
+	}
+
+	slave := NewCacheWithOptions(Options{Shards: 2})
+	defer slave.Close()
+	for _, record := range written {
+		if err := slave.ApplyRecord(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if keys := sortedKeys(slave); !reflect.DeepEqual(keys, []string{"page:other"}) {
+		t.Fatalf("slave keys = %q, want page:other", keys)
+	}
+	if size := tagIndexSize(slave); size != 1 {
+		t.Fatalf("slave indexes %d tags, want only product:2", size)
+	}
+}
+
+func TestTagIndexCleanup(t *testing.T) {
+	c := NewCacheWithOptions(Options{MaxEntries: 2, Shards: 1})
+	defer c.Close()
+
+	if _, err := c.SetTagged("expiring", []byte("v"), 20*time.Millisecond, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetTagged("evicted", []byte("v"), 0, "b"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the key to expire", func() bool { return !c.Has("expiring") })
+
+	if _, err := c.SetTagged("kept", []byte("v"), 0, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetTagged("newest", []byte("v"), 0, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Has("evicted") {
+		t.Fatal("the oldest key was not evicted")
+	}
+	if size := tagIndexSize(c); size != 1 {
+		t.Fatalf("index holds %d tags after expiry and eviction, want 1", size)
+	}
+
+	// Set without tags drops the ones the key had
+	if err := c.Set("kept", []byte("v2"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if tags, err := c.Tags("kept"); err != nil || len(tags) != 0 {
+		t.Fatalf("Tags after Set = %q, %v, want none", tags, err)
+	}
+	if deleted := c.InvalidateTag("c"); deleted != 1 {
+		t.Fatalf("InvalidateTag = %d, want only the key still tagged", deleted)
+	}
+
+	if _, err := c.SetTagged("key", []byte("v"), 0, ""); !errors.Is(err, ErrInvalidTag) {
+		t.Fatalf("SetTagged with an empty tag = %v, want ErrInvalidTag", err)
+	}
+}
@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"container/list"
+)
+
+const (
+	tinyLFUDefaultCapacity = 1024 // Sketch sizing used when the cache is unbounded
+	tinyLFUSketchDepth     = 4
+	tinyLFUMaxCount        = 15 // Frequency at which the counters of the sketch saturate
+)
+
+// Segments of the W-TinyLFU layout.
+const (
+	segmentWindow = iota
+	segmentProbation
+	segmentProtected
+)
+
+// tinyLFUPolicy implements W-TinyLFU: new entries enter a small LRU window,
+// and when the window overflows its oldest entry only displaces the main
+// cache's victim if a Count-Min sketch estimates it to be accessed more often.
+// The main cache is a segmented LRU split into probation and protected parts.
+type tinyLFUPolicy struct {
+	capacity   int
+	window     *list.List
+	probation  *list.List
+	protected  *list.List
+	entries    map[*Node]tinyLFURef
+	sketch     *countMinValue
+	sampleSize uint64 // Accesses counted by the sketch before it is halved
+}
+
+type tinyLFURef struct {
+	elem    *list.Element
+	segment int
+}
+
+func newTinyLFUPolicy(capacity int) *tinyLFUPolicy {
+	p := &tinyLFUPolicy{capacity: capacity}
+	p.Reset()
+	return p
+}
+
+func (p *tinyLFUPolicy) Name() string { return PolicyTinyLFU }
+
+// limits returns the sizes of the window and the protected segment, which are
+// 1% and 80% of the main cache. Unbounded caches size them from their content.
+func (p *tinyLFUPolicy) limits() (window int, protected int) {
+	capacity := p.capacity
+	if capacity == 0 {
+		capacity = len(p.entries)
+	}
+	window = max(capacity/100, 1)
+	protected = (capacity - window) * 8 / 10
+	return window, protected
+}
+
+func (p *tinyLFUPolicy) Add(node *Node) {
+	p.recordAccess(node.Key)
+	p.entries[node] = tinyLFURef{elem: p.window.PushFront(node), segment: segmentWindow}
+
+	// While the main cache has room the window overflows into it unchallenged
+	windowLimit, _ := p.limits()
+	mainLimit := p.capacity - windowLimit
+	for p.window.Len() > windowLimit && (p.capacity == 0 || p.probation.Len()+p.protected.Len() < mainLimit) {
+		moved := p.window.Remove(p.window.Back()).(*Node)
+		p.entries[moved] = tinyLFURef{elem: p.probation.PushFront(moved), segment: segmentProbation}
+	}
+}
+
+func (p *tinyLFUPolicy) Access(node *Node) {
+	ref, ok := p.entries[node]
+	if !ok {
+		return
+	}
+	p.recordAccess(node.Key)
+
+	switch ref.segment {
+	case segmentWindow:
+		p.window.MoveToFront(ref.elem)
+	case segmentProbation:
+		// A second hit promotes the entry, demoting the oldest protected entry if needed
+		p.probation.Remove(ref.elem)
+		p.entries[node] = tinyLFURef{elem: p.protected.PushFront(node), segment: segmentProtected}
+		if _, protectedLimit := p.limits(); p.protected.Len() > protectedLimit {
+			demoted := p.protected.Remove(p.protected.Back()).(*Node)
+			p.entries[demoted] = tinyLFURef{elem: p.probation.PushFront(demoted), segment: segmentProbation}
+		}
+	case segmentProtected:
+		p.protected.MoveToFront(ref.elem)
+	}
+}
+
+func (p *tinyLFUPolicy) Remove(node *Node) {
+	ref, ok := p.entries[node]
+	if !ok {
+		return
+	}
+	p.segment(ref.segment).Remove(ref.elem)
+	delete(p.entries, node)
+}
+
+func (p *tinyLFUPolicy) Victim() *Node {
+	windowLimit, _ := p.limits()
+	mainVictim := p.probation.Back()
+	if mainVictim == nil {
+		mainVictim = p.protected.Back()
+	}
+
+	if p.window.Len() >= windowLimit && p.window.Len() > 0 && mainVictim != nil {
+		// Admission: the window's candidate competes with the main cache's victim
+		candidate := p.window.Back()
+		candidateNode := candidate.Value.(*Node)
+		victimNode := mainVictim.Value.(*Node)
+		if p.sketch.query(candidateNode.Key) > p.sketch.query(victimNode.Key) {
+			p.Remove(victimNode)
+			p.window.Remove(candidate)
+			p.entries[candidateNode] = tinyLFURef{elem: p.probation.PushFront(candidateNode), segment: segmentProbation}
+			return victimNode
+		}
+		p.Remove(candidateNode)
+		return candidateNode
+	}
+
+	var victim *list.Element
+	switch {
+	case mainVictim != nil:
+		victim = mainVictim
+	case p.window.Len() > 0:
+		victim = p.window.Back()
+	default:
+		return nil
+	}
+	node := victim.Value.(*Node)
+	p.Remove(node)
+	return node
+}
+
+func (p *tinyLFUPolicy) segment(segment int) *list.List {
+	switch segment {
+	case segmentProbation:
+		return p.probation
+	case segmentProtected:
+		return p.protected
+	default:
+		return p.window
+	}
+}
+
+func (p *tinyLFUPolicy) Keys() []string {
+	keys := make([]string, 0, len(p.entries))
+	for _, l := range []*list.List{p.protected, p.window, p.probation} {
+		for e := l.Front(); e != nil; e = e.Next() {
+			keys = append(keys, e.Value.(*Node).Key)
+		}
+	}
+	return keys
+}
+
+func (p *tinyLFUPolicy) Reset() {
+	capacity := p.capacity
+	if capacity == 0 {
+		capacity = tinyLFUDefaultCapacity
+	}
+	width := 1
+	for width < capacity {
+		width <<= 1
+	}
+	p.window, p.probation, p.protected = list.New(), list.New(), list.New()
+	p.entries = make(map[*Node]tinyLFURef)
+	p.sketch, _ = newCountMinValue(width, tinyLFUSketchDepth, 0)
+	p.sampleSize = 10 * uint64(width)
+}
+
+// recordAccess counts an access to key in the sketch, whose counters
+// saturate at tinyLFUMaxCount and are halved periodically so old popularity
+// fades.
+func (p *tinyLFUPolicy) recordAccess(key string) {
+	p.sketch.incrByUpTo(key, 1, tinyLFUMaxCount)
+	if p.sketch.count >= p.sampleSize {
+		p.sketch.halve()
+	}
+}
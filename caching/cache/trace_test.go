@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"bufio"
+	"flag"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Bigger recorded traces are compared with
+//
+//	go test -run '^$' -bench EvictionPolicies ./caching/cache -tracefile=<path> -tracecapacity=<entries>
+var (
+	traceFile     = flag.String("tracefile", "", "recorded access trace to compare the eviction policies on")
+	traceCapacity = flag.Int("tracecapacity", 1000, "capacity in entries used with -tracefile")
+)
+
+// recordedTrace is a small access log of a product catalogue kept with the
+// tests: Zipf-like product reads whose popular keys drift over time, some
+// session reads, and a report job scanning keys never read again.
+const recordedTrace = "testdata/access.trace"
+
+// loadTrace reads a recorded access trace with one access per line. A line is
+// either a bare key or an AOF/CLI style command such as "GET <key>", in which
+// case the second field is used as the key.
+func loadTrace(t testing.TB, traceFilePath string) []string {
+	traceFile, err := os.Open(traceFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer traceFile.Close()
+
+	var trace []string
+	scanner := bufio.NewScanner(traceFile)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch {
+		case len(fields) == 0:
+			continue
+		case len(fields) == 1:
+			trace = append(trace, fields[0])
+		default:
+			trace = append(trace, fields[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return trace
+}
+
+// zipfTrace returns a deterministic trace of accesses drawn from a Zipf
+// distribution over keys, interleaved every scanEvery accesses with a scan of
+// scanLength keys that are never read again.
+func zipfTrace(length, keys, scanEvery, scanLength int) []string {
+	random := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(random, 1.1, 1, uint64(keys-1))
+
+	trace := make([]string, 0, length)
+	scanned := 0
+	for len(trace) < length {
+		if scanEvery > 0 && len(trace) > 0 && len(trace)%scanEvery == 0 {
+			for i := 0; i < scanLength && len(trace) < length; i++ {
+				trace = append(trace, "scan:"+strconv.Itoa(scanned))
+				scanned++
+			}
+		}
+		trace = append(trace, "key:"+strconv.FormatUint(zipf.Uint64(), 10))
+	}
+	return trace
+}
+
+// simulateHitRatio replays a trace against the named eviction policy with
+// room for capacity entries and returns the fraction of accesses that were hits.
+func simulateHitRatio(t testing.TB, policyName string, capacity int, trace []string) float64 {
+	policy, err := NewEvictionPolicy(policyName, capacity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resident := make(map[string]*Node)
+	hits := 0
+	for _, key := range trace {
+		if node, exists := resident[key]; exists {
+			hits++
+			policy.Access(node)
+			continue
+		}
+
+		node := &Node{Key: key}
+		resident[key] = node
+		policy.Add(node)
+		for len(resident) > capacity {
+			victim := policy.Victim()
+			if victim == nil {
+				break
+			}
+			delete(resident, victim.Key)
+		}
+	}
+
+	return float64(hits) / float64(len(trace))
+}
+
+// BenchmarkEvictionPolicies compares the hit ratios of the eviction policies
+// on the recorded trace, the trace given with -tracefile if any, and a
+// generated Zipf trace, reported as the hit-ratio metric.
+func BenchmarkEvictionPolicies(b *testing.B) {
+	type benchTrace struct {
+		name     string
+		capacity int
+		trace    []string
+	}
+	traces := []benchTrace{
+		{"recorded", 100, loadTrace(b, recordedTrace)},
+		{"zipf", 1000, zipfTrace(200000, 50000, 5000, 2000)},
+	}
+	if *traceFile != "" {
+		traces = append(traces, benchTrace{"tracefile", *traceCapacity, loadTrace(b, *traceFile)})
+	}
+
+	for _, trace := range traces {
+		for _, policy := range EvictionPolicies() {
+			b.Run(trace.name+"/"+policy, func(b *testing.B) {
+				var ratio float64
+				for i := 0; i < b.N; i++ {
+					ratio = simulateHitRatio(b, policy, trace.capacity, trace.trace)
+				}
+				b.ReportMetric(ratio*100, "hit-%")
+			})
+		}
+	}
+}
+
+func TestLoadTrace(t *testing.T) {
+	trace := loadTrace(t, recordedTrace)
+	if len(trace) == 0 {
+		t.Fatal("the recorded trace is empty")
+	}
+	for _, key := range trace {
+		if strings.Contains(key, " ") || key == "GET" || key == "SET" {
+			t.Fatalf("trace holds %q, want keys only", key)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "mixed.trace")
+	if err := os.WriteFile(path, []byte("GET a\nb\n\nSET c 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(loadTrace(t, path), ","); got != "a,b,c" {
+		t.Fatalf("loadTrace = %s, want a,b,c", got)
+	}
+}
+
+func TestTinyLFUResistsScans(t *testing.T) {
+	trace := zipfTrace(100000, 20000, 5000, 2000)
+	lru := simulateHitRatio(t, PolicyLRU, 1000, trace)
+	tinyLFU := simulateHitRatio(t, PolicyTinyLFU, 1000, trace)
+	if tinyLFU <= lru {
+		t.Fatalf("W-TinyLFU hit ratio %.4f, want above LRU's %.4f", tinyLFU, lru)
+	}
+}
@@ -0,0 +1,350 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A transaction runs its queued commands while every shard is locked, so no
+// other client sees the cache between two of them. The records of its writes
+// are written to the AOF and replication stream as a single EXEC record
+//
+//	EXEC <count> <record> ...
+//
+// holding each record as one argument. A record cut short by a crash fails to
+// parse or holds fewer records than its count, and is not applied at all.
+
+var (
+	// ErrTxAborted is returned by Exec when a watched key changed since it was watched.
+	ErrTxAborted = errors.New("transaction aborted: a watched key changed")
+
+	// ErrTxDone is returned when a transaction is used after Exec or Discard.
+	ErrTxDone = errors.New("transaction already executed or discarded")
+)
+
+// TxResult is the outcome of one command of a transaction. A command that
+// fails does not stop the ones queued after it.
+type TxResult struct {
+	Value interface{}
+	Err   error
+}
+
+// Transaction queues commands to run atomically with Exec. It is not safe for
+// concurrent use.
+type Transaction struct {
+	cache    *Cache
+	watched  map[string]uint64
+	commands []txCommand
+	done     bool
+}
+
+// txCommand is a queued command. It runs while the shard of its key is locked.
+type txCommand struct {
+	key string
+	run func(s *shard) (interface{}, error)
+}
+
+// Multi starts a transaction.
+func (c *Cache) Multi() *Transaction {
+	return &Transaction{cache: c, watched: make(map[string]uint64)}
+}
+
+// Watch starts a transaction that Exec aborts if any of keys is written,
+// deleted, expires or is evicted before it runs.
+func (c *Cache) Watch(keys ...string) *Transaction {
+	t := c.Multi()
+	for key, version := range c.Versions(keys...) {
+		t.watched[key] = version
+	}
+	return t
+}
+
+// Versions returns the current version of each key, zero for missing keys.
+// Remote clients hand them back to WatchVersion to watch keys across requests.
+func (c *Cache) Versions(keys ...string) map[string]uint64 {
+	versions := make(map[string]uint64, len(keys))
+	for _, key := range keys {
+		s := c.shardFor(key)
+		s.mutex.Lock()
+		versions[key] = s.versionOf(key)
+		s.mutex.Unlock()
+	}
+	return versions
+}
+
+// versionOf returns the version of the key, zero when it does not exist. The
+// caller must hold s.mutex.
+func (s *shard) versionOf(key string) uint64 {
+	if node, exists := s.lookup(key); exists {
+		return node.version
+	}
+	return 0
+}
+
+// WatchVersion makes Exec abort unless key is still at version, as returned by
+// Versions or carried by an ETag. Zero means the key must not exist.
+func (t *Transaction) WatchVersion(key string, version uint64) {
+	t.watched[key] = version
+}
+
+// Exec runs the queued commands atomically and returns their results in
+// order. It runs nothing and fails with ErrTxAborted when a watched key changed.
+func (t *Transaction) Exec() ([]TxResult, error) {
+	if t.done {
+		return nil, ErrTxDone
+	}
+	t.done = true
+
+	var results []TxResult
+	aborted := false
+	t.cache.atomically(func() {
+		for key, version := range t.watched {
+			if t.cache.shardFor(key).versionOf(key) != version {
+				aborted = true
+				return
+			}
+		}
+
+		results = make([]TxResult, len(t.commands))
+		for i, command := range t.commands {
+			value, err := command.run(t.cache.shardFor(command.key))
+			results[i] = TxResult{Value: value, Err: err}
+		}
+	})
+	if aborted {
+		return nil, ErrTxAborted
+	}
+	return results, nil
+}
+
+// Discard drops the queued commands and ends the transaction.
+func (t *Transaction) Discard() {
+	t.commands = nil
+	t.done = true
+}
+
+// atomically runs fn while every shard is locked and writes the records of its
+// writes as a single EXEC record, so they are replayed and replicated all or
+// nothing.
+func (c *Cache) atomically(fn func()) {
+	c.lockAll()
+	defer c.unlockAll()
+
+	var records []string
+	c.transaction = &records
+	fn()
+	c.transaction = nil
+
+	if len(records) > 0 {
+		c.writeToAOF(append([]string{string(CMDExec), strconv.Itoa(len(records))}, records...)...)
+	}
+}
+
+// applyTransaction replays the records of an EXEC record atomically. A record
+// with fewer records than its count was cut short and is rejected as a whole.
+func (c *Cache) applyTransaction(args []string) error {
+	if len(args) == 0 {
+		return errors.New("invalid EXEC record: missing count")
+	}
+	count, err := strconv.Atoi(args[0])
+	if err != nil || count != len(args)-1 {
+		return fmt.Errorf("incomplete EXEC record: expected %s records, found %d", args[0], len(args)-1)
+	}
+
+	records := make([][]string, count)
+	for i, record := range args[1:] {
+		if records[i], err = parseRecord(record); err != nil {
+			return err
+		}
+	}
+
+	var failed error
+	c.atomically(func() {
+		for _, record := range records {
+			version, args, err := splitVersionTag(record)
+			if err == nil && len(args) < 2 {
+				err = fmt.Errorf("invalid record in EXEC: %s", formatRecord(record...))
+			}
+			if err == nil {
+				err = c.shardFor(args[1]).applyRecord(version, args)
+			}
+			if err != nil && failed == nil {
+				failed = err
+			}
+		}
+	})
+	return failed
+}
+
+func (t *Transaction) queue(key string, run func(s *shard) (interface{}, error)) {
+	t.commands = append(t.commands, txCommand{key: key, run: run})
+}
+
+// Get queues reading the string stored under key. Its result is a []byte.
+func (t *Transaction) Get(key string) {
+	t.queue(key, func(s *shard) (interface{}, error) { return s.get(key) })
+}
+
+// Set queues storing a value under key, like Cache.Set.
+func (t *Transaction) Set(key string, value []byte, duration time.Duration) {
+	t.queue(key, func(s *shard) (interface{}, error) {
+		_, err := s.set(key, value, duration, nil, nil)
+		return nil, err
+	})
+}
+
+// Delete queues deleting key.
+func (t *Transaction) Delete(key string) {
+	t.queue(key, func(s *shard) (interface{}, error) {
+		return nil, s.remove(key, EventDel, string(CMDDel), string(CMDDel), key)
+	})
+}
+
+// IncrBy queues adding delta to the integer stored under key. Its result is an int64.
+func (t *Transaction) IncrBy(key string, delta int64) {
+	t.queue(key, func(s *shard) (interface{}, error) { return s.incrBy(key, delta) })
+}
+
+// IncrByFloat queues adding delta to the number stored under key. Its result is a float64.
+func (t *Transaction) IncrByFloat(key string, delta float64) {
+	t.queue(key, func(s *shard) (interface{}, error) { return s.incrByFloat(key, delta) })
+}
+
+// Expire queues making the key expire after duration, counted from Exec.
+func (t *Transaction) Expire(key string, duration time.Duration) {
+	t.queue(key, func(s *shard) (interface{}, error) {
+		return nil, s.expireAt(key, time.Now().Add(duration))
+	})
+}
+
+// Persist queues removing the expiry of the key. Its result is a bool.
+func (t *Transaction) Persist(key string) {
+	t.queue(key, func(s *shard) (interface{}, error) { return s.persist(key) })
+}
+
+// HSet queues setting fields of a hash. Its result is the number of fields added.
+func (t *Transaction) HSet(key string, fields map[string][]byte) {
+	t.queue(key, func(s *shard) (interface{}, error) { return s.hset(key, fields) })
+}
+
+// LPush queues inserting values at the head of a list. Its result is the length of the list.
+func (t *Transaction) LPush(key string, values ...[]byte) {
+	t.queue(key, func(s *shard) (interface{}, error) { return s.lpush(key, values...) })
+}
+
+// RPop queues removing the last element of a list. Its result is a []byte.
+func (t *Transaction) RPop(key string) {
+	t.queue(key, func(s *shard) (interface{}, error) { return s.rpop(key) })
+}
+
+// SAdd queues adding members to a set. Its result is the number of new members.
+func (t *Transaction) SAdd(key string, members ...string) {
+	t.queue(key, func(s *shard) (interface{}, error) { return s.sadd(key, members...) })
+}
+
+// ZAdd queues adding members to a sorted set. Its result is the number of new members.
+func (t *Transaction) ZAdd(key string, members map[string]float64) {
+	t.queue(key, func(s *shard) (interface{}, error) { return s.zadd(key, members) })
+}
+
+// Queue queues a command given as its name and arguments, the way the CLI
+// takes it: GET, SET <key> <value> [<ttl-seconds>], DEL, INCR, DECR, INCRBY,
+// INCRBYFLOAT, EXPIRE <key> <seconds>, PERSIST, HSET, LPUSH, RPOP, SADD and
+// ZADD. Malformed commands are rejected without being queued.
+func (t *Transaction) Queue(args ...string) error {
+	if t.done {
+		return ErrTxDone
+	}
+	if len(args) < 2 {
+		return errors.New("missing command or key")
+	}
+
+	command, key, args := Command(strings.ToUpper(args[0])), args[1], args[2:]
+	switch {
+	case command == CMDGet && len(args) == 0:
+		t.Get(key)
+
+	case command == CMDSet && (len(args) == 1 || len(args) == 2):
+		var duration time.Duration
+		if len(args) == 2 {
+			seconds, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid TTL %q", args[1])
+			}
+			duration = time.Duration(seconds) * time.Second
+		}
+		t.Set(key, []byte(args[0]), duration)
+
+	case command == CMDDel && len(args) == 0:
+		t.Delete(key)
+
+	case (command == CMDIncr || command == CMDDecr) && len(args) == 0:
+		delta := int64(1)
+		if command == CMDDecr {
+			delta = -1
+		}
+		t.IncrBy(key, delta)
+
+	case command == CMDIncrBy && len(args) == 1:
+		delta, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return ErrNotInteger
+		}
+		t.IncrBy(key, delta)
+
+	case command == CMDIncrByFloat && len(args) == 1:
+		delta, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			return ErrNotFloat
+		}
+		t.IncrByFloat(key, delta)
+
+	case command == CMDExpire && len(args) == 1:
+		seconds, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid TTL %q", args[0])
+		}
+		t.Expire(key, time.Duration(seconds)*time.Second)
+
+	case command == CMDPersist && len(args) == 0:
+		t.Persist(key)
+
+	case command == CMDHSet && len(args) >= 2 && len(args)%2 == 0:
+		fields := make(map[string][]byte, len(args)/2)
+		for i := 0; i < len(args); i += 2 {
+			fields[args[i]] = []byte(args[i+1])
+		}
+		t.HSet(key, fields)
+
+	case command == CMDLPush && len(args) >= 1:
+		values := make([][]byte, len(args))
+		for i, value := range args {
+			values[i] = []byte(value)
+		}
+		t.LPush(key, values...)
+
+	case command == CMDRPop && len(args) == 0:
+		t.RPop(key)
+
+	case command == CMDSAdd && len(args) >= 1:
+		t.SAdd(key, args...)
+
+	case command == CMDZAdd && len(args) >= 2 && len(args)%2 == 0:
+		members := make(map[string]float64, len(args)/2)
+		for i := 0; i < len(args); i += 2 {
+			score, err := strconv.ParseFloat(args[i], 64)
+			if err != nil {
+				return fmt.Errorf("invalid score %q", args[i])
+			}
+			members[args[i+1]] = score
+		}
+		t.ZAdd(key, members)
+
+	default:
+		return fmt.Errorf("command %s with %d arguments cannot be queued", command, len(args)+1)
+	}
+	return nil
+}
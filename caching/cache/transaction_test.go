@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTransactionExec(t *testing.T) {
+	c := NewCacheWithOptions(Options{Shards: 4})
+	defer c.Close()
+	records := recordWrites(c)
+
+	if err := c.Set("name", []byte("ada"), 0); err != nil {
+		t.Fatal(err)
+	}
+	tx := c.Multi()
+	tx.Get("name")
+	tx.IncrBy("counter", 5)
+	tx.IncrBy("name", 1)
+	if err := tx.Queue("SADD", "tags", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Queue("SET", "key"); err == nil {
+		t.Fatal("Queue accepted SET without a value")
+	}
+	results, err := tx.Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("Exec returned %d results, want 4", len(results))
+	}
+	if value, ok := results[0].Value.([]byte); !ok || string(value) != "ada" {
+		t.Fatalf("result of GET = %v, want ada", results[0].Value)
+	}
+	if results[1].Value != int64(5) {
+		t.Fatalf("result of INCRBY = %v, want 5", results[1].Value)
+	}
+	// A failing command does not stop the ones after it
+	if !errors.Is(results[2].Err, ErrNotInteger) || results[3].Err != nil || results[3].Value != 2 {
+		t.Fatalf("results = %+v, want INCRBY to fail and SADD to add 2", results[2:])
+	}
+
+	// The writes of the transaction are recorded as one EXEC record
+	written := records()
+	if len(written) != 2 || !strings.HasPrefix(written[1], string(CMDExec)+" 2 ") {
+		t.Fatalf("records = %q, want the SET and one EXEC of 2 records", written)
+	}
+	slave := NewCache()
+	defer slave.Close()
+	for _, record := range written {
+		if err := slave.ApplyRecord(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if value, err := slave.Get("counter"); err != nil || string(value) != "5" {
+		t.Fatalf("slave counter = %q, %v, want 5", value, err)
+	}
+
+	if _, err := tx.Exec(); !errors.Is(err, ErrTxDone) {
+		t.Fatalf("second Exec = %v, want ErrTxDone", err)
+	}
+}
+
+func TestWatchAbortsExec(t *testing.T) {
+	changes := map[string]func(c *Cache) error{
+		"set":    func(c *Cache) error { return c.Set("balance", []byte("0"), 0) },
+		"delete": func(c *Cache) error { return c.Delete("balance") },
+		"incr":   func(c *Cache) error { _, err := c.Incr("balance"); return err },
+		"expire": func(c *Cache) error { return c.Expire("balance", time.Hour) },
+		"create": func(c *Cache) error { return c.Set("missing", []byte("v"), 0) },
+	}
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			c := NewCache()
+			defer c.Close()
+			if err := c.Set("balance", []byte("100"), 0); err != nil {
+				t.Fatal(err)
+			}
+			records := recordWrites(c)
+
+			tx := c.Watch("balance", "missing")
+			tx.IncrBy("balance", -30)
+			tx.Set("audit", []byte("withdrawn"), 0)
+			if err := change(c); err != nil {
+				t.Fatal(err)
+			}
+			written := len(records())
+
+			if _, err := tx.Exec(); !errors.Is(err, ErrTxAborted) {
+				t.Fatalf("Exec after a watched key changed = %v, want ErrTxAborted", err)
+			}
+			if c.Has("audit") {
+				t.Fatal("aborted transaction ran a command")
+			}
+			if len(records()) != written {
+				t.Fatalf("aborted transaction wrote records %q", records()[written:])
+			}
+		})
+	}
+}
+
+func TestWatchAbortsOnExpiry(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+	if err := c.Set("session", []byte("v"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	tx := c.Watch("session")
+	tx.Set("session", []byte("renewed"), 0)
+	waitFor(t, "the session to expire", func() bool { return !c.Has("session") })
+
+	if _, err := tx.Exec(); !errors.Is(err, ErrTxAborted) {
+		t.Fatalf("Exec after a watched key expired = %v, want ErrTxAborted", err)
+	}
+}
+
+func TestWatchRetriesSerializeIncrements(t *testing.T) {
+	c := NewCacheWithOptions(Options{Shards: 4})
+	defer c.Close()
+	if err := c.Set("counter", []byte("0"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read-modify-write loops retried on abort never lose an increment
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				for {
+					tx := c.Watch("counter")
+					value, err := c.Get("counter")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					current, _ := strconv.Atoi(string(value))
+					tx.Set("counter", []byte(strconv.Itoa(current+1)), 0)
+					if _, err := tx.Exec(); err == nil {
+						break
+					} else if !errors.Is(err, ErrTxAborted) {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if value, err := c.Get("counter"); err != nil || string(value) != "160" {
+		t.Fatalf("counter = %q, %v, want 160", value, err)
+	}
+}
+
+func TestIncompleteExecRecordIsRejected(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	record := formatRecord(string(CMDExec), "2", formatRecord("SET", "a", "1"))
+	if err := c.ApplyRecord(record); err == nil {
+		t.Fatal("ApplyRecord accepted an EXEC record cut short")
+	}
+	if c.Has("a") {
+		t.Fatal("records of an incomplete EXEC were applied")
+	}
+}
@@ -0,0 +1,310 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Key is the constraint of the keys of a Typed cache. Keys are stored as their
+// string or decimal form.
+type Key interface {
+	~string | ~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+// Serializer turns values of type V into the bytes stored in the cache and back.
+type Serializer[V any] interface {
+	Marshal(value V) ([]byte, error)
+	Unmarshal(data []byte) (V, error)
+}
+
+// JSONSerializer stores values as JSON.
+type JSONSerializer[V any] struct{}
+
+func (JSONSerializer[V]) Marshal(value V) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (JSONSerializer[V]) Unmarshal(data []byte) (V, error) {
+	var value V
+	err := json.Unmarshal(data, &value)
+	return value, err
+}
+
+// GobSerializer stores values with encoding/gob, which keeps Go types JSON
+// cannot represent but is only readable from Go.
+type GobSerializer[V any] struct{}
+
+func (GobSerializer[V]) Marshal(value V) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobSerializer[V]) Unmarshal(data []byte) (V, error) {
+	var value V
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	return value, err
+}
+
+// RawSerializer stores byte slices as they are.
+type RawSerializer struct{}
+
+func (RawSerializer) Marshal(value []byte) ([]byte, error) {
+	return value, nil
+}
+
+func (RawSerializer) Unmarshal(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// SerializationError is returned by a Typed cache when its serializer fails
+// on the value of a key. Op is "marshal" or "unmarshal".
+type SerializationError struct {
+	Key string
+	Op  string
+	Err error
+}
+
+func (e *SerializationError) Error() string {
+	return fmt.Sprintf("%s value of key %s: %v", e.Op, e.Key, e.Err)
+}
+
+func (e *SerializationError) Unwrap() error {
+	return e.Err
+}
+
+// Typed stores values of type V under keys of type K in a Cacher, which can be
+// a Cache of this process or a RemoteCache of a cluster. Misses are reported
+// as ErrNotFound. Keys are stored behind the prefix given to NewTyped, so
+// several Typed caches can share a backend.
+type Typed[K Key, V any] struct {
+	backend    Cacher
+	batch      batcher
+	serializer Serializer[V]
+	prefix     string
+}
+
+// NewTyped returns a Typed cache over backend, storing values with serializer
+// under prefix followed by the key.
+func NewTyped[K Key, V any](backend Cacher, serializer Serializer[V], prefix string) *Typed[K, V] {
+	batch, ok := backend.(batcher)
+	if !ok {
+		batch = keyByKey{backend}
+	}
+	return &Typed[K, V]{backend: backend, batch: batch, serializer: serializer, prefix: prefix}
+}
+
+// Get returns the value stored under key.
+func (t *Typed[K, V]) Get(key K) (V, error) {
+	var value V
+	name := t.name(key)
+	data, err := t.backend.Get(name)
+	if err != nil {
+		return value, err
+	}
+	return t.unmarshal(name, data)
+}
+
+// Set stores value under key, expiring after duration when it is positive.
+func (t *Typed[K, V]) Set(key K, value V, duration time.Duration) error {
+	name := t.name(key)
+	data, err := t.marshal(name, value)
+	if err != nil {
+		return err
+	}
+	return t.backend.Set(name, data, duration)
+}
+
+// CompareAndSwap stores value under key only if the key is still at
+// expectedVersion, like Cache.CompareAndSwap, and returns the new version.
+func (t *Typed[K, V]) CompareAndSwap(key K, expectedVersion uint64, value V, duration time.Duration) (uint64, error) {
+	name := t.name(key)
+	data, err := t.marshal(name, value)
+	if err != nil {
+		return 0, err
+	}
+	return t.backend.CompareAndSwap(name, expectedVersion, data, duration)
+}
+
+// Has reports whether key exists.
+func (t *Typed[K, V]) Has(key K) bool {
+	return t.backend.Has(t.name(key))
+}
+
+// Delete deletes key.
+func (t *Typed[K, V]) Delete(key K) error {
+	return t.backend.Delete(t.name(key))
+}
+
+// GetMany returns the values stored under keys, read in one operation when the
+// backend supports it. Missing keys are left out. Values that fail to
+// unmarshal are left out too and reported as *SerializationError, joined.
+func (t *Typed[K, V]) GetMany(keys ...K) (map[K]V, error) {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = t.name(key)
+	}
+	found, err := t.batch.getMany(names)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[K]V, len(found))
+	var errs []error
+	for i, key := range keys {
+		data, exists := found[names[i]]
+		if !exists {
+			continue
+		}
+		value, err := t.unmarshal(names[i], data)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		values[key] = value
+	}
+	return values, errors.Join(errs...)
+}
+
+// SetMany stores every value under its key with the same duration, in one
+// operation when the backend supports it. Nothing is stored when a value fails
+// to marshal. Keys that could not be stored are reported joined, each error
+// naming its key.
+func (t *Typed[K, V]) SetMany(values map[K]V, duration time.Duration) error {
+	encoded := make(map[string][]byte, len(values))
+	for key, value := range values {
+		name := t.name(key)
+		data, err := t.marshal(name, value)
+		if err != nil {
+			return err
+		}
+		encoded[name] = data
+	}
+
+	failed, err := t.batch.setMany(encoded, duration)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for name, err := range failed {
+		errs = append(errs, fmt.Errorf("setting key %s: %w", name, err))
+	}
+	return errors.Join(errs...)
+}
+
+// DeleteMany deletes keys, in one operation when the backend supports it, and
+// reports for each key whether it existed.
+func (t *Typed[K, V]) DeleteMany(keys ...K) (map[K]bool, error) {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = t.name(key)
+	}
+	deleted, err := t.batch.deleteMany(names)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[K]bool, len(keys))
+	for i, key := range keys {
+		results[key] = deleted[names[i]]
+	}
+	return results, nil
+}
+
+// name returns the key of the backend that key is stored under.
+func (t *Typed[K, V]) name(key K) string {
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.String:
+		return t.prefix + v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return t.prefix + strconv.FormatInt(v.Int(), 10)
+	default:
+		return t.prefix + strconv.FormatUint(v.Uint(), 10)
+	}
+}
+
+func (t *Typed[K, V]) marshal(name string, value V) ([]byte, error) {
+	data, err := t.serializer.Marshal(value)
+	if err != nil {
+		return nil, &SerializationError{Key: name, Op: "marshal", Err: err}
+	}
+	return data, nil
+}
+
+func (t *Typed[K, V]) unmarshal(name string, data []byte) (V, error) {
+	value, err := t.serializer.Unmarshal(data)
+	if err != nil {
+		return value, &SerializationError{Key: name, Op: "unmarshal", Err: err}
+	}
+	return value, nil
+}
+
+// batcher is implemented by the backends that read and write many keys in a
+// single operation.
+type batcher interface {
+	getMany(keys []string) (map[string][]byte, error)
+	setMany(values map[string][]byte, duration time.Duration) (map[string]error, error)
+	deleteMany(keys []string) (map[string]bool, error)
+}
+
+func (c *Cache) getMany(keys []string) (map[string][]byte, error) {
+	return c.MGet(keys...), nil
+}
+
+func (c *Cache) setMany(values map[string][]byte, duration time.Duration) (map[string]error, error) {
+	return c.MSet(values, duration), nil
+}
+
+func (c *Cache) deleteMany(keys []string) (map[string]bool, error) {
+	return c.MDel(keys...), nil
+}
+
+// keyByKey runs batch operations one key at a time on backends without batch support.
+type keyByKey struct {
+	backend Cacher
+}
+
+func (b keyByKey) getMany(keys []string) (map[string][]byte, error) {
+	values := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		value, err := b.backend.Get(key)
+		switch {
+		case err == nil:
+			values[key] = value
+		case !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrWrongType):
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (b keyByKey) setMany(values map[string][]byte, duration time.Duration) (map[string]error, error) {
+	failed := make(map[string]error)
+	for key, value := range values {
+		if err := b.backend.Set(key, value, duration); err != nil {
+			failed[key] = err
+		}
+	}
+	return failed, nil
+}
+
+func (b keyByKey) deleteMany(keys []string) (map[string]bool, error) {
+	deleted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		err := b.backend.Delete(key)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		deleted[key] = err == nil
+	}
+	return deleted, nil
+}
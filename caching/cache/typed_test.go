@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type product struct {
+	Name  string
+	Price float64
+	Tags  []string
+}
+
+// unbatched hides the batch operations of a Cache, like backends without them.
+type unbatched struct {
+	Cacher
+}
+
+func TestTypedSerializers(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	want := product{Name: "lamp", Price: 19.5, Tags: []string{"home"}}
+	jsonProducts := NewTyped[int, product](c, JSONSerializer[product]{}, "product:")
+	if err := jsonProducts.Set(42, want, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := c.Get("product:42"); err != nil || string(stored) != `{"Name":"lamp","Price":19.5,"Tags":["home"]}` {
+		t.Fatalf("stored value = %s, %v, want JSON under the prefixed key", stored, err)
+	}
+	if got, err := jsonProducts.Get(42); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("Get = %+v, %v, want %+v", got, err, want)
+	}
+
+	gobProducts := NewTyped[string, product](c, GobSerializer[product]{}, "gob:")
+	if err := gobProducts.Set("lamp", want, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := gobProducts.Get("lamp"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("Get = %+v, %v, want %+v", got, err, want)
+	}
+
+	raw := NewTyped[uint8, []byte](c, RawSerializer{}, "raw:")
+	if err := raw.Set(7, []byte("bytes"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := c.Get("raw:7"); err != nil || string(stored) != "bytes" {
+		t.Fatalf("stored value = %q, %v, want the bytes as they are", stored, err)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+	products := NewTyped[string, product](c, JSONSerializer[product]{}, "product:")
+
+	if _, err := products.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a missing key = %v, want ErrNotFound", err)
+	}
+
+	if err := c.Set("product:broken", []byte("not json"), 0); err != nil {
+		t.Fatal(err)
+	}
+	_, err := products.Get("broken")
+	var serialization *SerializationError
+	if !errors.As(err, &serialization) || serialization.Op != "unmarshal" || serialization.Key != "product:broken" {
+		t.Fatalf("Get of an invalid value = %v, want an unmarshal *SerializationError", err)
+	}
+
+	channels := NewTyped[string, chan int](c, JSONSerializer[chan int]{}, "")
+	if err := channels.Set("c", make(chan int), 0); !errors.As(err, &serialization) || serialization.Op != "marshal" {
+		t.Fatalf("Set of an unserializable value = %v, want a marshal *SerializationError", err)
+	}
+	if c.Has("c") {
+		t.Fatal("a value that failed to marshal was stored")
+	}
+}
+
+func TestTypedBatches(t *testing.T) {
+	for name, backend := range map[string]func(c *Cache) Cacher{
+		"batched":    func(c *Cache) Cacher { return c },
+		"key by key": func(c *Cache) Cacher { return unbatched{c} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewCache()
+			defer c.Close()
+			scores := NewTyped[string, int](backend(c), JSONSerializer[int]{}, "score:")
+
+			if err := scores.SetMany(map[string]int{"ada": 3, "bob": 5}, 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Set("score:eve", []byte("garbage"), 0); err != nil {
+				t.Fatal(err)
+			}
+
+			values, err := scores.GetMany("ada", "bob", "eve", "zoe")
+			var serialization *SerializationError
+			if !errors.As(err, &serialization) || serialization.Key != "score:eve" {
+				t.Fatalf("GetMany error = %v, want the invalid value of eve reported", err)
+			}
+			if !reflect.DeepEqual(values, map[string]int{"ada": 3, "bob": 5}) {
+				t.Fatalf("GetMany = %v, want ada and bob", values)
+			}
+
+			deleted, err := scores.DeleteMany("ada", "zoe")
+			if err != nil || !reflect.DeepEqual(deleted, map[string]bool{"ada": true, "zoe": false}) {
+				t.Fatalf("DeleteMany = %v, %v, want ada deleted", deleted, err)
+			}
+		})
+	}
+}
+
+func TestTypedSetManyReportsFailedKeys(t *testing.T) {
+	c := NewCacheWithOptions(Options{Shards: 1, MaxMemory: 1})
+	defer c.Close()
+	scores := NewTyped[string, int](c, JSONSerializer[int]{}, "")
+
+	if err := scores.SetMany(map[string]int{"ada": 3}, 0); !errors.Is(err, ErrFull) {
+		t.Fatalf("SetMany on a full cache = %v, want ErrFull", err)
+	}
+}
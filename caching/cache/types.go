@@ -0,0 +1,533 @@
+package cache
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+)
+
+// Names of the value types a key can hold, as reported by Type.
+const (
+	TypeNone   = "none"
+	TypeString = "string"
+	TypeHash   = "hash"
+	TypeList   = "list"
+	TypeSet    = "set"
+	TypeZSet   = "zset"
+	TypeStream = "stream"
+
+	TypeBloom       = "bloom"
+	TypeHyperLogLog = "hyperloglog"
+	TypeCountMin    = "cms"
+)
+
+// ErrWrongType is returned when a command is used against a key holding another type.
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// ErrFieldNotFound is returned for hash fields that do not exist.
+var ErrFieldNotFound = errors.New("field not found")
+
+type hashValue map[string][]byte
+
+type listValue [][]byte
+
+type setValue map[string]struct{}
+
+type zsetValue map[string]float64
+
+// ScoredMember is a member of a sorted set together with its score.
+type ScoredMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// typeOf returns the type name of a node's data.
+func typeOf(data interface{}) string {
+	switch data.(type) {
+	case []byte:
+		return TypeString
+	case hashValue:
+		return TypeHash
+	case *listValue:
+		return TypeList
+	case setValue:
+		return TypeSet
+	case zsetValue:
+		return TypeZSet
+	case *streamValue:
+		return TypeStream
+	case *bloomValue:
+		return TypeBloom
+	case *hllValue:
+		return TypeHyperLogLog
+	case *countMinValue:
+		return TypeCountMin
+	default:
+		return TypeNone
+	}
+}
+
+// valueSize returns the number of bytes held by a node's data.
+func valueSize(data interface{}) int64 {
+	var size int64
+	switch v := data.(type) {
+	case []byte:
+		size = int64(len(v))
+	case hashValue:
+		for field, value := range v {
+			size += int64(len(field) + len(value))
+		}
+	case *listValue:
+		for _, item := range *v {
+			size += int64(len(item))
+		}
+	case setValue:
+		for member := range v {
+			size += int64(len(member))
+		}
+	case zsetValue:
+		for member := range v {
+			size += int64(len(member)) + 8
+		}
+	case *streamValue:
+		for _, entry := range v.entries {
+			size += entry.size()
+		}
+	case *bloomValue:
+		size = v.size()
+	case *hllValue:
+		size = hllRegisters
+	case *countMinValue:
+		size = int64(len(v.counters)) * 4
+	}
+	return size
+}
+
+// newValue returns an empty container of the given type.
+func newValue(kind string) interface{} {
+	switch kind {
+	case TypeHash:
+		return hashValue{}
+	case TypeList:
+		return &listValue{}
+	case TypeSet:
+		return setValue{}
+	case TypeZSet:
+		return zsetValue{}
+	case TypeStream:
+		return newStreamValue()
+	case TypeBloom:
+		bloom, _ := newBloomValue(DefaultBloomErrorRate, DefaultBloomCapacity, 0)
+		return bloom
+	case TypeHyperLogLog:
+		return &hllValue{}
+	default:
+		return []byte{}
+	}
+}
+
+// lookupTyped returns the node under key if it holds the given type, or nil when
+// the key does not exist. The caller must hold s.mutex.
+func (s *shard) lookupTyped(key string, kind string) (*Node, error) {
+	node, exists := s.lookup(key)
+	if !exists {
+		s.stats.misses.Add(1)
+		return nil, nil
+	}
+	if typeOf(node.Data) != kind {
+		return nil, ErrWrongType
+	}
+	s.stats.hits.Add(1)
+	s.touch(node)
+	return node, nil
+}
+
+// lookupOrCreate returns the node under key if it holds the given type, creating
+// an empty one when the key does not exist. The caller must hold s.mutex.
+func (s *shard) lookupOrCreate(key string, kind string) (*Node, error) {
+	if err := s.reserveMemory(0); err != nil {
+		return nil, err
+	}
+
+	node, exists := s.lookup(key)
+	if !exists {
+		node = newNode(key, newValue(kind))
+		s.insert(node)
+		return node, nil
+	}
+	if typeOf(node.Data) != kind {
+		return nil, ErrWrongType
+	}
+	s.touch(node)
+	return node, nil
+}
+
+// resize updates the accounted size of a node after its data changed in place,
+// removing the key once its container is empty. The caller must hold s.mutex.
+func (s *shard) resize(node *Node, delta int64) {
+	node.size += delta
+	s.stats.usedBytes.Add(delta)
+	s.refreshMemory(node)
+
+	if isEmptyValue(node.Data) {
+		s.removeNode(node)
+		s.cache.notify(EventDel, "empty", node.Key)
+		return
+	}
+	s.evictOverflow()
+}
+
+func isEmptyValue(data interface{}) bool {
+	switch v := data.(type) {
+	case hashValue:
+		return len(v) == 0
+	case *listValue:
+		return len(*v) == 0
+	case setValue:
+		return len(v) == 0
+	case zsetValue:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
+
+// Type returns the type name of the value stored under key, or TypeNone.
+func (c *Cache) Type(key string) string {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	node, exists := s.lookup(key)
+	if !exists {
+		return TypeNone
+	}
+	return typeOf(node.Data)
+}
+
+// HSet sets fields of the hash stored under key and returns how many fields were added.
+func (c *Cache) HSet(key string, fields map[string][]byte) (int, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.hset(key, fields)
+}
+
+// hset sets fields of the hash stored under key. The caller must hold s.mutex.
+func (s *shard) hset(key string, fields map[string][]byte) (int, error) {
+	node, err := s.lookupOrCreate(key, TypeHash)
+	if err != nil {
+		return 0, err
+	}
+
+	hash := node.Data.(hashValue)
+	record := []string{string(CMDHSet), key}
+	added := 0
+	var delta int64
+	for field, value := range fields {
+		if old, exists := hash[field]; exists {
+			delta -= int64(len(field) + len(old))
+		} else {
+			added++
+		}
+		hash[field] = value
+		delta += int64(len(field) + len(value))
+		record = append(record, field, string(value))
+	}
+
+	s.cache.writeNodeRecord(node, record...)
+	s.resize(node, delta)
+
+	return added, nil
+}
+
+// HGet returns the value of a field of the hash stored under key.
+func (c *Cache) HGet(key string, field string) ([]byte, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	node, err := s.lookupTyped(key, TypeHash)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, ErrNotFound
+	}
+
+	value, exists := node.Data.(hashValue)[field]
+	if !exists {
+		return nil, ErrFieldNotFound
+	}
+	return value, nil
+}
+
+// HGetAll returns every field of the hash stored under key.
+func (c *Cache) HGetAll(key string) (map[string][]byte, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	node, err := s.lookupTyped(key, TypeHash)
+	if err != nil || node == nil {
+		return map[string][]byte{}, err
+	}
+
+	fields := make(map[string][]byte, len(node.Data.(hashValue)))
+	for field, value := range node.Data.(hashValue) {
+		fields[field] = value
+	}
+	return fields, nil
+}
+
+// LPush inserts values at the head of the list stored under key, one after the
+// other, and returns the length of the list.
+func (c *Cache) LPush(key string, values ...[]byte) (int, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.lpush(key, values...)
+}
+
+// lpush inserts values at the head of the list stored under key. The caller must hold s.mutex.
+func (s *shard) lpush(key string, values ...[]byte) (int, error) {
+	node, err := s.lookupOrCreate(key, TypeList)
+	if err != nil {
+		return 0, err
+	}
+
+	list := node.Data.(*listValue)
+	record := []string{string(CMDLPush), key}
+	pushed := make(listValue, 0, len(values)+len(*list))
+	var delta int64
+	for i := len(values) - 1; i >= 0; i-- {
+		pushed = append(pushed, values[i])
+	}
+	for _, value := range values {
+		delta += int64(len(value))
+		record = append(record, string(value))
+	}
+	*list = append(pushed, *list...)
+
+	s.cache.writeNodeRecord(node, record...)
+	length := len(*list)
+	s.resize(node, delta)
+
+	return length, nil
+}
+
+// RPop removes and returns the last element of the list stored under key.
+func (c *Cache) RPop(key string) ([]byte, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.rpop(key)
+}
+
+// rpop removes the last element of the list stored under key. The caller must hold s.mutex.
+func (s *shard) rpop(key string) ([]byte, error) {
+	node, err := s.lookupTyped(key, TypeList)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, ErrNotFound
+	}
+
+	list := node.Data.(*listValue)
+	value := (*list)[len(*list)-1]
+	*list = (*list)[:len(*list)-1]
+
+	s.cache.writeNodeRecord(node, string(CMDRPop), key)
+	s.resize(node, -int64(len(value)))
+
+	return value, nil
+}
+
+// LRange returns the elements of the list stored under key between start and
+// stop, both inclusive. Negative indexes count from the end of the list.
+func (c *Cache) LRange(key string, start int, stop int) ([][]byte, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	node, err := s.lookupTyped(key, TypeList)
+	if err != nil || node == nil {
+		return [][]byte{}, err
+	}
+
+	list := *node.Data.(*listValue)
+	length := len(list)
+	if start < 0 {
+		start = max(length+start, 0)
+	}
+	if stop < 0 {
+		stop = length + stop
+	}
+	stop = min(stop, length-1)
+	if start > stop {
+		return [][]byte{}, nil
+	}
+
+	values := make([][]byte, stop-start+1)
+	copy(values, list[start:stop+1])
+	return values, nil
+}
+
+// SAdd adds members to the set stored under key and returns how many were new.
+func (c *Cache) SAdd(key string, members ...string) (int, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.sadd(key, members...)
+}
+
+// sadd adds members to the set stored under key. The caller must hold s.mutex.
+func (s *shard) sadd(key string, members ...string) (int, error) {
+	node, err := s.lookupOrCreate(key, TypeSet)
+	if err != nil {
+		return 0, err
+	}
+
+	set := node.Data.(setValue)
+	record := []string{string(CMDSAdd), key}
+	added := 0
+	var delta int64
+	for _, member := range members {
+		if _, exists := set[member]; exists {
+			continue
+		}
+		set[member] = struct{}{}
+		added++
+		delta += int64(len(member))
+		record = append(record, member)
+	}
+
+	if added > 0 {
+		s.cache.writeNodeRecord(node, record...)
+	}
+	s.resize(node, delta)
+
+	return added, nil
+}
+
+// SIsMember reports whether member belongs to the set stored under key.
+func (c *Cache) SIsMember(key string, member string) (bool, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	node, err := s.lookupTyped(key, TypeSet)
+	if err != nil || node == nil {
+		return false, err
+	}
+
+	_, exists := node.Data.(setValue)[member]
+	return exists, nil
+}
+
+// SInter returns the members present in every set stored under the given keys.
+// A missing key counts as an empty set.
+func (c *Cache) SInter(keys ...string) ([]string, error) {
+	unlock := c.lockKeys(keys...)
+	defer unlock()
+
+	var result setValue
+	for _, key := range keys {
+		node, err := c.shardFor(key).lookupTyped(key, TypeSet)
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			return []string{}, nil
+		}
+
+		set := node.Data.(setValue)
+		if result == nil {
+			result = make(setValue, len(set))
+			for member := range set {
+				result[member] = struct{}{}
+			}
+			continue
+		}
+		for member := range result {
+			if _, exists := set[member]; !exists {
+				delete(result, member)
+			}
+		}
+	}
+
+	members := make([]string, 0, len(result))
+	for member := range result {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+// ZAdd adds members with their scores to the sorted set stored under key,
+// updating the score of existing members, and returns how many were new.
+func (c *Cache) ZAdd(key string, members map[string]float64) (int, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.zadd(key, members)
+}
+
+// zadd adds members to the sorted set stored under key. The caller must hold s.mutex.
+func (s *shard) zadd(key string, members map[string]float64) (int, error) {
+	node, err := s.lookupOrCreate(key, TypeZSet)
+	if err != nil {
+		return 0, err
+	}
+
+	zset := node.Data.(zsetValue)
+	record := []string{string(CMDZAdd), key}
+	added := 0
+	var delta int64
+	for member, score := range members {
+		if _, exists := zset[member]; !exists {
+			added++
+			delta += int64(len(member)) + 8
+		}
+		zset[member] = score
+		record = append(record, strconv.FormatFloat(score, 'g', -1, 64), member)
+	}
+
+	s.cache.writeNodeRecord(node, record...)
+	s.resize(node, delta)
+
+	return added, nil
+}
+
+// ZRangeByScore returns the members of the sorted set stored under key with a
+// score between minScore and maxScore, both inclusive, ordered by score.
+func (c *Cache) ZRangeByScore(key string, minScore float64, maxScore float64) ([]ScoredMember, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	node, err := s.lookupTyped(key, TypeZSet)
+	if err != nil || node == nil {
+		return []ScoredMember{}, err
+	}
+
+	members := make([]ScoredMember, 0)
+	for member, score := range node.Data.(zsetValue) {
+		if score >= minScore && score <= maxScore {
+			members = append(members, ScoredMember{Member: member, Score: score})
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Score != members[j].Score {
+			return members[i].Score < members[j].Score
+		}
+		return members[i].Member < members[j].Member
+	})
+	return members, nil
+}
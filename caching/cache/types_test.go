@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDataTypes(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	if _, err := c.HSet("user", map[string][]byte{"name": []byte("ada"), "lang": []byte("go")}); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := c.HGet("user", "name"); err != nil || string(value) != "ada" {
+		t.Fatalf("HGet = %q, %v, want ada", value, err)
+	}
+	if _, err := c.HGet("user", "age"); !errors.Is(err, ErrFieldNotFound) {
+		t.Fatalf("HGet of a missing field = %v, want ErrFieldNotFound", err)
+	}
+
+	if length, err := c.LPush("queue", []byte("a"), []byte("b"), []byte("c")); err != nil || length != 3 {
+		t.Fatalf("LPush = %d, %v, want 3", length, err)
+	}
+	if values, err := c.LRange("queue", 0, -1); err != nil || !reflect.DeepEqual(values, [][]byte{[]byte("c"), []byte("b"), []byte("a")}) {
+		t.Fatalf("LRange = %q, %v, want c b a", values, err)
+	}
+	if value, err := c.RPop("queue"); err != nil || string(value) != "a" {
+		t.Fatalf("RPop = %q, %v, want a", value, err)
+	}
+
+	if _, err := c.SAdd("left", "x", "y", "z"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SAdd("right", "y", "z", "w"); err != nil {
+		t.Fatal(err)
+	}
+	if members, err := c.SInter("left", "right"); err != nil || !reflect.DeepEqual(members, []string{"y", "z"}) {
+		t.Fatalf("SInter = %q, %v, want y z", members, err)
+	}
+
+	if _, err := c.ZAdd("scores", map[string]float64{"low": 1, "mid": 5, "high": 9}); err != nil {
+		t.Fatal(err)
+	}
+	members, err := c.ZRangeByScore("scores", 2, 10)
+	if err != nil || !reflect.DeepEqual(members, []ScoredMember{{Member: "mid", Score: 5}, {Member: "high", Score: 9}}) {
+		t.Fatalf("ZRangeByScore = %v, %v, want mid and high", members, err)
+	}
+
+	for key, want := range map[string]string{"user": TypeHash, "queue": TypeList, "left": TypeSet, "scores": TypeZSet, "missing": TypeNone} {
+		if got := c.Type(key); got != want {
+			t.Fatalf("Type(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestDataTypeErrors(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	if err := c.Set("string", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.LPush("string", []byte("x")); !errors.Is(err, ErrWrongType) {
+		t.Fatalf("LPush on a string = %v, want ErrWrongType", err)
+	}
+	if _, err := c.HSet("hash", map[string][]byte{"f": []byte("v")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get("hash"); !errors.Is(err, ErrWrongType) {
+		t.Fatalf("Get on a hash = %v, want ErrWrongType", err)
+	}
+
+	// Popping the last element deletes the list
+	if _, err := c.LPush("list", []byte("only")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.RPop("list"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Has("list") {
+		t.Fatal("empty list still exists")
+	}
+	if _, err := c.RPop("list"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("RPop on a missing list = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDataTypesReplicate(t *testing.T) {
+	master := NewCache()
+	defer master.Close()
+	records := recordWrites(master)
+
+	if _, err := master.HSet("user", map[string][]byte{"name": []byte("ada")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := master.LPush("queue", []byte("a"), []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := master.RPop("queue"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := master.SAdd("set", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := master.ZAdd("scores", map[string]float64{"a": 1.5}); err != nil {
+		t.Fatal(err)
+	}
+
+	slave := NewCache()
+	defer slave.Close()
+	for _, record := range records() {
+		if err := slave.ApplyRecord(record); err != nil {
+			t.Fatalf("ApplyRecord(%q) = %v", record, err)
+		}
+	}
+	if fields, err := slave.HGetAll("user"); err != nil || string(fields["name"]) != "ada" {
+		t.Fatalf("HGetAll = %q, %v", fields, err)
+	}
+	if values, err := slave.LRange("queue", 0, -1); err != nil || !reflect.DeepEqual(values, [][]byte{[]byte("b")}) {
+		t.Fatalf("LRange = %q, %v, want b", values, err)
+	}
+	if member, err := slave.SIsMember("set", "x"); err != nil || !member {
+		t.Fatalf("SIsMember = %v, %v", member, err)
+	}
+	if members, err := slave.ZRangeByScore("scores", 0, 2); err != nil || len(members) != 1 || members[0].Score != 1.5 {
+		t.Fatalf("ZRangeByScore = %v, %v", members, err)
+	}
+}
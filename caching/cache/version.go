@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Every write to a key gives its node a new version, drawn from a counter
+// shared by the whole cache so a key that is deleted and recreated never gets
+// an old version back. Records of writes are tagged with the resulting version
+// as a leading "@<version>" argument, so replaying the AOF and following the
+// master both restore the same versions the master handed out.
+
+// ConflictError is returned by CompareAndSwap when the version of the key no
+// longer matches the expected one. It matches ErrConflict.
+type ConflictError struct {
+	Key      string
+	Expected uint64
+	Actual   uint64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("version conflict on key %s: expected %d, found %d", e.Key, e.Expected, e.Actual)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// nextVersion returns a version never handed out before.
+func (c *Cache) nextVersion() uint64 {
+	return c.version.Add(1)
+}
+
+// observeVersion makes sure versions handed out later are above version.
+func (c *Cache) observeVersion(version uint64) {
+	for {
+		current := c.version.Load()
+		if current >= version || c.version.CompareAndSwap(current, version) {
+			return
+		}
+	}
+}
+
+// writeNodeRecord gives node a new version, writes the record of its change,
+// tagged with that version, and notifies the subscribers. The caller must hold
+// the node's shard lock.
+func (c *Cache) writeNodeRecord(node *Node, args ...string) {
+	node.version = c.nextVersion()
+	c.writeToAOF(append([]string{versionTag(node.version)}, args...)...)
+	c.notify(EventSet, args[0], node.Key)
+}
+
+// versionTag returns the leading argument that tags a record with a version.
+func versionTag(version uint64) string {
+	return "@" + strconv.FormatUint(version, 10)
+}
+
+// splitVersionTag removes the version tag from the arguments of a record. The
+// version is zero for records written without one.
+func splitVersionTag(args []string) (uint64, []string, error) {
+	if len(args) == 0 || !strings.HasPrefix(args[0], "@") {
+		return 0, args, nil
+	}
+	version, err := strconv.ParseUint(args[0][1:], 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid version tag %q: %v", args[0], err)
+	}
+	return version, args[1:], nil
+}
+
+// restoreVersion sets the version of the node stored under key, as recorded
+// by the master.
+func (c *Cache) restoreVersion(key string, version uint64) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.restoreVersion(key, version)
+}
+
+// restoreVersion sets the version of the node stored under key. The caller
+// must hold s.mutex.
+func (s *shard) restoreVersion(key string, version uint64) {
+	s.cache.observeVersion(version)
+
+	if node, exists := s.items[key]; exists {
+		node.version = version
+	}
+}
+
+// GetWithVersion returns the string stored under key together with its
+// version. It counts as a read like Get, for the stats, the eviction policy
+// and the refresh policies.
+func (c *Cache) GetWithVersion(key string) ([]byte, uint64, error) {
+	s := c.shardFor(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.getWithVersion(key)
+}
+
+// SetVersioned stores value under key like Set and returns its new version.
+func (c *Cache) SetVersioned(key string, value []byte, duration time.Duration) (uint64, error) {
+	return c.set(key, value, duration, nil, nil)
+}
+
+// CompareAndSwap stores value under key like Set, but only if the key is still
+// at expectedVersion, and returns the new version. An expectedVersion of zero
+// means the key must not exist. When the version moved, it fails with a
+// *ConflictError and leaves the key untouched.
+func (c *Cache) CompareAndSwap(key string, expectedVersion uint64, value []byte, duration time.Duration) (uint64, error) {
+	return c.set(key, value, duration, &expectedVersion, nil)
+}
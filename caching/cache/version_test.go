@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCompareAndSwap(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	// Version zero means the key must not exist yet
+	version, err := c.CompareAndSwap("config", 0, []byte("v1"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CompareAndSwap("config", 0, []byte("again"), 0); !errors.Is(err, ErrConflict) {
+		t.Fatalf("CompareAndSwap on an existing key with version zero = %v, want ErrConflict", err)
+	}
+
+	next, err := c.CompareAndSwap("config", version, []byte("v2"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next <= version {
+		t.Fatalf("version after swap = %d, want above %d", next, version)
+	}
+
+	// A writer still holding the old version loses
+	_, err = c.CompareAndSwap("config", version, []byte("stale"), 0)
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("CompareAndSwap with a stale version = %v, want *ConflictError", err)
+	}
+	if conflict.Key != "config" || conflict.Expected != version || conflict.Actual != next {
+		t.Fatalf("conflict = %+v, want key config, expected %d, actual %d", conflict, version, next)
+	}
+	if value, current, err := c.GetWithVersion("config"); err != nil || string(value) != "v2" || current != next {
+		t.Fatalf("GetWithVersion = %q, %d, %v, want v2 at %d", value, current, err, next)
+	}
+}
+
+func TestVersionsNeverRepeat(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	first, err := c.SetVersioned("key", []byte("a"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete("key"); err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.SetVersioned("key", []byte("a"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second <= first {
+		t.Fatalf("version of a recreated key = %d, want above %d", second, first)
+	}
+	if _, err := c.CompareAndSwap("key", first, []byte("b"), 0); !errors.Is(err, ErrConflict) {
+		t.Fatalf("CompareAndSwap with the version of the deleted key = %v, want ErrConflict", err)
+	}
+}
+
+func TestSlaveKeepsVersions(t *testing.T) {
+	master := NewCache()
+	defer master.Close()
+	records := recordWrites(master)
+
+	if _, err := master.SetVersioned("key", []byte("a"), 0); err != nil {
+		t.Fatal(err)
+	}
+	version, err := master.SetVersioned("key", []byte("b"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slave := NewCache()
+	defer slave.Close()
+	for _, record := range records() {
+		if err := slave.ApplyRecord(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, got, err := slave.GetWithVersion("key"); err != nil || got != version {
+		t.Fatalf("slave version = %d, %v, want %d", got, err, version)
+	}
+
+	// Versions handed out after a replay stay above the replayed ones
+	if next, err := slave.SetVersioned("other", []byte("c"), 0); err != nil || next <= version {
+		t.Fatalf("version after replay = %d, %v, want above %d", next, err, version)
+	}
+}
+
+func TestGetWithVersionCountsAsRead(t *testing.T) {
+	c := NewCache()
+	defer c.Close()
+
+	loader := LoaderFunc(func(key string) ([]byte, error) { return []byte("fresh"), nil })
+	if err := c.SetRefreshPolicy("hot", RefreshPolicy{Loader: loader, SoftTTL: 20 * time.Millisecond, HardTTL: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("hot", []byte("old"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.GetWithVersion("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetWithVersion of a missing key = %v, want ErrNotFound", err)
+	}
+	if _, _, err := c.GetWithVersion("hot"); err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("hits, misses = %d, %d, want 1, 1", stats.Hits, stats.Misses)
+	}
+
+	// A stale read starts a refresh, as with Get
+	time.Sleep(30 * time.Millisecond)
+	if value, _, err := c.GetWithVersion("hot"); err != nil || string(value) != "old" {
+		t.Fatalf("GetWithVersion of a stale value = %q, %v, want old", value, err)
+	}
+	waitFor(t, "the refreshed value", func() bool {
+		value, _, err := c.GetWithVersion("hot")
+		return err == nil && string(value) == "fresh"
+	})
+}
@@ -1,5 +1,123 @@
 package caching
 
-func replicateToFollowers() {
+import (
+	"bufio"
+	"log"
+	"net"
+	"sort"
+	"sync"
+)
 
+// followerBacklog is how many records may queue up for a slow follower before
+// it is disconnected and has to resynchronize.
+const followerBacklog = 10000
+
+// Replicator streams the master's write records to the connected followers.
+// Every follower first receives a snapshot of the cache and then each record
+// in the order the master applied it.
+type Replicator struct {
+	mutex     sync.Mutex
+	followers map[string]*follower
+}
+
+type follower struct {
+	conn    net.Conn
+	records chan string
+}
+
+// NewReplicator creates a Replicator without followers.
+func NewReplicator() *Replicator {
+	return &Replicator{followers: make(map[string]*follower)}
+}
+
+// AddFollower registers a follower connection. The snapshot is sent ahead of
+// any record broadcast after this call returns.
+func (r *Replicator) AddFollower(id string, conn net.Conn, snapshot []string) {
+	f := &follower{conn: conn, records: make(chan string, followerBacklog)}
+
+	r.mutex.Lock()
+	if previous, exists := r.followers[id]; exists {
+		close(previous.records)
+	}
+	r.followers[id] = f
+	r.mutex.Unlock()
+
+	go f.stream(snapshot)
+}
+
+// RemoveFollower stops streaming to a follower.
+func (r *Replicator) RemoveFollower(id string, conn net.Conn) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if f, exists := r.followers[id]; exists && f.conn == conn {
+		close(f.records)
+		delete(r.followers, id)
+	}
+}
+
+// Followers returns the IDs of the connected followers.
+func (r *Replicator) Followers() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ids := make([]string, 0, len(r.followers))
+	for id := range r.followers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Broadcast queues a record for every follower. A follower whose backlog is
+// full is dropped rather than allowed to block the master.
+func (r *Replicator) Broadcast(record string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for id, f := range r.followers {
+		select {
+		case f.records <- record:
+		default:
+			log.Printf("Replication backlog of follower %s is full, disconnecting it", id)
+			close(f.records)
+			f.conn.Close()
+			delete(r.followers, id)
+		}
+	}
+}
+
+// stream writes the snapshot and then the queued records to the follower until
+// its queue is closed or the connection fails.
+func (f *follower) stream(snapshot []string) {
+	writer := bufio.NewWriter(f.conn)
+	write := func(record string) bool {
+		if _, err := writer.WriteString(record + "\n"); err != nil {
+			log.Println("Error streaming to follower:", err)
+			f.conn.Close()
+			return false
+		}
+		return true
+	}
+
+	for _, record := range snapshot {
+		if !write(record) {
+			return
+		}
+	}
+	if writer.Flush() != nil {
+		f.conn.Close()
+		return
+	}
+
+	for record := range f.records {
+		if !write(record) {
+			return
+		}
+		// Flush once the queue is drained so bursts go out together
+		if len(f.records) == 0 && writer.Flush() != nil {
+			f.conn.Close()
+			return
+		}
+	}
 }
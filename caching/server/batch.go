@@ -0,0 +1,144 @@
+package server
+
+import (
+	"distributed-caching-and-loadbalancing-system/caching/cache"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// handleMGet handles reading many keys at once on the slave node. The keys
+// come either as repeated key query parameters of a GET, or as the keys list
+// of a JSON body POSTed by clients with too many keys for a URL. Keys that are
+// missing or hold another type map to null. With the encoding query parameter
+// set to base64, values are base64 encoded so binary values survive JSON.
+func handleMGet(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("HTTP request received: %s %s", r.Method, r.URL.Path)
+
+		var keys []string
+		switch r.Method {
+		case http.MethodGet:
+			keys = r.URL.Query()["key"]
+		case http.MethodPost:
+			var request struct {
+				Keys []string `json:"keys"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, "Invalid JSON request body", http.StatusBadRequest)
+				return
+			}
+			keys = request.Keys
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if len(keys) == 0 {
+			http.Error(w, "Missing keys", http.StatusBadRequest)
+			return
+		}
+		encoding := r.URL.Query().Get("encoding")
+		if _, err := decodeValue("", encoding); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		found := cacheInstance.MGet(keys...)
+		values := make(map[string]*string, len(keys))
+		for _, key := range keys {
+			if value, exists := found[key]; exists {
+				text := encodeValue(value, encoding)
+				values[key] = &text
+			} else {
+				values[key] = nil
+			}
+		}
+		writeJSON(w, map[string]interface{}{"values": values})
+	}
+}
+
+// handleMSet handles storing many keys at once on the master node, all with
+// the same optional TTL, base64 encoded when encoding is base64. Each key maps
+// to "OK" or the error that kept it from being stored.
+func handleMSet(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Values   map[string]string `json:"values"`
+			Encoding string            `json:"encoding"`
+			TTL      string            `json:"ttl"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if len(request.Values) == 0 {
+			http.Error(w, "Missing values", http.StatusBadRequest)
+			return
+		}
+		var duration time.Duration
+		if request.TTL != "" {
+			var err error
+			if duration, err = time.ParseDuration(request.TTL); err != nil {
+				http.Error(w, "Invalid TTL duration", http.StatusBadRequest)
+				return
+			}
+		}
+
+		values := make(map[string][]byte, len(request.Values))
+		for key, value := range request.Values {
+			decoded, err := decodeValue(value, request.Encoding)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			values[key] = decoded
+		}
+		failed := cacheInstance.MSet(values, duration)
+
+		results := make(map[string]string, len(values))
+		for key := range values {
+			results[key] = "OK"
+			if err, exists := failed[key]; exists {
+				results[key] = err.Error()
+			}
+		}
+		writeJSON(w, map[string]interface{}{"results": results})
+	}
+}
+
+// handleMDel handles deleting many keys at once on the master node. Each key
+// maps to whether it existed.
+func handleMDel(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Keys []string `json:"keys"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if len(request.Keys) == 0 {
+			http.Error(w, "Missing keys", http.StatusBadRequest)
+			return
+		}
+
+		writeJSON(w, map[string]interface{}{"deleted": cacheInstance.MDel(request.Keys...)})
+	}
+}
+
+// handleInvalidateTag deletes every key tagged with the given tag at once.
+func handleInvalidateTag(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Tag string `json:"tag"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Tag == "" {
+			http.Error(w, "Missing tag", http.StatusBadRequest)
+			return
+		}
+
+		writeJSON(w, map[string]interface{}{"deleted": cacheInstance.InvalidateTag(request.Tag)})
+	}
+}
@@ -1,8 +1,14 @@
 package server
 
 import (
+	"distributed-caching-and-loadbalancing-system/caching/cache"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"gopkg.in/yaml.v2"
 	"os"
+	"strings"
 )
 
 type Config struct {
@@ -13,6 +19,18 @@ type Config struct {
 		} `yaml:"master"`
 		Slaves     []string `yaml:"slaves"`
 		AofFileUrl string   `yaml:"aof"`
+		MaxEntries int      `yaml:"max_entries"`
+		MaxBytes   int64    `yaml:"max_bytes"`
+		Eviction   string   `yaml:"eviction_policy"`
+		Shards     int      `yaml:"shards"`
+		MaxMemory  int64    `yaml:"maxmemory"`
+		MemPolicy  string   `yaml:"maxmemory_policy"`
+		Compress   int64    `yaml:"compression_threshold"`
+		KeySource  string   `yaml:"encryption_key"`
+		OldKeys    []string `yaml:"previous_encryption_keys"`
+		Migrate    bool     `yaml:"encrypt_plaintext_aof"`
+		Namespaces int      `yaml:"max_namespaces"`
+		MaxSketch  int64    `yaml:"max_sketch_bytes"`
 	} `yaml:"cache"`
 }
 
@@ -45,3 +63,102 @@ func getAofFileLocation(configFileName string) (string, error) {
 
 	return config.Cache.AofFileUrl, nil
 }
+
+func readCacheOptions(configFileName string) (cache.Options, error) {
+	yamlFile, err := os.ReadFile(configFileName)
+	if err != nil {
+		return cache.Options{}, err
+	}
+
+	var config Config
+	err = yaml.Unmarshal(yamlFile, &config)
+	if err != nil {
+		return cache.Options{}, err
+	}
+
+	return cache.Options{
+		MaxEntries:     config.Cache.MaxEntries,
+		MaxBytes:       config.Cache.MaxBytes,
+		EvictionPolicy: config.Cache.Eviction,
+		Shards:         config.Cache.Shards,
+
+		MaxMemory:       config.Cache.MaxMemory,
+		MaxMemoryPolicy: config.Cache.MemPolicy,
+
+		CompressionThreshold: config.Cache.Compress,
+
+		EncryptPlaintextAOF: config.Cache.Migrate,
+
+		MaxNamespaces:  config.Cache.Namespaces,
+		MaxSketchBytes: config.Cache.MaxSketch,
+	}, nil
+}
+
+// readEncryptionKeyring loads the keys the AOF is sealed with. It returns nil
+// when no key is configured, and fails rather than let the AOF be written in
+// plaintext when a configured key cannot be loaded.
+func readEncryptionKeyring(configFileName string) (*cache.Keyring, error) {
+	yamlFile, err := os.ReadFile(configFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	err = yaml.Unmarshal(yamlFile, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Cache.KeySource == "" {
+		if len(config.Cache.OldKeys) > 0 {
+			return nil, errors.New("previous_encryption_keys is set without encryption_key")
+		}
+		return nil, nil
+	}
+	current, err := loadEncryptionKey(config.Cache.KeySource)
+	if err != nil {
+		return nil, err
+	}
+	previous := make([][]byte, len(config.Cache.OldKeys))
+	for i, source := range config.Cache.OldKeys {
+		if previous[i], err = loadEncryptionKey(source); err != nil {
+			return nil, err
+		}
+	}
+	return cache.NewKeyring(current, previous...)
+}
+
+// loadEncryptionKey reads a key from a "file:<path>" or "env:<variable>"
+// source. The key is 16, 24 or 32 bytes written as hex or base64.
+func loadEncryptionKey(source string) ([]byte, error) {
+	var text string
+	switch {
+	case strings.HasPrefix(source, "file:"):
+		content, err := os.ReadFile(strings.TrimPrefix(source, "file:"))
+		if err != nil {
+			return nil, fmt.Errorf("reading encryption key: %v", err)
+		}
+		text = string(content)
+	case strings.HasPrefix(source, "env:"):
+		name := strings.TrimPrefix(source, "env:")
+		text = os.Getenv(name)
+		if text == "" {
+			return nil, fmt.Errorf("encryption key variable %s is not set", name)
+		}
+	default:
+		return nil, fmt.Errorf("encryption key source %q must start with file: or env:", source)
+	}
+
+	text = strings.TrimSpace(text)
+	key, err := hex.DecodeString(text)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(text)
+	}
+	if err != nil || (len(key) != 16 && len(key) != 24 && len(key) != 32) {
+		return nil, fmt.Errorf("encryption key from %s must be 16, 24 or 32 bytes written as hex or base64", source)
+	}
+	return key, nil
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadEncryptionKey(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	path := filepath.Join(t.TempDir(), "aof.key")
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CACHE_TEST_AOF_KEY", base64.StdEncoding.EncodeToString(key))
+
+	for _, source := range []string{"file:" + path, "env:CACHE_TEST_AOF_KEY"} {
+		loaded, err := loadEncryptionKey(source)
+		if err != nil || string(loaded) != string(key) {
+			t.Fatalf("loadEncryptionKey(%q) = %q, %v, want the key", source, loaded, err)
+		}
+	}
+
+	// Keys that cannot be loaded fail startup instead of leaving the AOF in plaintext
+	t.Setenv("CACHE_TEST_SHORT_KEY", hex.EncodeToString(key[:10]))
+	for _, source := range []string{
+		"file:" + filepath.Join(t.TempDir(), "missing.key"),
+		"env:CACHE_TEST_UNSET_KEY",
+		"env:CACHE_TEST_SHORT_KEY",
+		hex.EncodeToString(key),
+	} {
+		if _, err := loadEncryptionKey(source); err == nil {
+			t.Fatalf("loadEncryptionKey(%q) succeeded", source)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"distributed-caching-and-loadbalancing-system/caching/cache"
+	"errors"
+	"math"
+	"net/http"
+)
+
+// handleIncrBy handles adding to an integer counter on the master node. The
+// amount defaults to one and is multiplied by sign, which is -1 for decr.
+func handleIncrBy(cacheInstance *cache.Cache, sign int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key string `json:"key"`
+			By  *int64 `json:"by"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Key == "" {
+			http.Error(w, "Missing key", http.StatusBadRequest)
+			return
+		}
+
+		delta := int64(1)
+		if request.By != nil {
+			delta = *request.By
+		}
+		if sign < 0 && delta == math.MinInt64 {
+			writeCounterError(w, cache.ErrNotInteger)
+			return
+		}
+		value, err := cacheInstance.IncrBy(request.Key, sign*delta)
+		if err != nil {
+			writeCounterError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]int64{"value": value})
+	}
+}
+
+// handleIncrByFloat handles adding to a floating point counter on the master node.
+func handleIncrByFloat(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key string   `json:"key"`
+			By  *float64 `json:"by"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Key == "" || request.By == nil {
+			http.Error(w, "Missing key or by", http.StatusBadRequest)
+			return
+		}
+
+		value, err := cacheInstance.IncrByFloat(request.Key, *request.By)
+		if err != nil {
+			writeCounterError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]float64{"value": value})
+	}
+}
+
+// writeCounterError reports values that cannot be used as counters as bad requests.
+func writeCounterError(w http.ResponseWriter, err error) {
+	if errors.Is(err, cache.ErrNotInteger) || errors.Is(err, cache.ErrNotFloat) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeCacheError(w, err)
+}
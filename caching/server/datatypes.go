@@ -0,0 +1,377 @@
+package server
+
+import (
+	"distributed-caching-and-loadbalancing-system/caching/cache"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// writeJSON encodes a response body as JSON.
+func writeJSON(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Println("Error encoding response:", err)
+	}
+}
+
+// writeCacheError maps an error returned by the cache to an HTTP status.
+func writeCacheError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, cache.ErrNotFound), errors.Is(err, cache.ErrFieldNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, cache.ErrWrongType):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, cache.ErrFull):
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+	case errors.Is(err, cache.ErrConflict):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// valueEncodingBase64 is the encoding of request and response values that
+// carry binary data, which JSON strings cannot hold.
+const valueEncodingBase64 = "base64"
+
+// decodeValue returns the bytes of a value of a JSON request, written as is or
+// with the given encoding.
+func decodeValue(value string, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(value), nil
+	case valueEncodingBase64:
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, errors.New("invalid base64 value")
+		}
+		return decoded, nil
+	default:
+		return nil, fmt.Errorf("unknown value encoding %q", encoding)
+	}
+}
+
+// encodeValue returns a value for a JSON response, written as is or with the
+// given encoding, which decodeValue has accepted.
+func encodeValue(value []byte, encoding string) string {
+	if encoding == valueEncodingBase64 {
+		return base64.StdEncoding.EncodeToString(value)
+	}
+	return string(value)
+}
+
+// decodeWriteRequest checks that a write request is a POST and decodes its JSON body.
+func decodeWriteRequest(w http.ResponseWriter, r *http.Request, request interface{}) bool {
+	log.Printf("HTTP request received: %s %s", r.Method, r.URL.Path)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		http.Error(w, "Invalid JSON request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// readQuery checks that a read request is a GET and returns its required query parameters.
+func readQuery(w http.ResponseWriter, r *http.Request, names ...string) ([]string, bool) {
+	log.Printf("HTTP request received: %s %s", r.Method, r.URL.Path)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = r.URL.Query().Get(name)
+		if values[i] == "" {
+			http.Error(w, "Missing "+name+" parameter", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// handleHSet handles setting hash fields on the master node.
+func handleHSet(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key    string            `json:"key"`
+			Fields map[string]string `json:"fields"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Key == "" || len(request.Fields) == 0 {
+			http.Error(w, "Missing key or fields", http.StatusBadRequest)
+			return
+		}
+
+		fields := make(map[string][]byte, len(request.Fields))
+		for field, value := range request.Fields {
+			fields[field] = []byte(value)
+		}
+		added, err := cacheInstance.HSet(request.Key, fields)
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]int{"added": added})
+	}
+}
+
+// handleLPush handles pushing values onto a list on the master node.
+func handleLPush(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key    string   `json:"key"`
+			Values []string `json:"values"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Key == "" || len(request.Values) == 0 {
+			http.Error(w, "Missing key or values", http.StatusBadRequest)
+			return
+		}
+
+		values := make([][]byte, len(request.Values))
+		for i, value := range request.Values {
+			values[i] = []byte(value)
+		}
+		length, err := cacheInstance.LPush(request.Key, values...)
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]int{"length": length})
+	}
+}
+
+// handleRPop handles popping the last value of a list on the master node.
+func handleRPop(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key string `json:"key"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+
+		value, err := cacheInstance.RPop(request.Key)
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]string{"value": string(value)})
+	}
+}
+
+// handleSAdd handles adding members to a set on the master node.
+func handleSAdd(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key     string   `json:"key"`
+			Members []string `json:"members"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Key == "" || len(request.Members) == 0 {
+			http.Error(w, "Missing key or members", http.StatusBadRequest)
+			return
+		}
+
+		added, err := cacheInstance.SAdd(request.Key, request.Members...)
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]int{"added": added})
+	}
+}
+
+// handleZAdd handles adding scored members to a sorted set on the master node.
+func handleZAdd(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key     string             `json:"key"`
+			Members map[string]float64 `json:"members"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Key == "" || len(request.Members) == 0 {
+			http.Error(w, "Missing key or members", http.StatusBadRequest)
+			return
+		}
+
+		added, err := cacheInstance.ZAdd(request.Key, request.Members)
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]int{"added": added})
+	}
+}
+
+// handleType handles the type lookup of a key on the slave node.
+func handleType(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, ok := readQuery(w, r, "key")
+		if !ok {
+			return
+		}
+
+		writeJSON(w, map[string]string{"type": cacheInstance.Type(params[0])})
+	}
+}
+
+// handleHGet handles reading a hash field on the slave node.
+func handleHGet(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, ok := readQuery(w, r, "key", "field")
+		if !ok {
+			return
+		}
+
+		value, err := cacheInstance.HGet(params[0], params[1])
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]string{"value": string(value)})
+	}
+}
+
+// handleHGetAll handles reading a whole hash on the slave node.
+func handleHGetAll(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, ok := readQuery(w, r, "key")
+		if !ok {
+			return
+		}
+
+		fields, err := cacheInstance.HGetAll(params[0])
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+
+		response := make(map[string]string, len(fields))
+		for field, value := range fields {
+			response[field] = string(value)
+		}
+		writeJSON(w, response)
+	}
+}
+
+// handleLRange handles reading a range of a list on the slave node.
+func handleLRange(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, ok := readQuery(w, r, "key", "start", "stop")
+		if !ok {
+			return
+		}
+		start, err := strconv.Atoi(params[1])
+		if err != nil {
+			http.Error(w, "Invalid start index", http.StatusBadRequest)
+			return
+		}
+		stop, err := strconv.Atoi(params[2])
+		if err != nil {
+			http.Error(w, "Invalid stop index", http.StatusBadRequest)
+			return
+		}
+
+		values, err := cacheInstance.LRange(params[0], start, stop)
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+
+		response := make([]string, len(values))
+		for i, value := range values {
+			response[i] = string(value)
+		}
+		writeJSON(w, response)
+	}
+}
+
+// handleSIsMember handles the set membership check on the slave node.
+func handleSIsMember(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, ok := readQuery(w, r, "key", "member")
+		if !ok {
+			return
+		}
+
+		isMember, err := cacheInstance.SIsMember(params[0], params[1])
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]bool{"member": isMember})
+	}
+}
+
+// handleSInter handles the intersection of sets on the slave node. Keys are
+// given as a comma separated list.
+func handleSInter(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, ok := readQuery(w, r, "keys")
+		if !ok {
+			return
+		}
+
+		members, err := cacheInstance.SInter(strings.Split(params[0], ",")...)
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+
+		writeJSON(w, members)
+	}
+}
+
+// handleZRangeByScore handles reading a score range of a sorted set on the slave node.
+func handleZRangeByScore(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, ok := readQuery(w, r, "key", "min", "max")
+		if !ok {
+			return
+		}
+		minScore, err := strconv.ParseFloat(params[1], 64)
+		if err != nil {
+			http.Error(w, "Invalid min score", http.StatusBadRequest)
+			return
+		}
+		maxScore, err := strconv.ParseFloat(params[2], 64)
+		if err != nil {
+			http.Error(w, "Invalid max score", http.StatusBadRequest)
+			return
+		}
+
+		members, err := cacheInstance.ZRangeByScore(params[0], minScore, maxScore)
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+
+		writeJSON(w, members)
+	}
+}
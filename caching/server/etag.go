@@ -0,0 +1,29 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// formatETag returns the entity tag of a key version.
+func formatETag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// parseIfMatch returns the version expected by the If-Match header of a
+// request. It reports false when the request has no If-Match header.
+func parseIfMatch(r *http.Request) (uint64, bool, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, false, nil
+	}
+
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.ParseUint(tag, 10, 64)
+	if err != nil {
+		return 0, false, errors.New("If-Match must hold a single version ETag")
+	}
+	return version, true, nil
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"distributed-caching-and-loadbalancing-system/caching/cache"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// eventBuffer is how many events a stream may fall behind before it is dropped.
+	eventBuffer = 1024
+
+	// eventKeepAlive is how often an idle stream sends a comment, so proxies
+	// and clients do not time it out.
+	eventKeepAlive = 15 * time.Second
+)
+
+// handleEvents streams the keyspace events of a namespace as server-sent
+// events. The match query parameter filters keys with a glob pattern and types
+// takes a comma separated list of operations to receive. A client too slow to
+// keep up receives a final "dropped" event and has to reconnect.
+func handleEvents(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter := cache.EventFilter{Match: r.URL.Query().Get("match")}
+		if types := r.URL.Query().Get("types"); types != "" {
+			filter.Ops = strings.Split(types, ",")
+		}
+		if err := filter.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		flusher, ok := openEventStream(w)
+		if !ok {
+			return
+		}
+
+		subscription := cacheInstance.Subscribe(filter, eventBuffer)
+		defer subscription.Close()
+
+		keepAlive := time.NewTicker(eventKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+				flusher.Flush()
+
+			case event, open := <-subscription.Events:
+				if !open {
+					if subscription.Dropped() {
+						writeStreamEvent(w, flusher, "dropped", struct{}{})
+					}
+					return
+				}
+				writeStreamEvent(w, flusher, event.Op, event)
+			}
+		}
+	}
+}
+
+// openEventStream starts a server-sent events response. It fails with a 500
+// when the connection cannot be flushed as events are written.
+func openEventStream(w http.ResponseWriter) (http.Flusher, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return flusher, true
+}
+
+// writeStreamEvent sends one server-sent event carrying data encoded as JSON.
+func writeStreamEvent(w http.ResponseWriter, flusher http.Flusher, name string, data interface{}) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		log.Println("Error encoding event:", err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, encoded)
+	flusher.Flush()
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"distributed-caching-and-loadbalancing-system/caching/cache"
+	"net/http"
+	"time"
+)
+
+// handleExpire handles setting the TTL of a key on the master node. The TTL is
+// a duration such as "30s"; one that is not positive deletes the key.
+func handleExpire(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key string `json:"key"`
+			TTL string `json:"ttl"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Key == "" || request.TTL == "" {
+			http.Error(w, "Missing key or ttl", http.StatusBadRequest)
+			return
+		}
+		duration, err := time.ParseDuration(request.TTL)
+		if err != nil {
+			http.Error(w, "Invalid TTL duration", http.StatusBadRequest)
+			return
+		}
+
+		if err := cacheInstance.Expire(request.Key, duration); err != nil {
+			writeCacheError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]bool{"updated": true})
+	}
+}
+
+// handleExpireAt handles setting the absolute expiry of a key, in Unix seconds,
+// on the master node.
+func handleExpireAt(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key       string `json:"key"`
+			Timestamp *int64 `json:"timestamp"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Key == "" || request.Timestamp == nil {
+			http.Error(w, "Missing key or timestamp", http.StatusBadRequest)
+			return
+		}
+
+		if err := cacheInstance.ExpireAt(request.Key, time.Unix(*request.Timestamp, 0)); err != nil {
+			writeCacheError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]bool{"updated": true})
+	}
+}
+
+// handlePersist handles removing the expiry of a key on the master node.
+func handlePersist(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key string `json:"key"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+
+		persisted, err := cacheInstance.Persist(request.Key)
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]bool{"updated": persisted})
+	}
+}
+
+// handleTTL handles reading the remaining TTL of a key on the slave node, in
+// the given unit. Keys without expiry report -1.
+func handleTTL(cacheInstance *cache.Cache, unit time.Duration, name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, ok := readQuery(w, r, "key")
+		if !ok {
+			return
+		}
+
+		ttl, err := cacheInstance.TTL(params[0])
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+
+		remaining := int64(-1)
+		if ttl != cache.NoExpiry {
+			remaining = int64((ttl + unit/2) / unit)
+		}
+		writeJSON(w, map[string]int64{name: remaining})
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"distributed-caching-and-loadbalancing-system/caching/cache"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// writeLockError reports locks held by another owner as conflicts, and
+// renewals and releases by anyone but the owner as forbidden.
+func writeLockError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, cache.ErrInvalidLease):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, cache.ErrLocked):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, cache.ErrNotLockOwner):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		writeCacheError(w, err)
+	}
+}
+
+// parseLease parses the lease of a lock request, such as "30s". The cache
+// refuses leases that are not positive.
+func parseLease(value string) (time.Duration, error) {
+	lease, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.New("Invalid lease")
+	}
+	return lease, nil
+}
+
+func writeLock(w http.ResponseWriter, lock cache.Lock) {
+	writeJSON(w, map[string]interface{}{
+		"name":          lock.Name,
+		"owner":         lock.Owner,
+		"token":         lock.Token,
+		"expires_at_ms": lock.ExpiresAt.UnixMilli(),
+	})
+}
+
+// handleAcquireLock handles acquiring a lock for a lease on the master node.
+func handleAcquireLock(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Name  string `json:"name"`
+			Lease string `json:"lease"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Name == "" {
+			http.Error(w, "Missing name", http.StatusBadRequest)
+			return
+		}
+		lease, err := parseLease(request.Lease)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		lock, err := cacheInstance.AcquireLock(request.Name, lease)
+		if err != nil {
+			writeLockError(w, err)
+			return
+		}
+
+		writeLock(w, lock)
+	}
+}
+
+// handleRenewLock handles extending the lease of a lock by its owner on the master node.
+func handleRenewLock(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Name  string `json:"name"`
+			Owner string `json:"owner"`
+			Lease string `json:"lease"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Name == "" || request.Owner == "" {
+			http.Error(w, "Missing name or owner", http.StatusBadRequest)
+			return
+		}
+		lease, err := parseLease(request.Lease)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		lock, err := cacheInstance.RenewLock(request.Name, request.Owner, lease)
+		if err != nil {
+			writeLockError(w, err)
+			return
+		}
+
+		writeLock(w, lock)
+	}
+}
+
+// handleReleaseLock handles releasing a lock by its owner on the master node.
+func handleReleaseLock(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Name  string `json:"name"`
+			Owner string `json:"owner"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Name == "" || request.Owner == "" {
+			http.Error(w, "Missing name or owner", http.StatusBadRequest)
+			return
+		}
+
+		if err := cacheInstance.ReleaseLock(request.Name, request.Owner); err != nil {
+			writeLockError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]string{"result": "OK"})
+	}
+}
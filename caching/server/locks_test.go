@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"distributed-caching-and-loadbalancing-system/caching/cache"
+	"distributed-caching-and-loadbalancing-system/client/lock"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newLockServer(t *testing.T) *lock.Client {
+	namespaces := cache.NewNamespaces(cache.Options{})
+	t.Cleanup(namespaces.Close)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cache/lock", withNamespace(namespaces, handleAcquireLock))
+	mux.HandleFunc("/cache/renewlock", withExistingNamespace(namespaces, handleRenewLock))
+	mux.HandleFunc("/cache/unlock", withExistingNamespace(namespaces, handleReleaseLock))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return lock.NewClient(server.URL)
+}
+
+func TestLockClient(t *testing.T) {
+	ctx := context.Background()
+	locks := newLockServer(t)
+
+	held, err := locks.Acquire(ctx, "deploy", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := locks.Acquire(ctx, "deploy", time.Minute); !errors.Is(err, lock.ErrLocked) {
+		t.Fatalf("Acquire of a held lock = %v, want ErrLocked", err)
+	}
+	if _, err := locks.Acquire(ctx, "other", 0); !errors.Is(err, lock.ErrInvalidLease) {
+		t.Fatalf("Acquire with a zero lease = %v, want ErrInvalidLease", err)
+	}
+
+	renewed, err := locks.Renew(ctx, held, 2*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed.Token != held.Token || !renewed.ExpiresAt.After(held.ExpiresAt) {
+		t.Fatalf("Renew = %+v, want the token %d with a later deadline than %v", renewed, held.Token, held.ExpiresAt)
+	}
+
+	stolen := held
+	stolen.Owner = "someone else"
+	if err := locks.Release(ctx, stolen); !errors.Is(err, lock.ErrNotLockOwner) {
+		t.Fatalf("Release by another owner = %v, want ErrNotLockOwner", err)
+	}
+	if err := locks.Release(ctx, held); err != nil {
+		t.Fatal(err)
+	}
+	if err := locks.Release(ctx, held); !errors.Is(err, lock.ErrNotLockOwner) {
+		t.Fatalf("second Release = %v, want ErrNotLockOwner", err)
+	}
+	if err := locks.Namespace("missing").Release(ctx, held); !errors.Is(err, lock.ErrNotLockOwner) {
+		t.Fatalf("Release in a missing namespace = %v, want ErrNotLockOwner", err)
+	}
+}
+
+func TestLockClientWait(t *testing.T) {
+	ctx := context.Background()
+	locks := newLockServer(t)
+
+	first, err := locks.Acquire(ctx, "deploy", 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait gets the lock once the first lease runs out, with a greater fencing token
+	second, err := locks.Wait(ctx, "deploy", time.Minute, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Token <= first.Token {
+		t.Fatalf("token %d after %d, want it greater", second.Token, first.Token)
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := locks.Wait(timeout, "deploy", time.Minute, 10*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait on a held lock = %v, want the context's deadline", err)
+	}
+}
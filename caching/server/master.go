@@ -1,9 +1,12 @@
 package server
 
 import (
+	"distributed-caching-and-loadbalancing-system/caching"
 	"distributed-caching-and-loadbalancing-system/caching/cache"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
@@ -12,32 +15,97 @@ import (
 )
 
 var (
-	startTime        = time.Now()
-	slaveConnections = make(map[string]net.Conn)
+	startTime  = time.Now()
+	replicator = caching.NewReplicator()
 )
 
 // Info represents information about the server.
 type Info struct {
-	Status          string    `json:"status"`
-	StartTime       time.Time `json:"start_time"`
-	ConnectedSlaves []string  `json:"connected_slaves"`
-	NumberOfSlaves  int       `json:"number_of_slaves"`
+	Status          string                 `json:"status"`
+	StartTime       time.Time              `json:"start_time"`
+	ConnectedSlaves []string               `json:"connected_slaves"`
+	NumberOfSlaves  int                    `json:"number_of_slaves"`
+	Stats           cache.Stats            `json:"stats"`
+	MaxEntries      int                    `json:"max_entries"`
+	MaxBytes        int64                  `json:"max_bytes"`
+	EvictionPolicy  string                 `json:"eviction_policy"`
+	MaxMemory       int64                  `json:"maxmemory"`
+	MaxMemoryPolicy string                 `json:"maxmemory_policy"`
+	UsedMemory      int64                  `json:"used_memory"`
+	PeakMemory      int64                  `json:"peak_memory"`
+	Namespaces      map[string]cache.Stats `json:"namespaces"`
+	AOFKeyID        string                 `json:"aof_key_id,omitempty"`
 }
 
 // RunAsMaster starts the master node.
 func RunAsMaster(port string) {
 	aofUrl := "tmp/aof.log" //getAofFileLocation("config.yaml")
-	cacheInstance := cache.NewCache()
+	cacheOptions, err := readCacheOptions("config.yml")
+	if err != nil {
+		log.Println("Error reading cache limits, running unbounded:", err)
+	}
+	cacheOptions.Encryption, err = readEncryptionKeyring("config.yml")
+	if err != nil {
+		log.Fatal("Error loading the AOF encryption key: ", err)
+	}
+	namespaces := cache.NewNamespaces(cacheOptions)
 	fmt.Println("Master listening to slaves at port: 8080")
 	fmt.Println("Listening to clients at port ", port)
 	fmt.Println("AOF URL:", aofUrl)
-	cacheInstance.ReplayAOF(aofUrl)
+	if err := namespaces.ReplayAOF(aofUrl); err != nil {
+		if errors.Is(err, cache.ErrAOFPlaintext) && !cacheOptions.EncryptPlaintextAOF {
+			log.Println("Set encrypt_plaintext_aof to encrypt an AOF written before encryption_key was configured")
+		}
+		log.Fatal("Error replaying the AOF, refusing to start: ", err)
+	}
+
+	// Stream every write of every namespace to the connected slaves
+	namespaces.SetReplicationHook(replicator.Broadcast)
 
-	// Expose HTTP endpoints for cache operations
-	http.HandleFunc("/cache/set", handleSetCache(cacheInstance))
-	http.HandleFunc("/cache/delete", handleDeleteCache(cacheInstance))
-	http.HandleFunc("/cache/reset", handleResetCache(cacheInstance))
-	http.HandleFunc("/server/info", handleServerInfo)
+	// Expose HTTP endpoints for cache operations, each on the namespace the request selects
+	namespaced := func(handler func(*cache.Cache) http.HandlerFunc) http.HandlerFunc {
+		return withNamespace(namespaces, handler)
+	}
+	existing := func(handler func(*cache.Cache) http.HandlerFunc) http.HandlerFunc {
+		return withExistingNamespace(namespaces, handler)
+	}
+	http.HandleFunc("/cache/set", namespaced(handleSetCache))
+	http.HandleFunc("/cache/delete", existing(handleDeleteCache))
+	http.HandleFunc("/cache/reset", existing(handleResetCache))
+	http.HandleFunc("/cache/incr", namespaced(func(c *cache.Cache) http.HandlerFunc { return handleIncrBy(c, 1) }))
+	http.HandleFunc("/cache/decr", namespaced(func(c *cache.Cache) http.HandlerFunc { return handleIncrBy(c, -1) }))
+	http.HandleFunc("/cache/incrbyfloat", namespaced(handleIncrByFloat))
+	http.HandleFunc("/cache/expire", existing(handleExpire))
+	http.HandleFunc("/cache/expireat", existing(handleExpireAt))
+	http.HandleFunc("/cache/persist", existing(handlePersist))
+	http.HandleFunc("/cache/hset", namespaced(handleHSet))
+	http.HandleFunc("/cache/lpush", namespaced(handleLPush))
+	http.HandleFunc("/cache/rpop", existing(handleRPop))
+	http.HandleFunc("/cache/sadd", namespaced(handleSAdd))
+	http.HandleFunc("/cache/zadd", namespaced(handleZAdd))
+	http.HandleFunc("/cache/xadd", namespaced(handleXAdd))
+	http.HandleFunc("/cache/xtrim", existing(handleXTrim))
+	http.HandleFunc("/cache/xgroupcreate", namespaced(handleXGroupCreate))
+	http.HandleFunc("/cache/xreadgroup", existing(handleXReadGroup))
+	http.HandleFunc("/cache/xack", existing(handleXAck))
+	http.HandleFunc("/cache/bfreserve", namespaced(handleBFReserve))
+	http.HandleFunc("/cache/bfadd", namespaced(handleBFAdd))
+	http.HandleFunc("/cache/pfadd", namespaced(handlePFAdd))
+	http.HandleFunc("/cache/pfmerge", namespaced(handlePFMerge))
+	http.HandleFunc("/cache/cmsinit", namespaced(handleCMSInit))
+	http.HandleFunc("/cache/cmsincrby", namespaced(handleCMSIncrBy))
+	http.HandleFunc("/cache/lock", namespaced(handleAcquireLock))
+	http.HandleFunc("/cache/renewlock", existing(handleRenewLock))
+	http.HandleFunc("/cache/unlock", existing(handleReleaseLock))
+	http.HandleFunc("/cache/mset", namespaced(handleMSet))
+	http.HandleFunc("/cache/mdel", existing(handleMDel))
+	http.HandleFunc("/cache/invalidatetag", existing(handleInvalidateTag))
+	http.HandleFunc("/cache/exec", namespaced(handleExec))
+	http.HandleFunc("/cache/events", existing(handleEvents))
+	http.HandleFunc("/pubsub/publish", handlePublish(namespaces))
+	http.HandleFunc("/pubsub/subscribe", handleSubscribe(namespaces))
+	http.HandleFunc("/server/info", handleServerInfo(namespaces))
+	http.HandleFunc("/server/rewriteaof", handleRewriteAOF(namespaces))
 
 	// Start HTTP server for clients
 	go func() {
@@ -61,12 +129,13 @@ func RunAsMaster(port string) {
 		}
 
 		// Handle slave connection
-		go handleSlaveConnection(conn, cacheInstance)
+		go handleSlaveConnection(conn, namespaces)
 	}
 }
 
-// handleSlaveConnection handles connections from slave nodes.
-func handleSlaveConnection(conn net.Conn, cacheInstance *cache.Cache) {
+// handleSlaveConnection handles connections from slave nodes. The slave gets a
+// snapshot of the cache followed by the stream of writes until it disconnects.
+func handleSlaveConnection(conn net.Conn, namespaces *cache.Namespaces) {
 	defer conn.Close()
 
 	log.Printf("Handling slave request....")
@@ -78,36 +147,22 @@ func handleSlaveConnection(conn net.Conn, cacheInstance *cache.Cache) {
 		return
 	}
 	log.Printf("Slave connected: %v\n", slaveInfo)
+	slaveId := strconv.Itoa(slaveInfo.NodeId)
 
-	// Add slave connection to the map
-	slaveConnections[string(rune(slaveInfo.NodeId))] = conn
-
-	// Send cache data to the slave for replication
-	if err := sendCacheDataToSlave(conn, cacheInstance); err != nil {
-		log.Println("Error sending cache data to slave:", err)
-		return
-	}
+	// Register the slave for replication, starting from a snapshot of every namespace
+	namespaces.SyncFollower(func(snapshot []string) {
+		replicator.AddFollower(slaveId, conn, snapshot)
+	})
 
 	// Log when slave disconnects
 	defer func() {
-		delete(slaveConnections, strconv.Itoa(slaveInfo.NodeId))
+		replicator.RemoveFollower(slaveId, conn)
 		log.Printf("Slave disconnected: %v\n", slaveInfo)
 	}()
-}
-
-// sendCacheDataToSlave sends cache data to the slave for replication.
-func sendCacheDataToSlave(conn net.Conn, cacheInstance *cache.Cache) error {
-	// Obtain cache data
-	cacheData := cacheInstance.GetCacheData()
-
-	println("Cache Data: ", cacheData)
-	// Encode and send cache data to the slave
-	encoder := json.NewEncoder(conn)
-	if err := encoder.Encode(cacheData); err != nil {
-		return fmt.Errorf("error sending cache data to slave: %v", err)
-	}
 
-	return nil
+	// Slaves never send anything after their information, so reading only
+	// returns once the connection is closed
+	_, _ = io.Copy(io.Discard, conn)
 }
 
 // handleSetCache handles the cache set operation on the master node.
@@ -121,36 +176,64 @@ func handleSetCache(cacheInstance *cache.Cache) http.HandlerFunc {
 
 		// Decode JSON request body
 		var request struct {
-			Key   string `json:"key"`
-			Value string `json:"value"`
-			TTL   string `json:"ttl"`
+			Key      string   `json:"key"`
+			Value    string   `json:"value"`
+			Encoding string   `json:"encoding"` // "base64" for binary values
+			TTL      string   `json:"ttl"`
+			Tags     []string `json:"tags"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 			http.Error(w, "Invalid JSON request body", http.StatusBadRequest)
 			return
 		}
 
-		// Perform cache set operation with TTL
+		// Parse TTL duration, an empty TTL keeps the key until it is deleted
+		var duration time.Duration
 		if request.TTL != "" {
-			// Parse TTL duration
-			duration, err := time.ParseDuration(request.TTL)
+			var err error
+			duration, err = time.ParseDuration(request.TTL)
 			if err != nil {
 				http.Error(w, "Invalid TTL duration", http.StatusBadRequest)
 				return
 			}
+		}
 
-			// Set cache with TTL
-			err = cacheInstance.Set(request.Key, []byte(request.Value), duration)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusNotAcceptable)
-				return
-			}
+		value, err := decodeValue(request.Value, request.Encoding)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		// Update cache on connected slave nodes
-		updateCacheOnSlaves(cacheInstance)
+		expectedVersion, conditional, err := parseIfMatch(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if conditional && len(request.Tags) > 0 {
+			http.Error(w, "Tags cannot be set with If-Match", http.StatusBadRequest)
+			return
+		}
 
-		// Respond with success message
+		// Perform cache set operation with TTL, only at the expected version when If-Match is given
+		var version uint64
+		if conditional {
+			version, err = cacheInstance.CompareAndSwap(request.Key, expectedVersion, value, duration)
+		} else if len(request.Tags) > 0 {
+			version, err = cacheInstance.SetTagged(request.Key, value, duration, request.Tags...)
+		} else {
+			version, err = cacheInstance.SetVersioned(request.Key, value, duration)
+		}
+		if errors.Is(err, cache.ErrInvalidTag) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+
+		// Respond with success message and the new version
+		w.Header().Set("ETag", formatETag(version))
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "Cache set successful\n")
 	}
@@ -176,30 +259,16 @@ func handleDeleteCache(cacheInstance *cache.Cache) http.HandlerFunc {
 		// Perform cache delete operation
 		err := cacheInstance.Delete(key)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeCacheError(w, err)
 			return
 		}
 
-		// Update cache on connected slave nodes
-		updateCacheOnSlaves(cacheInstance)
-
 		// Respond with success message
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "Cache delete successful\n")
 	}
 }
 
-// updateCacheOnSlaves updates the cache on connected slave nodes.
-func updateCacheOnSlaves(cacheInstance *cache.Cache) {
-	for _, conn := range slaveConnections {
-		err := sendCacheDataToSlave(conn, cacheInstance)
-		if err != nil {
-			log.Println("Error updating cache on slave:", err)
-			// Handle error as needed
-		}
-	}
-}
-
 // handleResetCache handles the cache reset operation on the master node.
 func handleResetCache(cacheInstance *cache.Cache) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -212,7 +281,7 @@ func handleResetCache(cacheInstance *cache.Cache) http.HandlerFunc {
 		// Perform cache reset operation
 		err := cacheInstance.ResetCache()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeCacheError(w, err)
 			return
 		}
 
@@ -222,28 +291,59 @@ func handleResetCache(cacheInstance *cache.Cache) http.HandlerFunc {
 	}
 }
 
-// handleServerInfo handles requests for server information.
-func handleServerInfo(w http.ResponseWriter, r *http.Request) {
-	log.Printf("HTTP request received: %s %s", r.Method, r.URL.Path)
-	info := Info{
-		Status:          "Running",
-		StartTime:       startTime,
-		ConnectedSlaves: getConnectedSlaveIDs(),
-		NumberOfSlaves:  len(slaveConnections),
-	}
+// handleServerInfo handles requests for server information. The stats are
+// those of the namespace the request selects.
+func handleServerInfo(namespaces *cache.Namespaces) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("HTTP request received: %s %s", r.Method, r.URL.Path)
+		cacheInstance, err := namespaces.Lookup(namespaceOf(r))
+		if err != nil {
+			writeNamespaceError(w, err)
+			return
+		}
 
-	// Encode server information as JSON and write response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(info)
+		info := Info{
+			Status:          "Running",
+			StartTime:       startTime,
+			ConnectedSlaves: replicator.Followers(),
+			NumberOfSlaves:  len(replicator.Followers()),
+			Stats:           cacheInstance.Stats(),
+			MaxEntries:      cacheInstance.Options().MaxEntries,
+			MaxBytes:        cacheInstance.Options().MaxBytes,
+			EvictionPolicy:  cacheInstance.EvictionPolicy(),
+			MaxMemory:       cacheInstance.Options().MaxMemory,
+			MaxMemoryPolicy: cacheInstance.MaxMemoryPolicy(),
+			Namespaces:      namespaces.Stats(),
+		}
+		info.UsedMemory, info.PeakMemory = namespaces.Memory()
+		if keys := cacheInstance.Options().Encryption; keys != nil {
+			info.AOFKeyID = keys.CurrentKeyID()
+		}
+
+		// Encode server information as JSON and write response
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	}
 }
 
-// getConnectedSlaveIDs returns the IDs of connected slaves.
-func getConnectedSlaveIDs() []string {
-	var ids []string
-	for id := range slaveConnections {
-		ids = append(ids, id)
+// handleRewriteAOF compacts the AOF of the master into the records that
+// recreate every namespace, sealed with the current encryption key.
+func handleRewriteAOF(namespaces *cache.Namespaces) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("HTTP request received: %s %s", r.Method, r.URL.Path)
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := namespaces.RewriteAOF(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "AOF rewrite successful\n")
 	}
-	return ids
 }
 
 // logRequest is a middleware function to log HTTP requests.
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"distributed-caching-and-loadbalancing-system/caching/cache"
+	"errors"
+	"net/http"
+)
+
+// namespaceHeader selects the namespace of a request. The namespace query
+// parameter does the same for clients that cannot set headers.
+const namespaceHeader = "X-Cache-Namespace"
+
+// namespaceOf returns the namespace selected by a request, empty for the default one.
+func namespaceOf(r *http.Request) string {
+	if namespace := r.Header.Get(namespaceHeader); namespace != "" {
+		return namespace
+	}
+	return r.URL.Query().Get("namespace")
+}
+
+// writeNamespaceError reports invalid namespace names as bad requests and
+// namespaces that do not exist as not found.
+func writeNamespaceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, cache.ErrInvalidNamespace):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, cache.ErrNamespaceNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		writeCacheError(w, err)
+	}
+}
+
+// withNamespace serves each request with the handler built for the cache of
+// the namespace it selects, creating the namespace if needed. Only writes
+// that may add keys should create namespaces.
+func withNamespace(namespaces *cache.Namespaces, handler func(*cache.Cache) http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cacheInstance, err := namespaces.Namespace(namespaceOf(r))
+		if err != nil {
+			writeNamespaceError(w, err)
+			return
+		}
+		handler(cacheInstance)(w, r)
+	}
+}
+
+// withExistingNamespace serves each request like withNamespace, but only on
+// namespaces that already exist.
+func withExistingNamespace(namespaces *cache.Namespaces, handler func(*cache.Cache) http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cacheInstance, err := namespaces.Lookup(namespaceOf(r))
+		if err != nil {
+			writeNamespaceError(w, err)
+			return
+		}
+		handler(cacheInstance)(w, r)
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"distributed-caching-and-loadbalancing-system/caching/cache"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// messageBuffer is how many messages a subscriber may fall behind before it is dropped.
+const messageBuffer = 1024
+
+// handlePublish handles publishing a message on a channel on the master node.
+// Subscribers of every node receive it; the response counts those of the master.
+func handlePublish(namespaces *cache.Namespaces) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Channel string `json:"channel"`
+			Message string `json:"message"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Channel == "" {
+			http.Error(w, "Missing channel", http.StatusBadRequest)
+			return
+		}
+
+		receivers := namespaces.Publish(request.Channel, request.Message)
+		writeJSON(w, map[string]int{"receivers": receivers})
+	}
+}
+
+// handleSubscribe streams the messages published on the channel query
+// parameters and on the channels matching the pattern ones as server-sent
+// events. Both parameters can be repeated. The stream starts with a
+// "subscribe" event once the subscription is active, and a client too slow to
+// keep up receives a final "dropped" event.
+func handleSubscribe(namespaces *cache.Namespaces) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		channels, patterns := r.URL.Query()["channel"], r.URL.Query()["pattern"]
+
+		subscription, err := namespaces.Subscribe(channels, patterns, messageBuffer)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer subscription.Close()
+
+		flusher, ok := openEventStream(w)
+		if !ok {
+			return
+		}
+		writeStreamEvent(w, flusher, "subscribe", map[string][]string{"channels": channels, "patterns": patterns})
+
+		keepAlive := time.NewTicker(eventKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+				flusher.Flush()
+
+			case message, open := <-subscription.Messages:
+				if !open {
+					if subscription.Dropped() {
+						writeStreamEvent(w, flusher, "dropped", struct{}{})
+					}
+					return
+				}
+				writeStreamEvent(w, flusher, "message", message)
+			}
+		}
+	}
+}
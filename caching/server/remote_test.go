@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"distributed-caching-and-loadbalancing-system/caching/cache"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newCacheServer serves the master's writes and the slave's reads of one set
+// of namespaces, like a cluster behind its load balancer.
+func newCacheServer(t *testing.T, opts cache.Options) (*cache.Namespaces, *cache.RemoteCache) {
+	namespaces := cache.NewNamespaces(opts)
+	t.Cleanup(namespaces.Close)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cache/get", withExistingNamespace(namespaces, handleGetCache))
+	mux.HandleFunc("/cache/type", withExistingNamespace(namespaces, handleType))
+	mux.HandleFunc("/cache/mget", withExistingNamespace(namespaces, handleMGet))
+	mux.HandleFunc("/cache/set", withNamespace(namespaces, handleSetCache))
+	mux.HandleFunc("/cache/mset", withNamespace(namespaces, handleMSet))
+	mux.HandleFunc("/cache/delete", withExistingNamespace(namespaces, handleDeleteCache))
+	mux.HandleFunc("/cache/mdel", withExistingNamespace(namespaces, handleMDel))
+	mux.HandleFunc("/server/info", handleServerInfo(namespaces))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return namespaces, cache.NewRemoteCache(server.URL)
+}
+
+func TestRemoteCacheErrors(t *testing.T) {
+	ctx := context.Background()
+	namespaces, remote := newCacheServer(t, cache.Options{})
+
+	if _, err := remote.Get(ctx, "missing"); !errors.Is(err, cache.ErrNotFound) {
+		t.Fatalf("Get of a missing key = %v, want ErrNotFound", err)
+	}
+	if err := remote.Delete(ctx, "missing"); !errors.Is(err, cache.ErrNotFound) {
+		t.Fatalf("Delete of a missing key = %v, want ErrNotFound", err)
+	}
+	if _, err := remote.Namespace("orders").Get(ctx, "key"); !errors.Is(err, cache.ErrNotFound) {
+		t.Fatalf("Get in a missing namespace = %v, want ErrNotFound", err)
+	}
+
+	if _, err := namespaces.Default().HSet("hash", map[string][]byte{"f": []byte("v")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remote.Get(ctx, "hash"); !errors.Is(err, cache.ErrWrongType) {
+		t.Fatalf("Get of a hash = %v, want ErrWrongType", err)
+	}
+
+	version, err := remote.CompareAndSwap(ctx, "config", 0, []byte("v1"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = remote.CompareAndSwap(ctx, "config", version+100, []byte("v2"), 0)
+	var conflict *cache.ConflictError
+	if !errors.As(err, &conflict) || !errors.Is(err, cache.ErrConflict) {
+		t.Fatalf("CompareAndSwap with a wrong version = %v, want a *ConflictError", err)
+	}
+	if conflict.Key != "config" || conflict.Expected != version+100 || conflict.Actual != version {
+		t.Fatalf("conflict = %+v, want key config, expected %d, actual %d", conflict, version+100, version)
+	}
+}
+
+func TestRemoteCacheFull(t *testing.T) {
+	_, remote := newCacheServer(t, cache.Options{Shards: 1, MaxMemory: 1})
+
+	err := remote.Set(context.Background(), "key", []byte("v"), 0)
+	if !errors.Is(err, cache.ErrFull) || !errors.Is(err, cache.ErrOutOfMemory) {
+		t.Fatalf("Set on a full cache = %v, want ErrOutOfMemory", err)
+	}
+}
+
+func TestRemoteCacheThroughAdapters(t *testing.T) {
+	_, remote := newCacheServer(t, cache.Options{})
+
+	// Code written against Cacher keeps working over the network
+	scores := cache.NewTyped[string, int](cache.WithoutContext(remote), cache.JSONSerializer[int]{}, "score:")
+	if err := scores.SetMany(map[string]int{"ada": 3, "bob": 5}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	values, err := scores.GetMany("ada", "bob", "zoe")
+	if err != nil || len(values) != 2 || values["ada"] != 3 || values["bob"] != 5 {
+		t.Fatalf("GetMany = %v, %v, want ada and bob", values, err)
+	}
+	if _, err := scores.Get("zoe"); !errors.Is(err, cache.ErrNotFound) {
+		t.Fatalf("Get of a missing key = %v, want ErrNotFound", err)
+	}
+	if !scores.Has("ada") || scores.Has("zoe") {
+		t.Fatal("Has does not tell existing keys from missing ones")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := remote.Get(ctx, "score:ada"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Get with a canceled context = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"distributed-caching-and-loadbalancing-system/caching/cache"
+	"errors"
+	"net/http"
+)
+
+// writeSketchError reports invalid sketch parameters as bad requests and
+// sketches created over existing keys as conflicts.
+func writeSketchError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, cache.ErrSketchParams):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, cache.ErrKeyExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		writeCacheError(w, err)
+	}
+}
+
+// handleBFReserve handles creating a Bloom filter on the master node.
+func handleBFReserve(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key       string  `json:"key"`
+			ErrorRate float64 `json:"error_rate"`
+			Capacity  int     `json:"capacity"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Key == "" {
+			http.Error(w, "Missing key", http.StatusBadRequest)
+			return
+		}
+
+		if err := cacheInstance.BFReserve(request.Key, request.ErrorRate, request.Capacity); err != nil {
+			writeSketchError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]string{"result": "OK"})
+	}
+}
+
+// handleBFAdd handles adding items to a Bloom filter on the master node.
+func handleBFAdd(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key   string   `json:"key"`
+			Items []string `json:"items"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Key == "" || len(request.Items) == 0 {
+			http.Error(w, "Missing key or items", http.StatusBadRequest)
+			return
+		}
+
+		added, err := cacheInstance.BFAdd(request.Key, request.Items...)
+		if err != nil {
+			writeSketchError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string][]bool{"added": added})
+	}
+}
+
+// handleBFExists handles checking items against a Bloom filter on the slave
+// node. Items are given as repeated item parameters.
+func handleBFExists(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, ok := readQuery(w, r, "key", "item")
+		if !ok {
+			return
+		}
+
+		exists, err := cacheInstance.BFExists(params[0], r.URL.Query()["item"]...)
+		if err != nil {
+			writeSketchError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string][]bool{"exists": exists})
+	}
+}
+
+// handlePFAdd handles adding elements to a HyperLogLog on the master node.
+func handlePFAdd(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key      string   `json:"key"`
+			Elements []string `json:"elements"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Key == "" {
+			http.Error(w, "Missing key", http.StatusBadRequest)
+			return
+		}
+
+		changed, err := cacheInstance.PFAdd(request.Key, request.Elements...)
+		if err != nil {
+			writeSketchError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]bool{"changed": changed})
+	}
+}
+
+// handlePFCount handles estimating the distinct elements of HyperLogLogs on
+// the slave node. Keys are given as repeated key parameters.
+func handlePFCount(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := readQuery(w, r, "key"); !ok {
+			return
+		}
+
+		count, err := cacheInstance.PFCount(r.URL.Query()["key"]...)
+		if err != nil {
+			writeSketchError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]int64{"count": count})
+	}
+}
+
+// handlePFMerge handles merging HyperLogLogs into a destination key on the master node.
+func handlePFMerge(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Dest    string   `json:"dest"`
+			Sources []string `json:"sources"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Dest == "" || len(request.Sources) == 0 {
+			http.Error(w, "Missing dest or sources", http.StatusBadRequest)
+			return
+		}
+
+		if err := cacheInstance.PFMerge(request.Dest, request.Sources...); err != nil {
+			writeSketchError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]string{"result": "OK"})
+	}
+}
+
+// handleCMSInit handles creating a Count-Min sketch on the master node, by
+// width and depth or by error rate and probability.
+func handleCMSInit(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key         string  `json:"key"`
+			Width       int     `json:"width"`
+			Depth       int     `json:"depth"`
+			ErrorRate   float64 `json:"error_rate"`
+			Probability float64 `json:"probability"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Key == "" {
+			http.Error(w, "Missing key", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		if request.Width != 0 || request.Depth != 0 {
+			err = cacheInstance.CMSInitByDim(request.Key, request.Width, request.Depth)
+		} else {
+			err = cacheInstance.CMSInitByProb(request.Key, request.ErrorRate, request.Probability)
+		}
+		if err != nil {
+			writeSketchError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]string{"result": "OK"})
+	}
+}
+
+// handleCMSIncrBy handles counting items in a Count-Min sketch on the master node.
+func handleCMSIncrBy(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key        string           `json:"key"`
+			Increments map[string]int64 `json:"increments"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Key == "" || len(request.Increments) == 0 {
+			http.Error(w, "Missing key or increments", http.StatusBadRequest)
+			return
+		}
+
+		counts, err := cacheInstance.CMSIncrBy(request.Key, request.Increments)
+		if err != nil {
+			writeSketchError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]map[string]int64{"counts": counts})
+	}
+}
+
+// handleCMSQuery handles estimating the counts of items in a Count-Min sketch
+// on the slave node. Items are given as repeated item parameters.
+func handleCMSQuery(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, ok := readQuery(w, r, "key", "item")
+		if !ok {
+			return
+		}
+
+		counts, err := cacheInstance.CMSQuery(params[0], r.URL.Query()["item"]...)
+		if err != nil {
+			writeSketchError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string][]int64{"counts": counts})
+	}
+}
@@ -1,12 +1,15 @@
 package server
 
 import (
+	"bufio"
 	"distributed-caching-and-loadbalancing-system/caching/cache"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -18,56 +21,98 @@ func RunAsSlave(port string) {
 		return
 	}
 
-	// Retry connecting to master with backoff
-	for {
-		conn, err := net.Dial("tcp", masterAddr+":"+masterPort)
-		if err != nil {
-			log.Println("Error connecting to master:", err)
-			time.Sleep(5 * time.Second) // Retry after 5 seconds
-			continue
-		}
-		defer conn.Close()
-
-		log.Println("Connected to master at", masterAddr+":"+masterPort)
-
-		// Prepare slave information
-		slaveInfo := NodeInfo{
-			NodeId:     generateUniqueId(),
-			NodeIpAddr: getOutboundIP(),
-			Port:       port,
-		}
+	// Initialize local cache, configured like the master
+	cacheOptions, err := readCacheOptions("config.yml")
+	if err != nil {
+		log.Println("Error reading cache options, using the defaults:", err)
+	}
+	// Slaves never evict on their own: their reads would order keys differently
+	// than on the master and drop keys it still holds. They remove keys only as
+	// the master's EVICT records say, and never refuse a replicated write.
+	cacheOptions.MaxEntries = 0
+	cacheOptions.MaxBytes = 0
+	cacheOptions.MaxMemory = 0
+	cacheOptions.MaxSketchBytes = -1
+	namespaces := cache.NewNamespaces(cacheOptions)
+
+	// Expose HTTP endpoints for read operations, each on the namespace the
+	// request selects. Only the replication stream creates namespaces here.
+	namespaced := func(handler func(*cache.Cache) http.HandlerFunc) http.HandlerFunc {
+		return withExistingNamespace(namespaces, handler)
+	}
+	http.HandleFunc("/cache/get", namespaced(handleGetCache))
+	http.HandleFunc("/cache/getAll", namespaced(handleGetAllCacheData))
+	http.HandleFunc("/cache/mget", namespaced(handleMGet))
+	http.HandleFunc("/cache/scan", namespaced(handleScan))
+	http.HandleFunc("/cache/type", namespaced(handleType))
+	http.HandleFunc("/cache/ttl", namespaced(func(c *cache.Cache) http.HandlerFunc { return handleTTL(c, time.Second, "ttl") }))
+	http.HandleFunc("/cache/pttl", namespaced(func(c *cache.Cache) http.HandlerFunc { return handleTTL(c, time.Millisecond, "pttl") }))
+	http.HandleFunc("/cache/hget", namespaced(handleHGet))
+	http.HandleFunc("/cache/hgetall", namespaced(handleHGetAll))
+	http.HandleFunc("/cache/lrange", namespaced(handleLRange))
+	http.HandleFunc("/cache/sismember", namespaced(handleSIsMember))
+	http.HandleFunc("/cache/sinter", namespaced(handleSInter))
+	http.HandleFunc("/cache/zrangebyscore", namespaced(handleZRangeByScore))
+	http.HandleFunc("/cache/xlen", namespaced(handleXLen))
+	http.HandleFunc("/cache/xrange", namespaced(handleXRange))
+	http.HandleFunc("/cache/xread", namespaced(handleXRead))
+	http.HandleFunc("/cache/xpending", namespaced(handleXPending))
+	http.HandleFunc("/cache/bfexists", namespaced(handleBFExists))
+	http.HandleFunc("/cache/pfcount", namespaced(handlePFCount))
+	http.HandleFunc("/cache/cmsquery", namespaced(handleCMSQuery))
+	http.HandleFunc("/cache/versions", namespaced(handleVersions))
+	http.HandleFunc("/cache/events", namespaced(handleEvents))
+	http.HandleFunc("/pubsub/subscribe", handleSubscribe(namespaces))
+
+	// Start HTTP server
+	go func() {
+		log.Fatal(http.ListenAndServe(":"+port, nil))
+	}()
 
-		// Send JSON-encoded slave information to master
-		encoder := json.NewEncoder(conn)
-		err = encoder.Encode(slaveInfo)
-		if err != nil {
-			log.Println("Error sending slave information to master:", err)
-			return
-		}
+	// Prepare slave information
+	slaveInfo := NodeInfo{
+		NodeId:     generateUniqueId(),
+		NodeIpAddr: getOutboundIP(),
+		Port:       port,
+	}
 
-		// Receive cache data from master
-		var cacheData map[string][]byte
-		decoder := json.NewDecoder(conn)
-		println("Response: ", decoder)
-		err = decoder.Decode(&cacheData)
-		if err != nil {
-			log.Println("Error receiving cache data from master:", err)
-		}
+	// Follow the master, reconnecting with backoff whenever the link drops
+	for {
+		err := followMaster(masterAddr+":"+masterPort, slaveInfo, namespaces)
+		log.Println("Replication link to master lost:", err)
+		time.Sleep(5 * time.Second) // Retry after 5 seconds
+	}
+}
 
-		// Initialize local cache with received data
-		cacheInstance := cache.NewCache()
-		cacheInstance.SetCacheData(cacheData)
+// followMaster connects to the master and applies its snapshot and write
+// stream to the local namespaces until the connection fails.
+func followMaster(masterAddr string, slaveInfo NodeInfo, namespaces *cache.Namespaces) error {
+	conn, err := net.Dial("tcp", masterAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
 
-		// Expose HTTP endpoints for read operations
-		http.HandleFunc("/cache/get", handleGetCache(cacheInstance))
-		http.HandleFunc("/cache/getAll", handleGetAllCacheData(cacheInstance))
+	log.Println("Connected to master at", masterAddr)
 
-		// Start HTTP server
-		log.Fatal(http.ListenAndServe(":"+port, nil))
+	// Send JSON-encoded slave information to master
+	encoder := json.NewEncoder(conn)
+	if err := encoder.Encode(slaveInfo); err != nil {
+		return fmt.Errorf("error sending slave information to master: %v", err)
+	}
 
-		// Exit the retry loop if connection and initialization are successful
-		break
+	// Apply the snapshot, which starts by flushing every namespace, and every write after it
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if err := namespaces.ApplyRecord(scanner.Text()); err != nil {
+			log.Println("Error applying replication record:", err)
+		}
 	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
 }
 
 // handleGetCache handles the cache get operation on the slave node.
@@ -90,14 +135,15 @@ func handleGetCache(cacheInstance *cache.Cache) http.HandlerFunc {
 		key := keys[0]
 
 		// Perform cache get operation
-		value, err := cacheInstance.Get(key)
+		value, version, err := cacheInstance.GetWithVersion(key)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeCacheError(w, err)
 			return
 		}
 
 		println("Response Received: ", string(value))
-		// Respond with cache value
+		// Respond with cache value, tagged with its version for If-Match writes
+		w.Header().Set("ETag", formatETag(version))
 		w.WriteHeader(http.StatusOK)
 		w.Write(value)
 	}
@@ -117,12 +163,10 @@ func handleGetAllCacheData(cacheInstance *cache.Cache) http.HandlerFunc {
 		// Get cache map data
 		cacheMap := cacheInstance.GetCacheData()
 
-		// Prepare queue data
+		// Prepare queue data in eviction order
 		queueData := make([]interface{}, 0)
-		currentNode := cacheInstance.Queue.Head
-		for currentNode != nil {
-			queueData = append(queueData, currentNode.Data)
-			currentNode = currentNode.Next
+		for _, key := range cacheInstance.EvictionOrder() {
+			queueData = append(queueData, cacheMap[key])
 		}
 
 		// Prepare response object
@@ -143,6 +187,41 @@ func handleGetAllCacheData(cacheInstance *cache.Cache) http.HandlerFunc {
 	}
 }
 
+// handleScan handles one page of a cursor based key scan on the slave node.
+// Cursors are sent as strings since they do not fit in a JSON number.
+func handleScan(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, ok := readQuery(w, r, "cursor")
+		if !ok {
+			return
+		}
+		cursor, err := strconv.ParseUint(params[0], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		count := 0
+		if value := r.URL.Query().Get("count"); value != "" {
+			if count, err = strconv.Atoi(value); err != nil || count <= 0 {
+				http.Error(w, "Invalid count", http.StatusBadRequest)
+				return
+			}
+		}
+
+		keys, next := cacheInstance.Scan(cursor, r.URL.Query().Get("match"), count, r.URL.Query().Get("type"))
+		if keys == nil {
+			keys = []string{}
+		}
+		writeJSON(w, struct {
+			Cursor string   `json:"cursor"`
+			Keys   []string `json:"keys"`
+		}{
+			Cursor: strconv.FormatUint(next, 10),
+			Keys:   keys,
+		})
+	}
+}
+
 func generateUniqueId() int {
 	// use the current timestamp as the ID
 	return int(time.Now().Unix())
@@ -0,0 +1,368 @@
+package server
+
+import (
+	"distributed-caching-and-loadbalancing-system/caching/cache"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// streamEntry is how the HTTP API writes an entry of a stream. Entries read
+// again after they were trimmed have null fields.
+type streamEntry struct {
+	ID     string            `json:"id"`
+	Fields map[string]string `json:"fields"`
+}
+
+func encodeStreamEntries(entries []cache.StreamEntry) []streamEntry {
+	encoded := make([]streamEntry, len(entries))
+	for i, entry := range entries {
+		encoded[i].ID = entry.ID
+		if entry.Fields == nil {
+			continue
+		}
+		encoded[i].Fields = make(map[string]string, len(entry.Fields))
+		for field, value := range entry.Fields {
+			encoded[i].Fields[field] = string(value)
+		}
+	}
+	return encoded
+}
+
+func writeStreams(w http.ResponseWriter, streams map[string][]cache.StreamEntry) {
+	response := make(map[string][]streamEntry, len(streams))
+	for key, entries := range streams {
+		response[key] = encodeStreamEntries(entries)
+	}
+	writeJSON(w, map[string]interface{}{"streams": response})
+}
+
+// parseBlock parses the time in milliseconds a stream read may wait for new
+// entries. 0 waits as long as the request is open, like BLOCK 0, and an
+// absent parameter does not wait.
+func parseBlock(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errors.New("Invalid block duration")
+	}
+	return blockDuration(ms)
+}
+
+// blockDuration returns the wait of a stream read for a block given in
+// milliseconds, negative for a wait as long as the request is open.
+func blockDuration(ms int64) (time.Duration, error) {
+	if ms < 0 {
+		return 0, errors.New("Invalid block duration")
+	}
+	if ms == 0 {
+		return -1, nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// writeStreamError reports invalid stream IDs as bad requests and missing or
+// duplicate consumer groups as 404 and 409.
+func writeStreamError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, cache.ErrStreamID), errors.Is(err, cache.ErrInvalidStreamID):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, cache.ErrNoGroup):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, cache.ErrGroupExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		writeCacheError(w, err)
+	}
+}
+
+// handleXAdd handles appending an entry to a stream on the master node.
+func handleXAdd(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key    string            `json:"key"`
+			ID     string            `json:"id"` // "*" when empty
+			Fields map[string]string `json:"fields"`
+			MaxLen int               `json:"maxlen"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Key == "" || len(request.Fields) == 0 {
+			http.Error(w, "Missing key or fields", http.StatusBadRequest)
+			return
+		}
+		if request.ID == "" {
+			request.ID = "*"
+		}
+
+		fields := make(map[string][]byte, len(request.Fields))
+		for field, value := range request.Fields {
+			fields[field] = []byte(value)
+		}
+		id, err := cacheInstance.XAdd(request.Key, request.ID, fields, request.MaxLen)
+		if err != nil {
+			writeStreamError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]string{"id": id})
+	}
+}
+
+// handleXTrim handles trimming a stream on the master node.
+func handleXTrim(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key    string `json:"key"`
+			MaxLen int    `json:"maxlen"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Key == "" {
+			http.Error(w, "Missing key", http.StatusBadRequest)
+			return
+		}
+
+		removed, err := cacheInstance.XTrim(request.Key, request.MaxLen)
+		if err != nil {
+			writeStreamError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]int{"removed": removed})
+	}
+}
+
+// handleXGroupCreate handles creating a consumer group on the master node.
+func handleXGroupCreate(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key      string `json:"key"`
+			Group    string `json:"group"`
+			ID       string `json:"id"` // "$" when empty
+			MkStream bool   `json:"mkstream"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Key == "" || request.Group == "" {
+			http.Error(w, "Missing key or group", http.StatusBadRequest)
+			return
+		}
+		if request.ID == "" {
+			request.ID = "$"
+		}
+
+		if err := cacheInstance.XGroupCreate(request.Key, request.Group, request.ID, request.MkStream); err != nil {
+			writeStreamError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]string{"result": "OK"})
+	}
+}
+
+// handleXReadGroup handles reading streams as a consumer of a group on the
+// master node, since deliveries change the group.
+func handleXReadGroup(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Group    string   `json:"group"`
+			Consumer string   `json:"consumer"`
+			Keys     []string `json:"keys"`
+			IDs      []string `json:"ids"` // ">" for every key when empty
+			Count    int      `json:"count"`
+			Block    *int64   `json:"block"` // Milliseconds, 0 waits as long as the request is open
+			NoAck    bool     `json:"noack"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Group == "" || request.Consumer == "" || len(request.Keys) == 0 {
+			http.Error(w, "Missing group, consumer or keys", http.StatusBadRequest)
+			return
+		}
+		if len(request.IDs) == 0 {
+			for range request.Keys {
+				request.IDs = append(request.IDs, ">")
+			}
+		}
+		if len(request.IDs) != len(request.Keys) {
+			http.Error(w, "Every key needs an ID", http.StatusBadRequest)
+			return
+		}
+		var block time.Duration
+		if request.Block != nil {
+			var err error
+			if block, err = blockDuration(*request.Block); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		streams, err := cacheInstance.XReadGroup(r.Context(), request.Group, request.Consumer, request.Keys, request.IDs, request.Count, block, request.NoAck)
+		if err != nil {
+			writeStreamError(w, err)
+			return
+		}
+
+		writeStreams(w, streams)
+	}
+}
+
+// handleXAck handles acknowledging pending entries on the master node.
+func handleXAck(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key   string   `json:"key"`
+			Group string   `json:"group"`
+			IDs   []string `json:"ids"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+		if request.Key == "" || request.Group == "" || len(request.IDs) == 0 {
+			http.Error(w, "Missing key, group or ids", http.StatusBadRequest)
+			return
+		}
+
+		acked, err := cacheInstance.XAck(request.Key, request.Group, request.IDs...)
+		if err != nil {
+			writeStreamError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]int{"acked": acked})
+	}
+}
+
+// handleXLen handles reading the length of a stream on the slave node.
+func handleXLen(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, ok := readQuery(w, r, "key")
+		if !ok {
+			return
+		}
+
+		length, err := cacheInstance.XLen(params[0])
+		if err != nil {
+			writeStreamError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]int{"length": length})
+	}
+}
+
+// handleXRange handles reading a range of a stream on the slave node. start
+// and end default to the whole stream.
+func handleXRange(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, ok := readQuery(w, r, "key")
+		if !ok {
+			return
+		}
+		query := r.URL.Query()
+		start, end := query.Get("start"), query.Get("end")
+		if start == "" {
+			start = "-"
+		}
+		if end == "" {
+			end = "+"
+		}
+		count, err := parseCount(query.Get("count"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		entries, err := cacheInstance.XRange(params[0], start, end, count)
+		if err != nil {
+			writeStreamError(w, err)
+			return
+		}
+
+		writeJSON(w, encodeStreamEntries(entries))
+	}
+}
+
+// handleXRead handles reading new entries of streams on the slave node. Keys
+// are given as repeated key parameters, each with an id parameter at the same
+// position, and block makes the request wait for new entries.
+func handleXRead(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := readQuery(w, r); !ok {
+			return
+		}
+		query := r.URL.Query()
+		keys, ids := query["key"], query["id"]
+		if len(keys) == 0 || len(keys) != len(ids) {
+			http.Error(w, "Every key parameter needs an id parameter", http.StatusBadRequest)
+			return
+		}
+		count, err := parseCount(query.Get("count"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		block, err := parseBlock(query.Get("block"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		streams, err := cacheInstance.XRead(r.Context(), keys, ids, count, block)
+		if err != nil {
+			writeStreamError(w, err)
+			return
+		}
+
+		writeStreams(w, streams)
+	}
+}
+
+// handleXPending handles listing the pending entries of a consumer group on
+// the slave node, of one consumer when the consumer parameter is set.
+func handleXPending(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, ok := readQuery(w, r, "key", "group")
+		if !ok {
+			return
+		}
+
+		pending, err := cacheInstance.XPending(params[0], params[1], r.URL.Query().Get("consumer"))
+		if err != nil {
+			writeStreamError(w, err)
+			return
+		}
+
+		type pendingEntry struct {
+			ID         string `json:"id"`
+			Consumer   string `json:"consumer"`
+			IdleMs     int64  `json:"idle_ms"`
+			Deliveries int64  `json:"deliveries"`
+		}
+		response := make([]pendingEntry, len(pending))
+		for i, entry := range pending {
+			response[i] = pendingEntry{entry.ID, entry.Consumer, entry.Idle.Milliseconds(), entry.Deliveries}
+		}
+		writeJSON(w, response)
+	}
+}
+
+// parseCount parses the optional count parameter of stream reads, 0 when absent.
+func parseCount(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return 0, errors.New("Invalid count")
+	}
+	return count, nil
+}
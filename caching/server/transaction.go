@@ -0,0 +1,74 @@
+package server
+
+import (
+	"distributed-caching-and-loadbalancing-system/caching/cache"
+	"errors"
+	"net/http"
+)
+
+// handleExec handles running a transaction on the master node. Commands are
+// lists of strings taken like the CLI takes them, and watch maps keys to the
+// versions they must still have, as returned by /cache/versions or an ETag.
+// A watched key that changed aborts the whole transaction with 412.
+func handleExec(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Watch    map[string]uint64 `json:"watch"`
+			Commands [][]string        `json:"commands"`
+		}
+		if !decodeWriteRequest(w, r, &request) {
+			return
+		}
+
+		tx := cacheInstance.Multi()
+		for key, version := range request.Watch {
+			tx.WatchVersion(key, version)
+		}
+		for _, command := range request.Commands {
+			if err := tx.Queue(command...); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		results, err := tx.Exec()
+		if errors.Is(err, cache.ErrTxAborted) {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		}
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+
+		type result struct {
+			Value interface{} `json:"value"`
+			Error string      `json:"error,omitempty"`
+		}
+		response := make([]result, len(results))
+		for i, outcome := range results {
+			if outcome.Err != nil {
+				response[i].Error = outcome.Err.Error()
+				continue
+			}
+			if value, isBytes := outcome.Value.([]byte); isBytes {
+				response[i].Value = string(value)
+			} else {
+				response[i].Value = outcome.Value
+			}
+		}
+		writeJSON(w, map[string]interface{}{"results": response})
+	}
+}
+
+// handleVersions handles reading the versions of keys on the slave node, to
+// watch them in a later transaction. Missing keys report version 0.
+func handleVersions(cacheInstance *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := readQuery(w, r, "key"); !ok {
+			return
+		}
+
+		writeJSON(w, cacheInstance.Versions(r.URL.Query()["key"]...))
+	}
+}
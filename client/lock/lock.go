@@ -0,0 +1,161 @@
+// Package lock acquires, renews and releases the distributed locks of a cache
+// cluster through its HTTP API, usually behind the load balancer, which sends
+// the lock requests to the master.
+package lock
+
+import (
+	"bytes"
+	"context"
+	"distributed-caching-and-loadbalancing-system/caching/cache"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Lock is a lock held until its lease runs out. Its Owner renews and
+// releases it, and its fencing Token goes along with the writes it protects.
+type Lock = cache.Lock
+
+var (
+	// ErrLocked is returned when acquiring a lock that another owner holds.
+	ErrLocked = cache.ErrLocked
+
+	// ErrNotLockOwner is returned when renewing or releasing a lock that was
+	// lost, because it was released, its lease ran out or it was acquired by
+	// someone else since.
+	ErrNotLockOwner = cache.ErrNotLockOwner
+
+	// ErrInvalidLease is returned for leases that are not positive.
+	ErrInvalidLease = cache.ErrInvalidLease
+)
+
+// Client acquires the locks of one namespace of a cluster.
+type Client struct {
+	baseURL   string
+	namespace string
+	client    *http.Client
+}
+
+// NewClient returns a Client for the default namespace of the cluster served
+// at baseURL, such as "http://localhost:8888".
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Namespace returns a Client for the named namespace of the same cluster.
+func (c *Client) Namespace(name string) *Client {
+	return &Client{baseURL: c.baseURL, namespace: name, client: c.client}
+}
+
+// remoteLock is how the HTTP API returns a lock.
+type remoteLock struct {
+	Name        string `json:"name"`
+	Owner       string `json:"owner"`
+	Token       uint64 `json:"token"`
+	ExpiresAtMs int64  `json:"expires_at_ms"`
+}
+
+func (l remoteLock) lock() Lock {
+	return Lock{Name: l.Name, Owner: l.Owner, Token: l.Token, ExpiresAt: time.UnixMilli(l.ExpiresAtMs)}
+}
+
+// Acquire acquires the lock of the given name for lease, failing with
+// ErrLocked while another owner holds it.
+func (c *Client) Acquire(ctx context.Context, name string, lease time.Duration) (Lock, error) {
+	var response remoteLock
+	request := map[string]string{"name": name, "lease": lease.String()}
+	if err := c.post(ctx, "/cache/lock", request, &response); err != nil {
+		return Lock{}, err
+	}
+	return response.lock(), nil
+}
+
+// Wait acquires the lock of the given name for lease, retrying every retry
+// while another owner holds it, until ctx is done.
+func (c *Client) Wait(ctx context.Context, name string, lease time.Duration, retry time.Duration) (Lock, error) {
+	for {
+		lock, err := c.Acquire(ctx, name, lease)
+		if !errors.Is(err, ErrLocked) {
+			return lock, err
+		}
+		select {
+		case <-ctx.Done():
+			return Lock{}, ctx.Err()
+		case <-time.After(retry):
+		}
+	}
+}
+
+// Renew extends the lease of a lock to lease from now, failing with
+// ErrNotLockOwner once the lock was lost.
+func (c *Client) Renew(ctx context.Context, lock Lock, lease time.Duration) (Lock, error) {
+	var response remoteLock
+	request := map[string]string{"name": lock.Name, "owner": lock.Owner, "lease": lease.String()}
+	if err := c.post(ctx, "/cache/renewlock", request, &response); err != nil {
+		return Lock{}, err
+	}
+	return response.lock(), nil
+}
+
+// Release releases a lock, failing with ErrNotLockOwner once the lock was lost.
+func (c *Client) Release(ctx context.Context, lock Lock) error {
+	return c.post(ctx, "/cache/unlock", map[string]string{"name": lock.Name, "owner": lock.Owner}, nil)
+}
+
+// post sends request as the JSON body of a POST to path and decodes the
+// response into response unless it is nil. Error statuses are turned into the
+// errors of the package.
+func (c *Client) post(ctx context.Context, path string, request interface{}, response interface{}) error {
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.namespace != "" {
+		req.Header.Set("X-Cache-Namespace", c.namespace)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return statusError(resp.StatusCode, string(content))
+	}
+	if response == nil {
+		return nil
+	}
+	return json.Unmarshal(content, response)
+}
+
+// statusError turns a failed request into the error it reports. A namespace
+// that does not exist holds no lock, so it is reported as a lost one.
+func statusError(status int, message string) error {
+	message = strings.TrimSpace(message)
+	switch {
+	case status == http.StatusConflict:
+		return ErrLocked
+	case status == http.StatusForbidden, status == http.StatusNotFound:
+		return ErrNotLockOwner
+	case status == http.StatusBadRequest && message == ErrInvalidLease.Error():
+		return ErrInvalidLease
+	}
+	return fmt.Errorf("%s: %s", http.StatusText(status), message)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"gopkg.in/yaml.v2"
 	"io"
 	"log"
@@ -91,9 +92,10 @@ func routeRequest(req *http.Request) string {
 	// Extract request path
 	path := req.URL.Path
 
-	// Route based on request path
-	if strings.HasPrefix(path, "/server/info") || req.Method == http.MethodPost {
-		// GET request for server info or POST request, route to master node
+	// Route based on request path, batch reads POST their keys but are still reads
+	isRead := strings.HasPrefix(path, "/cache/mget")
+	if strings.HasPrefix(path, "/server/info") || (req.Method != http.MethodGet && !isRead) {
+		// GET request for server info or a write such as POST or DELETE, route to master node
 		return masterNode
 	}
 
@@ -157,7 +159,14 @@ func forwardResponse(clientConn net.Conn, serverConn net.Conn) error {
 	}
 	defer resp.Body.Close()
 
-	// Write response to client connection
+	// Relay event streams as they arrive instead of buffering them
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return streamResponse(clientConn, resp)
+	}
+
+	// Write response to client connection, telling the client it is closed after
+	// this response so it does not send its next request on it
+	resp.Close = true
 	var buf bytes.Buffer
 	resp.Write(&buf)
 	_, err = io.Copy(clientConn, &buf)
@@ -171,6 +180,28 @@ func forwardResponse(clientConn net.Conn, serverConn net.Conn) error {
 	return nil
 }
 
+// streamResponse relays a response of unknown length until the node closes it.
+// The body is sent unchunked and delimited by closing the connection.
+func streamResponse(clientConn net.Conn, resp *http.Response) error {
+	header := resp.Header.Clone()
+	header.Del("Transfer-Encoding")
+	header.Set("Connection", "close")
+
+	if _, err := fmt.Fprintf(clientConn, "HTTP/1.1 %s\r\n", resp.Status); err != nil {
+		return err
+	}
+	if err := header.Write(clientConn); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(clientConn, "\r\n"); err != nil {
+		return err
+	}
+
+	log.Println("Streaming response to client")
+	_, err := io.Copy(clientConn, resp.Body)
+	return err
+}
+
 func readConfig(filename string) (*Config, error) {
 	// Lock to prevent concurrent access while reading configuration
 	configMutex.Lock()